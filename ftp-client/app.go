@@ -8,22 +8,43 @@ import (
 )
 
 // App struct
+// 已连接的服务器保存在会话登记表 (sessions) 中，各方法通过会话 ID 指定服务器
 type App struct {
 	ctx context.Context
-	ftp *FTPClient
+
+	scheduler *Scheduler // 定时任务的调度器，图形界面启动后运行
 }
 
 // NewApp creates a new App application struct
 func NewApp() *App {
-	return &App{
-		ftp: NewFTPClient(),
-	}
+	return &App{}
 }
 
 // startup is called when the app starts. The context is saved
 // so we can call the runtime methods
 func (a *App) startup(ctx context.Context) {
 	a.ctx = ctx
+	MyConsole.SetContext(ctx)
+	a.scheduler = NewScheduler(a)
+	a.scheduler.Start()
+}
+
+// shutdown is called when the app is closing
+func (a *App) shutdown(ctx context.Context) {
+	if a.scheduler != nil {
+		a.scheduler.Stop()
+	}
+	closeEdits()
+	a.StopShare()
+	a.disconnectAll()
+}
+
+// emit 向前端发送事件；没有运行时上下文时 (命令行模式和测试) 忽略
+func (a *App) emit(name string, data ...interface{}) {
+	if a.ctx == nil {
+		return
+	}
+	runtime.EventsEmit(a.ctx, name, data...)
 }
 
 // Greet returns a greeting for the given name
@@ -41,3 +62,13 @@ func (a *App) OpenAndUploadFile() (string, error) {
 	return filePath, nil
 }
 
+// SetProtocolTrace 在运行时打开或关闭协议跟踪日志 (protocol.log)
+func (a *App) SetProtocolTrace(enabled bool) {
+	MyTracer.SetEnabled(enabled)
+	MyLogger.Info("protocol trace", "enabled", enabled)
+}
+
+// ProtocolTraceEnabled 返回协议跟踪日志当前是否打开
+func (a *App) ProtocolTraceEnabled() bool {
+	return MyTracer.Enabled()
+}
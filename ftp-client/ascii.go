@@ -0,0 +1,192 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"path"
+	"runtime"
+	"strings"
+)
+
+// TransferType 文件的传输类型，决定发送 TYPE A 还是 TYPE I
+type TransferType string
+
+const (
+	TransferAuto   TransferType = "auto"   // 按扩展名选择 ASCII 或二进制
+	TransferASCII  TransferType = "ascii"  // TYPE A，换行在 CRLF 和本地换行之间转换
+	TransferBinary TransferType = "binary" // TYPE I，原样传输
+)
+
+// ASCIIExtensions auto 模式下按 ASCII 传输的扩展名，其他文件按二进制传输
+var ASCIIExtensions = []string{
+	".txt", ".text", ".csv", ".tsv", ".log", ".md",
+	".htm", ".html", ".css", ".js", ".json", ".xml", ".svg",
+	".ini", ".cfg", ".conf", ".properties", ".yml", ".yaml",
+	".sh", ".bat", ".cmd", ".pl", ".py", ".php", ".sql",
+	".c", ".h", ".cpp", ".java", ".go",
+}
+
+// 本地文本文件是否以 CRLF 换行
+var localCRLF = runtime.GOOS == "windows"
+
+// ParseTransferType 解析传输类型，空字符串表示二进制
+func ParseTransferType(s string) (TransferType, error) {
+	switch t := TransferType(strings.ToLower(strings.TrimSpace(s))); t {
+	case "":
+		return TransferBinary, nil
+	case TransferAuto, TransferASCII, TransferBinary:
+		return t, nil
+	case "a":
+		return TransferASCII, nil
+	case "i", "image":
+		return TransferBinary, nil
+	}
+	return "", fmt.Errorf("不支持的传输类型: %s (可用: auto, ascii, binary)", s)
+}
+
+// resolve 返回 name 实际使用的传输类型，auto 按扩展名选择
+func (t TransferType) resolve(name string) TransferType {
+	switch t {
+	case TransferASCII:
+		return TransferASCII
+	case TransferAuto:
+		ext := strings.ToLower(path.Ext(name))
+		for _, e := range ASCIIExtensions {
+			if ext == e {
+				return TransferASCII
+			}
+		}
+	}
+	return TransferBinary
+}
+
+// asciiReader 把网络 ASCII 的 CRLF 转换为本地换行，用于下载
+type asciiReader struct {
+	r *bufio.Reader
+}
+
+func newASCIIReader(r io.Reader) io.Reader {
+	if localCRLF {
+		return r
+	}
+	return &asciiReader{r: bufio.NewReader(r)}
+}
+
+func (a *asciiReader) Read(p []byte) (int, error) {
+	n := 0
+	for n < len(p) {
+		b, err := a.r.ReadByte()
+		if err != nil {
+			if n > 0 {
+				return n, nil
+			}
+			return 0, err
+		}
+		// CR 后面是 LF 时丢弃 CR；数据块以 CR 结尾时 Peek 会等待下一块
+		if b == '\r' {
+			if next, err := a.r.Peek(1); err == nil && next[0] == '\n' {
+				continue
+			}
+		}
+		p[n] = b
+		n++
+		if a.r.Buffered() == 0 {
+			break
+		}
+	}
+	return n, nil
+}
+
+// asciiWriter 把本地文本的 LF 转换为 CRLF，用于上传，已经是 CRLF 的换行不变
+type asciiWriter struct {
+	w    io.Writer
+	prev byte
+	buf  []byte
+}
+
+func newASCIIWriter(w io.Writer) io.Writer {
+	return &asciiWriter{w: w}
+}
+
+func (a *asciiWriter) Write(p []byte) (int, error) {
+	a.buf = a.buf[:0]
+	for _, b := range p {
+		if b == '\n' && a.prev != '\r' {
+			a.buf = append(a.buf, '\r')
+		}
+		a.buf = append(a.buf, b)
+		a.prev = b
+	}
+	if _, err := a.w.Write(a.buf); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
+
+// setType 切换服务器的传输类型 ("A" 或 "I")，与当前类型相同时不发送 TYPE
+func (ftp *FTPConn) setType(t string) error {
+	if ftp.transferType == t {
+		return nil
+	}
+	response, err := ftp.SendCommand("TYPE " + t)
+	if err != nil {
+		ftp.transferType = ""
+		return err
+	}
+	if !strings.HasPrefix(response, "200") {
+		ftp.transferType = ""
+		return fmt.Errorf("%s", response)
+	}
+	ftp.transferType = t
+	return nil
+}
+
+// SetBinaryMode 切换到二进制模式 (TYPE I)
+func (ftp *FTPConn) SetBinaryMode() error {
+	if err := ftp.setType("I"); err != nil {
+		return fmt.Errorf("设置二进制模式失败: %v", err)
+	}
+	return nil
+}
+
+// SetAsciiMode 切换到 ASCII 模式 (TYPE A)
+func (ftp *FTPConn) SetAsciiMode() error {
+	if err := ftp.setType("A"); err != nil {
+		return fmt.Errorf("设置ASCII模式失败: %v", err)
+	}
+	return nil
+}
+
+// TransferTypes 返回可选的传输类型
+func (a *App) TransferTypes() []TransferType {
+	return []TransferType{TransferAuto, TransferASCII, TransferBinary}
+}
+
+// SetDefaultTransferType 设置之后新建任务的传输类型 (auto/ascii/binary)
+func (a *App) SetDefaultTransferType(t string) error {
+	typ, err := ParseTransferType(t)
+	if err != nil {
+		return err
+	}
+	setDefaultTransferType(typ)
+	MyLogger.Info("default transfer type", "type", typ)
+	return nil
+}
+
+// typeOrDefault 解析单次传输指定的传输类型，空字符串表示使用默认类型
+func typeOrDefault(s string) (TransferType, error) {
+	if strings.TrimSpace(s) == "" {
+		transfers.mu.Lock()
+		defer transfers.mu.Unlock()
+		return transfers.defaultType, nil
+	}
+	return ParseTransferType(s)
+}
+
+// setDefaultTransferType 设置之后新建任务的传输类型
+func setDefaultTransferType(t TransferType) {
+	transfers.mu.Lock()
+	transfers.defaultType = t
+	transfers.mu.Unlock()
+}
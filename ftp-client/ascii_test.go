@@ -0,0 +1,149 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestTransferType(t *testing.T) {
+	srv := newTestServer(t)
+	client := dialTestServer(t, srv)
+	dir := t.TempDir()
+
+	job := NewTransferJob("upload", "notes", nil)
+	job.Type = TransferAuto
+	defer job.Finish(nil)
+
+	// 文本文件按 ASCII 上传，服务器把网络上的 CRLF 保存为 LF
+	text := filepath.Join(dir, "notes.txt")
+	os.WriteFile(text, []byte("a\nb\r\nc\n"), 0644)
+	if err := client.RunJob(job, func() error { return UploadFile(context.Background(), client, text, "/notes.txt") }); err != nil {
+		t.Fatal(err)
+	}
+	if data, _ := srv.ReadFile("/notes.txt"); string(data) != "a\nb\nc\n" {
+		t.Fatalf("uploaded %q", data)
+	}
+
+	// 其他文件按二进制原样上传
+	bin := filepath.Join(dir, "data.bin")
+	os.WriteFile(bin, []byte("a\nb\r\n"), 0644)
+	if err := client.RunJob(job, func() error { return UploadFile(context.Background(), client, bin, "/data.bin") }); err != nil {
+		t.Fatal(err)
+	}
+	if data, _ := srv.ReadFile("/data.bin"); string(data) != "a\nb\r\n" {
+		t.Fatalf("uploaded %q", data)
+	}
+
+	// 下载时服务器发送 CRLF，客户端转换为 LF，单独的 CR 保留
+	srv.WriteFile("/crlf.txt", []byte("x\ny\rz\n"))
+	local := filepath.Join(dir, "crlf.txt")
+	err := client.RunJob(job, func() error {
+		return DownloadFile(context.Background(), client, "/crlf.txt", local, 0, -1)
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if data, _ := os.ReadFile(local); !localCRLF && string(data) != "x\ny\rz\n" {
+		t.Fatalf("downloaded %q", data)
+	}
+
+	// 类型相同时不重复发送 TYPE
+	var types []string
+	for _, cmd := range srv.Received() {
+		if strings.HasPrefix(cmd, "TYPE ") {
+			types = append(types, cmd)
+		}
+	}
+	if strings.Join(types, ",") != "TYPE A,TYPE I,TYPE A" {
+		t.Fatalf("TYPE commands = %v", types)
+	}
+
+	if _, err := ParseTransferType("ebcdic"); err == nil {
+		t.Fatal("unknown transfer type accepted")
+	}
+}
+
+func TestASCIIWriter(t *testing.T) {
+	// 上传时发送到网络上的内容：LF 转换为 CRLF，已有的 CRLF 不变，CR 和 LF 可能分在两次写入中
+	var wire bytes.Buffer
+	w := newASCIIWriter(&wire)
+	for _, chunk := range []string{"a\nb\r", "\nc\n", "\n"} {
+		w.Write([]byte(chunk))
+	}
+	if wire.String() != "a\r\nb\r\nc\r\n\r\n" {
+		t.Fatalf("wrote %q", wire.String())
+	}
+}
+
+func TestRawTypeCommand(t *testing.T) {
+	srv := newTestServer(t)
+	srv.WriteFile("/image.bin", []byte("a\r\nb"))
+	client := dialTestServer(t, srv)
+	local := filepath.Join(t.TempDir(), "image.bin")
+
+	// quote TYPE A 之后的二进制下载仍然先切换回 TYPE I
+	var out bytes.Buffer
+	sh := NewShell(client, &out, false)
+	if err := sh.Exec("binary"); err != nil {
+		t.Fatal(err)
+	}
+	for _, line := range []string{"get /image.bin " + local, "quote TYPE A", "conflict overwrite", "get /image.bin " + local} {
+		if err := sh.Exec(line); err != nil {
+			t.Fatalf("%s: %v", line, err)
+		}
+	}
+	if data, _ := os.ReadFile(local); string(data) != "a\r\nb" {
+		t.Fatalf("downloaded %q", data)
+	}
+	var seq []string
+	for _, cmd := range srv.Received() {
+		if strings.HasPrefix(cmd, "TYPE ") || strings.HasPrefix(cmd, "RETR ") {
+			seq = append(seq, cmd)
+		}
+	}
+	if want := "TYPE I,RETR /image.bin,TYPE A,TYPE I,RETR /image.bin"; strings.Join(seq, ",") != want {
+		t.Fatalf("commands = %v, want %s", seq, want)
+	}
+}
+
+func TestTransferTypeArgument(t *testing.T) {
+	srv := newTestServer(t)
+	app := NewApp()
+	id, err := app.Connect(srv.Addr, "rw", "123")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer app.Disconnect(id)
+	dir := t.TempDir()
+
+	// 默认类型是二进制，单次传输指定的类型优先
+	local := filepath.Join(dir, "data.bin")
+	os.WriteFile(local, []byte("a\nb\n"), 0644)
+	if err := app.Upload(id, local, "/data.bin", "", "ascii"); err != nil {
+		t.Fatal(err)
+	}
+	if data, _ := srv.ReadFile("/data.bin"); string(data) != "a\nb\n" {
+		t.Fatalf("ascii upload wrote %q", data)
+	}
+	// 按 ASCII 下载回来与本地文件相同
+	back := filepath.Join(dir, "back.bin")
+	if err := app.Download(id, "/data.bin", back, -1, "", "ascii"); err != nil {
+		t.Fatal(err)
+	}
+	if data, _ := os.ReadFile(back); !localCRLF && string(data) != "a\nb\n" {
+		t.Fatalf("ascii download wrote %q", data)
+	}
+	if err := app.Upload(id, local, "/copy.bin", "", ""); err != nil {
+		t.Fatal(err)
+	}
+	if data, _ := srv.ReadFile("/copy.bin"); string(data) != "a\nb\n" {
+		t.Fatalf("default upload wrote %q", data)
+	}
+	if err := app.Download(id, "/data.bin", filepath.Join(dir, "x"), -1, "", "ebcdic"); err == nil {
+		t.Fatal("unknown transfer type accepted")
+	}
+}
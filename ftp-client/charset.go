@@ -0,0 +1,165 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+
+	"golang.org/x/text/encoding"
+	"golang.org/x/text/encoding/charmap"
+	"golang.org/x/text/encoding/japanese"
+	"golang.org/x/text/encoding/simplifiedchinese"
+	"golang.org/x/text/encoding/traditionalchinese"
+)
+
+// 支持的字符集名称，用于 Profile.Charset 和命令行的 -charset
+const (
+	CharsetUTF8     = "utf-8"
+	CharsetGBK      = "gbk"
+	CharsetGB18030  = "gb18030"
+	CharsetBig5     = "big5"
+	CharsetShiftJIS = "shift_jis"
+	CharsetLatin1   = "latin-1"
+)
+
+// CharsetNames 支持的字符集，按前端显示的顺序
+var CharsetNames = []string{CharsetUTF8, CharsetGBK, CharsetGB18030, CharsetBig5, CharsetShiftJIS, CharsetLatin1}
+
+var charsetEncodings = map[string]encoding.Encoding{
+	CharsetUTF8:     nil,
+	CharsetGBK:      simplifiedchinese.GBK,
+	CharsetGB18030:  simplifiedchinese.GB18030,
+	CharsetBig5:     traditionalchinese.Big5,
+	CharsetShiftJIS: japanese.ShiftJIS,
+	CharsetLatin1:   charmap.ISO8859_1,
+}
+
+// charsetAliases 其他常见的写法
+var charsetAliases = map[string]string{
+	"utf8":       CharsetUTF8,
+	"cp936":      CharsetGBK,
+	"big-5":      CharsetBig5,
+	"cp950":      CharsetBig5,
+	"sjis":       CharsetShiftJIS,
+	"shift-jis":  CharsetShiftJIS,
+	"cp932":      CharsetShiftJIS,
+	"latin1":     CharsetLatin1,
+	"iso-8859-1": CharsetLatin1,
+}
+
+// lookupCharset 按名称查找字符集，不区分大小写；空字符串表示 UTF-8，此时返回 nil
+func lookupCharset(name string) (string, encoding.Encoding, error) {
+	name = strings.ToLower(strings.TrimSpace(name))
+	if name == "" {
+		return CharsetUTF8, nil, nil
+	}
+	if alias, ok := charsetAliases[name]; ok {
+		name = alias
+	}
+	enc, ok := charsetEncodings[name]
+	if !ok {
+		return "", nil, fmt.Errorf("不支持的字符集: %s (可用: %s)", name, strings.Join(CharsetNames, ", "))
+	}
+	return name, enc, nil
+}
+
+// SetCharset 设置服务器不支持 UTF8 时命令、响应和目录列表使用的字符集，在 Dial 之前调用。
+// 登录时如果服务器在 FEAT 中声明了 UTF8，会发送 OPTS UTF8 ON 并改用 UTF-8
+func (ftp *FTPConn) SetCharset(name string) error {
+	name, enc, err := lookupCharset(name)
+	if err != nil {
+		return err
+	}
+	ftp.charsetName = name
+	ftp.charset = enc
+	return nil
+}
+
+// Charset 返回当前实际使用的字符集名称
+func (ftp *FTPConn) Charset() string {
+	if ftp.utf8 || ftp.charset == nil {
+		return CharsetUTF8
+	}
+	return ftp.charsetName
+}
+
+// activeEncoding 返回当前使用的编码，UTF-8 时为 nil
+func (ftp *FTPConn) activeEncoding() encoding.Encoding {
+	if ftp.utf8 {
+		return nil
+	}
+	return ftp.charset
+}
+
+// encode 把命令转换为服务器的字符集。无法表示的字符返回错误，不做替换，避免操作到别的文件
+func (ftp *FTPConn) encode(s string) ([]byte, error) {
+	enc := ftp.activeEncoding()
+	if enc == nil {
+		return []byte(s), nil
+	}
+	b, err := enc.NewEncoder().Bytes([]byte(s))
+	if err != nil {
+		return nil, fmt.Errorf("命令中有 %s 无法表示的字符", ftp.charsetName)
+	}
+	return b, nil
+}
+
+// decode 把服务器发来的文本转换为 UTF-8，无效的字节替换为 U+FFFD
+func (ftp *FTPConn) decode(s string) string {
+	enc := ftp.activeEncoding()
+	if enc == nil {
+		return s
+	}
+	out, err := enc.NewDecoder().String(s)
+	if err != nil {
+		return s
+	}
+	return out
+}
+
+// negotiateUTF8 服务器在 FEAT 中声明 UTF8 时发送 OPTS UTF8 ON，成功后改用 UTF-8，
+// 否则继续使用配置的字符集
+func (ftp *FTPConn) negotiateUTF8() {
+	if !ftp.HasFeature("UTF8") {
+		return
+	}
+	reply, err := ftp.Command("OPTS UTF8 ON")
+	if err != nil {
+		return
+	}
+	// 有的服务器默认就是 UTF-8，对 OPTS UTF8 ON 回复 202 (命令无需执行)
+	if reply.Code >= 200 && reply.Code < 300 {
+		ftp.utf8 = true
+	}
+	MyLogger.Info("charset", "charset", ftp.Charset(), "reply", reply.Code)
+}
+
+// Features 返回 FEAT 列出的扩展命令，键为大写的命令名，值为参数 (如 MLST 的事实列表)。
+// 结果在连接期间缓存，服务器不支持 FEAT 时为空
+func (ftp *FTPConn) Features() map[string]string {
+	if ftp.features != nil {
+		return ftp.features
+	}
+	ftp.features = map[string]string{}
+	reply, err := ftp.Command("FEAT")
+	if err != nil || reply.Code != 211 || len(reply.Lines) < 2 {
+		return ftp.features
+	}
+	for _, line := range reply.Lines[1 : len(reply.Lines)-1] {
+		name, param, _ := strings.Cut(strings.TrimSpace(line), " ")
+		if name != "" {
+			ftp.features[strings.ToUpper(name)] = param
+		}
+	}
+	return ftp.features
+}
+
+// HasFeature 判断服务器是否在 FEAT 中声明了 name
+func (ftp *FTPConn) HasFeature(name string) bool {
+	_, ok := ftp.Features()[strings.ToUpper(name)]
+	return ok
+}
+
+// Charsets 返回支持的字符集，供连接配置选择
+func (a *App) Charsets() []string {
+	return CharsetNames
+}
@@ -0,0 +1,74 @@
+package main
+
+import (
+	"testing"
+
+	"golang.org/x/text/encoding/simplifiedchinese"
+)
+
+func TestCharset(t *testing.T) {
+	gbk := func(s string) string {
+		out, err := simplifiedchinese.GBK.NewEncoder().String(s)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return out
+	}
+
+	// 服务器没有声明 UTF8，按配置的 GBK 转换文件名
+	srv := newTestServer(t)
+	srv.Features = []string{"SIZE"}
+	srv.WriteFile("/"+gbk("报告.txt"), []byte("data"))
+	client := NewFTPClient()
+	if err := client.SetCharset("GBK"); err != nil {
+		t.Fatal(err)
+	}
+	if err := client.Dial(srv.Addr); err != nil {
+		t.Fatal(err)
+	}
+	if err := client.Login("rw", "123"); err != nil {
+		t.Fatal(err)
+	}
+	defer client.Close()
+	if client.Charset() != CharsetGBK {
+		t.Fatalf("charset = %s", client.Charset())
+	}
+	entries, err := client.List("/")
+	if err != nil || len(entries) != 1 || entries[0].Name != "报告.txt" {
+		t.Fatalf("List = %+v, %v", entries, err)
+	}
+	if err := client.MakeDir("/新建文件夹"); err != nil {
+		t.Fatal(err)
+	}
+	if !srv.Exists("/" + gbk("新建文件夹")) {
+		t.Fatal("directory name was not sent in GBK")
+	}
+	if err := client.MakeDir("/😀"); err == nil {
+		t.Fatal("a name that GBK cannot represent was sent")
+	}
+
+	// 服务器声明 UTF8 时发送 OPTS UTF8 ON 并改用 UTF-8
+	utf8Srv := newTestServer(t)
+	other := NewFTPClient()
+	other.SetCharset("gbk")
+	if err := other.Dial(utf8Srv.Addr); err != nil {
+		t.Fatal(err)
+	}
+	if err := other.Login("rw", "123"); err != nil {
+		t.Fatal(err)
+	}
+	defer other.Close()
+	if other.Charset() != CharsetUTF8 {
+		t.Fatalf("charset = %s, want utf-8", other.Charset())
+	}
+	found := false
+	for _, cmd := range utf8Srv.Received() {
+		found = found || cmd == "OPTS UTF8 ON"
+	}
+	if !found {
+		t.Fatalf("OPTS UTF8 ON was not sent: %v", utf8Srv.Received())
+	}
+	if err := other.SetCharset("ebcdic"); err == nil {
+		t.Fatal("unknown charset accepted")
+	}
+}
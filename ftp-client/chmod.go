@@ -0,0 +1,312 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path"
+	"strconv"
+	"strings"
+)
+
+// ErrChmodUnsupported 服务器不支持 SITE CHMOD
+var ErrChmodUnsupported = errors.New("服务器不支持 SITE CHMOD")
+
+// SITE CHMOD 的支持情况，第一次使用或检测后记录在 FTPConn 上
+const (
+	chmodUnknown = iota
+	chmodSupported
+	chmodUnsupported
+)
+
+// PermBits 一类用户的读、写、执行权限
+type PermBits struct {
+	Read  bool `json:"read"`
+	Write bool `json:"write"`
+	Exec  bool `json:"exec"`
+}
+
+// Permissions 从 LIST 权限字符串或文件信息解析出的权限位
+type Permissions struct {
+	Owner  PermBits `json:"owner"`
+	Group  PermBits `json:"group"`
+	Other  PermBits `json:"other"`
+	Setuid bool     `json:"setuid"`
+	Setgid bool     `json:"setgid"`
+	Sticky bool     `json:"sticky"`
+	Octal  string   `json:"octal"` // 例如 0755，可以直接用于 SITE CHMOD
+}
+
+// ParsePermissions 解析 ls -l 形式的权限字符串，例如 drwxr-sr-x 或 -rw-r--r--+
+func ParsePermissions(mode string) (Permissions, error) {
+	if len(mode) < 10 {
+		return Permissions{}, fmt.Errorf("无效的权限字符串: %s", mode)
+	}
+	var p Permissions
+	var special [3]bool
+	for i, bits := range []*PermBits{&p.Owner, &p.Group, &p.Other} {
+		rwx := mode[1+3*i : 4+3*i]
+		if (rwx[0] != 'r' && rwx[0] != '-') || (rwx[1] != 'w' && rwx[1] != '-') {
+			return Permissions{}, fmt.Errorf("无效的权限字符串: %s", mode)
+		}
+		bits.Read = rwx[0] == 'r'
+		bits.Write = rwx[1] == 'w'
+		// 第三位的 s/t 表示同时有执行权限，S/T 表示没有
+		switch rwx[2] {
+		case 'x':
+			bits.Exec = true
+		case 's', 't':
+			bits.Exec = true
+			special[i] = true
+		case 'S', 'T':
+			special[i] = true
+		case '-':
+		default:
+			return Permissions{}, fmt.Errorf("无效的权限字符串: %s", mode)
+		}
+	}
+	p.Setuid, p.Setgid, p.Sticky = special[0], special[1], special[2]
+	p.Octal = fmt.Sprintf("%04o", unixMode(p.FileMode()))
+	return p, nil
+}
+
+// permissionsFromMode 由 os.FileMode (SFTP 或本地文件) 得到权限位
+func permissionsFromMode(mode os.FileMode) Permissions {
+	p, _ := ParsePermissions(lsMode(mode))
+	return p
+}
+
+// FileMode 返回对应的 os.FileMode，只包含权限和 setuid/setgid/sticky 位
+func (p Permissions) FileMode() os.FileMode {
+	var mode os.FileMode
+	for i, bits := range []PermBits{p.Owner, p.Group, p.Other} {
+		shift := uint(6 - 3*i)
+		if bits.Read {
+			mode |= 4 << shift
+		}
+		if bits.Write {
+			mode |= 2 << shift
+		}
+		if bits.Exec {
+			mode |= 1 << shift
+		}
+	}
+	if p.Setuid {
+		mode |= os.ModeSetuid
+	}
+	if p.Setgid {
+		mode |= os.ModeSetgid
+	}
+	if p.Sticky {
+		mode |= os.ModeSticky
+	}
+	return mode
+}
+
+// unixMode 把 os.FileMode 转换为 chmod 使用的数值，例如 04755
+func unixMode(mode os.FileMode) uint32 {
+	m := uint32(mode.Perm())
+	if mode&os.ModeSetuid != 0 {
+		m |= 04000
+	}
+	if mode&os.ModeSetgid != 0 {
+		m |= 02000
+	}
+	if mode&os.ModeSticky != 0 {
+		m |= 01000
+	}
+	return m
+}
+
+// ParseMode 解析八进制权限，例如 755 或 0644
+func ParseMode(s string) (os.FileMode, error) {
+	n, err := strconv.ParseUint(s, 8, 32)
+	if err != nil || n > 07777 {
+		return 0, fmt.Errorf("无效的权限: %s", s)
+	}
+	mode := os.FileMode(n & 0777)
+	if n&04000 != 0 {
+		mode |= os.ModeSetuid
+	}
+	if n&02000 != 0 {
+		mode |= os.ModeSetgid
+	}
+	if n&01000 != 0 {
+		mode |= os.ModeSticky
+	}
+	return mode, nil
+}
+
+// Chmod 使用 SITE CHMOD 修改权限。服务器回复命令未实现 (500/502/504) 时
+// 返回 ErrChmodUnsupported，并记录下来供 CanChmod 使用
+func (ftp *FTPConn) Chmod(p string, mode os.FileMode) error {
+	if ftp.siteChmod == chmodUnsupported {
+		return ErrChmodUnsupported
+	}
+	reply, err := ftp.Command(fmt.Sprintf("SITE CHMOD %o %s", unixMode(mode), p))
+	if err != nil {
+		return fmt.Errorf("发送SITE CHMOD命令失败: %v", err)
+	}
+	switch {
+	case reply.Code >= 200 && reply.Code < 300:
+		ftp.siteChmod = chmodSupported
+		return nil
+	case reply.Code == 500 || reply.Code == 502 || reply.Code == 504:
+		ftp.siteChmod = chmodUnsupported
+		return fmt.Errorf("%w: %d %s", ErrChmodUnsupported, reply.Code, reply.Message)
+	}
+	return fmt.Errorf("修改权限失败: %d %s", reply.Code, reply.Message)
+}
+
+// CanChmod 判断服务器是否支持 SITE CHMOD。没有用过时通过 SITE HELP 检测，
+// 服务器不提供 SITE HELP 时假定支持，由第一次 Chmod 的结果确定
+func (ftp *FTPConn) CanChmod() bool {
+	if ftp.siteChmod != chmodUnknown {
+		return ftp.siteChmod == chmodSupported
+	}
+	reply, err := ftp.Command("SITE HELP")
+	if err != nil || reply.Code < 200 || reply.Code >= 300 {
+		return true
+	}
+	if strings.Contains(strings.ToUpper(strings.Join(reply.Lines, "\n")), "CHMOD") {
+		ftp.siteChmod = chmodSupported
+	} else {
+		ftp.siteChmod = chmodUnsupported
+	}
+	return ftp.siteChmod == chmodSupported
+}
+
+// canChmod 判断远程文件系统能否修改权限，SFTP 总是可以
+func canChmod(rfs RemoteFS) bool {
+	if c, ok := rfs.(interface{ CanChmod() bool }); ok {
+		return c.CanChmod()
+	}
+	return true
+}
+
+// ChmodStats 递归修改权限的统计
+type ChmodStats struct {
+	Files  int `json:"files"`
+	Dirs   int `json:"dirs"`
+	Failed int `json:"failed"`
+}
+
+// ChmodAll 递归修改 root 下所有文件和目录的权限，fileMode/dirMode 为 nil 时不修改对应类型；
+// 符号链接被跳过。单个文件失败时继续处理其余文件，服务器不支持 SITE CHMOD 时立即停止
+func ChmodAll(rfs RemoteFS, root string, fileMode, dirMode *os.FileMode) (ChmodStats, error) {
+	var stats ChmodStats
+	var firstErr error
+	apply := func(p string, mode *os.FileMode, count *int) error {
+		if mode == nil {
+			return nil
+		}
+		if err := rfs.Chmod(p, *mode); err != nil {
+			if errors.Is(err, ErrChmodUnsupported) {
+				return err
+			}
+			MyLogger.Info("chmod failed", "path", p, "error", err)
+			stats.Failed++
+			if firstErr == nil {
+				firstErr = fmt.Errorf("%s: %v", p, err)
+			}
+			return nil
+		}
+		*count++
+		return nil
+	}
+
+	var walk func(dir string) error
+	walk = func(dir string) error {
+		entries, err := rfs.List(dir)
+		if err != nil {
+			return err
+		}
+		for _, e := range entries {
+			if e.Name == "." || e.Name == ".." {
+				continue
+			}
+			p := path.Join(dir, e.Name)
+			switch e.Type {
+			case EntryDir:
+				if err := walk(p); err != nil {
+					return err
+				}
+			case EntryFile:
+				if err := apply(p, fileMode, &stats.Files); err != nil {
+					return err
+				}
+			}
+		}
+		// 目录最后修改，新权限去掉读或执行权限时也能先处理完其中的内容
+		return apply(dir, dirMode, &stats.Dirs)
+	}
+
+	e, err := rfs.Stat(root)
+	if err != nil {
+		return stats, err
+	}
+	switch e.Type {
+	case EntryDir:
+		err = walk(root)
+	case EntryFile:
+		err = apply(root, fileMode, &stats.Files)
+	}
+	if err != nil {
+		return stats, err
+	}
+	if firstErr != nil {
+		return stats, fmt.Errorf("%d 个文件修改权限失败，第一个错误: %v", stats.Failed, firstErr)
+	}
+	return stats, nil
+}
+
+// CanChmod 返回会话能否修改权限，前端据此显示或隐藏权限编辑
+func (a *App) CanChmod(sessionID string) bool {
+	can := false
+	withSession(sessionID, func(s *Session) error {
+		can = canChmod(s.fs)
+		return nil
+	})
+	return can
+}
+
+// Chmod 修改远程文件或目录的权限，mode 为八进制字符串，例如 "755"
+func (a *App) Chmod(sessionID, remotePath, mode string) error {
+	m, err := ParseMode(mode)
+	if err != nil {
+		return err
+	}
+	err = withSession(sessionID, func(s *Session) error {
+		return s.fs.Chmod(remotePath, m)
+	})
+	if err != nil {
+		MyLogger.Info("failed to chmod: ", err)
+		return fmt.Errorf("failed to change permissions: %v", err)
+	}
+	return nil
+}
+
+// ChmodRecursive 递归修改权限，文件和目录分别使用 fileMode 和 dirMode，为空时不修改
+func (a *App) ChmodRecursive(sessionID, remotePath, fileMode, dirMode string) (ChmodStats, error) {
+	var modes [2]*os.FileMode
+	for i, s := range []string{fileMode, dirMode} {
+		if s == "" {
+			continue
+		}
+		m, err := ParseMode(s)
+		if err != nil {
+			return ChmodStats{}, err
+		}
+		modes[i] = &m
+	}
+	var stats ChmodStats
+	err := withSession(sessionID, func(s *Session) (err error) {
+		stats, err = ChmodAll(s.fs, remotePath, modes[0], modes[1])
+		return err
+	})
+	MyLogger.Info("chmod -R", "path", remotePath, "files", stats.Files, "dirs", stats.Dirs, "failed", stats.Failed)
+	if err != nil {
+		return stats, fmt.Errorf("failed to change permissions: %v", err)
+	}
+	return stats, nil
+}
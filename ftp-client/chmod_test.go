@@ -0,0 +1,40 @@
+package main
+
+import (
+	"errors"
+	"os"
+	"testing"
+
+	"changeme/internal/ftptest"
+)
+
+func TestChmod(t *testing.T) {
+	srv := newTestServer(t)
+	srv.WriteFile("/site/index.html", []byte("<html>"))
+	srv.WriteFile("/site/css/app.css", []byte("body{}"))
+	client := dialTestServer(t, srv)
+
+	if !client.CanChmod() {
+		t.Fatal("server advertises SITE CHMOD")
+	}
+	fileMode, dirMode := os.FileMode(0600), os.FileMode(0711)
+	stats, err := ChmodAll(client, "/site", &fileMode, &dirMode)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stats.Files != 2 || stats.Dirs != 2 {
+		t.Fatalf("unexpected stats: %+v", stats)
+	}
+	if srv.Mode("/site/css/app.css").Perm() != 0600 || srv.Mode("/site/css").Perm() != 0711 {
+		t.Fatal("modes were not applied")
+	}
+
+	srv.Handle(ftptest.Rule{Command: "SITE", Reply: "502 SITE not implemented"})
+	other := dialTestServer(t, srv)
+	if err := other.Chmod("/site/index.html", 0644); !errors.Is(err, ErrChmodUnsupported) {
+		t.Fatalf("expected ErrChmodUnsupported, got %v", err)
+	}
+	if other.CanChmod() {
+		t.Fatal("CanChmod should report the unsupported command")
+	}
+}
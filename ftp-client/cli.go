@@ -0,0 +1,377 @@
+package main
+
+import (
+	"crypto/tls"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"strings"
+)
+
+// 命令行模式的退出码，按失败类型区分，便于 CI 脚本判断
+const (
+	ExitOK      = 0
+	ExitFailure = 1 // 其他错误
+	ExitUsage   = 2 // 参数错误
+	ExitConnect = 3 // 无法连接服务器或TLS失败
+	ExitAuth    = 4 // 登录失败
+	ExitRemote  = 5 // 服务器拒绝操作
+	ExitLocal   = 6 // 本地文件读写失败
+)
+
+// cliError 带退出码的错误
+type cliError struct {
+	code int
+	err  error
+}
+
+func (e *cliError) Error() string { return e.err.Error() }
+func (e *cliError) Unwrap() error { return e.err }
+
+func usageError(err error) error {
+	return &cliError{code: ExitUsage, err: err}
+}
+
+// exitCodeFor 根据错误类型选择退出码
+func exitCodeFor(err error) int {
+	if err == nil {
+		return ExitOK
+	}
+	var ce *cliError
+	if errors.As(err, &ce) {
+		return ce.code
+	}
+	var pathErr *fs.PathError
+	if errors.As(err, &pathErr) {
+		return ExitLocal
+	}
+	return ExitRemote
+}
+
+// 命令行子命令及其中 URL 参数的位置
+var cliCommands = map[string]struct {
+	usage  string
+	urlArg int
+	nargs  [2]int // 最少/最多位置参数
+}{
+	"get":    {"get [flags] <url> [local]", 0, [2]int{1, 2}},
+	"put":    {"put [flags] <local> <url>", 1, [2]int{2, 2}},
+	"ls":     {"ls [flags] <url>", 0, [2]int{1, 1}},
+	"mkdir":  {"mkdir [flags] <url>", 0, [2]int{1, 1}},
+	"rm":     {"rm [flags] [-r] <url>", 0, [2]int{1, 1}},
+	"mv":     {"mv [flags] <url> <new-path>", 0, [2]int{2, 2}},
+	"chmod":  {"chmod [flags] [-r] <mode>|<file-mode>:<dir-mode> <url>", 1, [2]int{2, 2}},
+	"mirror": {"mirror [flags] <url> <local-dir> | mirror -R [flags] <local-dir> <url>", 0, [2]int{2, 2}},
+	"shell":  {"shell [flags] <url>", 0, [2]int{1, 1}},
+	"run":    {"run [flags] <script|-> [url]", 1, [2]int{1, 2}},
+	"fxp":    {"fxp [flags] <source-url> <target-url>", 0, [2]int{2, 2}},
+}
+
+// isCLICommand 判断启动参数是否为命令行子命令，否则启动图形界面
+func isCLICommand(name string) bool {
+	_, ok := cliCommands[name]
+	return ok || name == "help" || name == "-h" || name == "--help"
+}
+
+func cliUsage(w io.Writer) {
+	fmt.Fprintln(w, "usage: ftp-client <command> [flags] <args>")
+	fmt.Fprintln(w, "")
+	for _, name := range []string{"get", "put", "ls", "mkdir", "rm", "mv", "chmod", "mirror", "fxp", "shell", "run"} {
+		fmt.Fprintln(w, "  ftp-client "+cliCommands[name].usage)
+	}
+	fmt.Fprintln(w, "")
+	fmt.Fprintln(w, "url: ftp://[user[:password]@]host[:port]/path  (ftps:// uses AUTH TLS)")
+	fmt.Fprintln(w, "     without a password, FTP_USER/FTP_PASSWORD and ~/.netrc ($NETRC) are used")
+	fmt.Fprintln(w, "flags: --json  --insecure  --verbose  --limit-rate 512K  --proxy socks5://[user:pass@]host:port")
+	fmt.Fprintln(w, "       --conflict overwrite|skip|resume|rename|newer|size-differs")
+	fmt.Fprintln(w, "       (run: --dry-run  --continue)")
+	fmt.Fprintln(w, "exit codes: 0 ok, 1 failure, 2 usage, 3 connect, 4 login, 5 remote, 6 local")
+}
+
+// runCLI 执行一条命令行子命令并返回退出码
+func runCLI(args []string) int {
+	name := args[0]
+	spec, ok := cliCommands[name]
+	if !ok {
+		cliUsage(os.Stdout)
+		return ExitOK
+	}
+
+	flags := flag.NewFlagSet(name, flag.ContinueOnError)
+	flags.SetOutput(os.Stderr)
+	jsonOutput := flags.Bool("json", false, "print results as JSON lines")
+	insecure := flags.Bool("insecure", false, "skip TLS certificate verification for ftps://")
+	verbose := flags.Bool("verbose", false, "also write the log to stderr")
+	recursive := flags.Bool("r", false, "rm, chmod: recurse into directories")
+	reverse := flags.Bool("R", false, "mirror: upload <local-dir> to <url> instead")
+	dryRun := flags.Bool("dry-run", false, "run: print the expanded commands without executing them")
+	continueOnError := flags.Bool("continue", false, "run: keep going after a failed command")
+	limitRate := flags.String("limit-rate", "", "cap the transfer speed, e.g. 512K or 2M (bytes per second)")
+	proxyURL := flags.String("proxy", "", "connect through a proxy: socks5://[user:pass@]host:port or http://host:port")
+	transferType := flags.String("type", "", "transfer type: auto (ASCII for text extensions), ascii or binary (default)")
+	conflict := flags.String("conflict", "overwrite", "get, put: when the target exists: overwrite, skip, resume, rename, newer or size-differs")
+	charset := flags.String("charset", "", "file name encoding for servers without UTF8: "+strings.Join(CharsetNames, ", "))
+	flags.Usage = func() {
+		fmt.Fprintln(os.Stderr, "usage: ftp-client "+spec.usage)
+		flags.PrintDefaults()
+	}
+	if err := flags.Parse(args[1:]); err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			return ExitOK
+		}
+		return ExitUsage
+	}
+
+	// 日志只写文件，避免混入标准输出
+	var console io.Writer
+	if *verbose {
+		console = os.Stderr
+	}
+	logger, err := NewMySlogWriter("info", "log.log", console)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "error:", err)
+		return ExitLocal
+	}
+	defer logger.Close()
+	MyLogger = logger
+
+	if *limitRate != "" {
+		rate, err := ParseByteRate(*limitRate)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, "error:", err)
+			return ExitUsage
+		}
+		GlobalLimiter.SetRate(rate)
+	}
+	typ, err := ParseTransferType(*transferType)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "error:", err)
+		return ExitUsage
+	}
+	setDefaultTransferType(typ)
+	policy, err := ParseConflictPolicy(*conflict)
+	if err == nil && policy == ConflictAsk {
+		err = fmt.Errorf("--conflict ask is only available in the GUI")
+	}
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "error:", err)
+		return ExitUsage
+	}
+	setDefaultConflictPolicy(policy)
+	if _, _, err := lookupCharset(*charset); err != nil {
+		fmt.Fprintln(os.Stderr, "error:", err)
+		return ExitUsage
+	}
+	var proxy ProxyConfig
+	if *proxyURL != "" {
+		var err error
+		if proxy, err = ParseProxyURL(*proxyURL); err != nil {
+			fmt.Fprintln(os.Stderr, "error:", err)
+			return ExitUsage
+		}
+	}
+
+	positional := flags.Args()
+	if len(positional) < spec.nargs[0] || len(positional) > spec.nargs[1] {
+		flags.Usage()
+		return ExitUsage
+	}
+	shell := NewShell(nil, os.Stdout, *jsonOutput)
+	if !*jsonOutput && isTerminal(os.Stderr) {
+		shell.progress = newProgressBar(os.Stderr)
+	}
+	fail := func(err error) int {
+		shell.reportError(err)
+		return exitCodeFor(err)
+	}
+
+	if name == "run" {
+		opts := ScriptOptions{DryRun: *dryRun, OnError: OnErrorStop, Insecure: *insecure, Proxy: proxy, Charset: *charset}
+		if *continueOnError {
+			opts.OnError = OnErrorContinue
+		}
+		return runScriptCLI(positional, opts, fail)
+	}
+
+	if name == "fxp" {
+		return runFXPCLI(positional, *insecure, proxy, *charset, shell, fail)
+	}
+
+	urlArg := spec.urlArg
+	if name == "mirror" && *reverse {
+		urlArg = 1
+	}
+	target, err := ParseFTPURL(positional[urlArg])
+	if err != nil {
+		return fail(usageError(err))
+	}
+
+	client, err := dialURL(target, *insecure, proxy, *charset)
+	if err != nil {
+		return fail(err)
+	}
+	defer client.Quit()
+	shell.client = client
+
+	// 把子命令转换为 Shell 命令，URL 参数替换为其中的路径
+	var command []string
+	switch name {
+	case "get":
+		command = append([]string{"get", target.Path}, positional[1:]...)
+	case "put":
+		command = []string{"put", positional[0], target.Path}
+	case "ls", "mkdir":
+		command = []string{name, target.Path}
+	case "rm":
+		command = []string{"rm", target.Path}
+		if *recursive {
+			command = []string{"rm", "-r", target.Path}
+		}
+	case "mv":
+		command = []string{"mv", target.Path, positional[1]}
+	case "chmod":
+		command = []string{"chmod", positional[0], target.Path}
+		if *recursive {
+			command = []string{"chmod", "-R", positional[0], target.Path}
+		}
+	case "mirror":
+		command = []string{"mirror", target.Path, positional[1]}
+		if *reverse {
+			command = []string{"mirror", "-R", positional[0], target.Path}
+		}
+	case "shell":
+		if target.Path != "/" {
+			if err := client.ChangeDir(target.Path); err != nil {
+				return fail(err)
+			}
+		}
+		var prompt io.Writer
+		if isTerminal(os.Stdin) {
+			prompt = os.Stderr
+		}
+		if err := shell.REPL(os.Stdin, prompt); err != nil {
+			return fail(&cliError{code: ExitFailure, err: fmt.Errorf("读取命令失败: %w", err)})
+		}
+		return ExitOK
+	}
+
+	if err := shell.Run(command); err != nil {
+		return fail(err)
+	}
+	return ExitOK
+}
+
+// dialURL 连接并登录 URL 指定的服务器；URL 中没有密码时从环境变量和 netrc 查找，
+// 仍没有用户名时使用匿名登录
+func dialURL(target *FTPURL, insecure bool, proxy ProxyConfig, charset string) (*FTPClient, error) {
+	dialer, err := proxy.Dialer()
+	if err != nil {
+		return nil, usageError(err)
+	}
+	client := NewFTPClient()
+	if err := client.SetCharset(charset); err != nil {
+		return nil, usageError(err)
+	}
+	client.SetDialer(dialer)
+	if err := client.Dial(target.Host); err != nil {
+		return nil, &cliError{code: ExitConnect, err: err}
+	}
+	if target.TLS() {
+		config := &tls.Config{ServerName: target.Hostname(), InsecureSkipVerify: insecure}
+		if err := client.AuthTLS(config); err != nil {
+			client.Quit()
+			return nil, &cliError{code: ExitConnect, err: err}
+		}
+	}
+
+	user, password, err := ResolveCredentials(target.Hostname(), target.User, target.Password)
+	if err != nil {
+		client.Quit()
+		return nil, &cliError{code: ExitAuth, err: err}
+	}
+	if user == "" {
+		user, password = "anonymous", "anonymous@"
+	}
+	if err := client.Login(user, password); err != nil {
+		client.Quit()
+		return nil, &cliError{code: ExitAuth, err: err}
+	}
+	MyLogger.Info("connected", "url", target.String())
+	return client, nil
+}
+
+// isTerminal 判断文件是否为交互式终端
+func isTerminal(f *os.File) bool {
+	info, err := f.Stat()
+	if err != nil {
+		return false
+	}
+	return info.Mode()&os.ModeCharDevice != 0
+}
+
+// runFXPCLI 把源 URL 的文件直接传输到目标 URL，目标路径以 / 结尾时沿用源文件名
+func runFXPCLI(positional []string, insecure bool, proxy ProxyConfig, charset string, shell *Shell, fail func(error) int) int {
+	var targets [2]*FTPURL
+	for i := range targets {
+		target, err := ParseFTPURL(positional[i])
+		if err != nil {
+			return fail(usageError(err))
+		}
+		targets[i] = target
+	}
+	srcPath, dstPath := targets[0].Path, targets[1].Path
+	if strings.HasSuffix(dstPath, "/") {
+		dstPath += path.Base(srcPath)
+	}
+
+	session := &FXPSession{}
+	var err error
+	if session.Source, err = dialURL(targets[0], insecure, proxy, charset); err != nil {
+		return fail(err)
+	}
+	defer session.Source.Quit()
+	if session.Target, err = dialURL(targets[1], insecure, proxy, charset); err != nil {
+		return fail(err)
+	}
+	defer session.Target.Quit()
+
+	result, err := session.Copy(srcPath, dstPath)
+	if err != nil {
+		return fail(err)
+	}
+	shell.report(map[string]interface{}{"command": "fxp", "source": srcPath, "target": dstPath, "size": result.Size},
+		"%s -> %s (%d bytes)", srcPath, dstPath, result.Size)
+	return ExitOK
+}
+
+// runScriptCLI 执行脚本文件 ("-" 表示标准输入)，指定 URL 时先连接该服务器
+func runScriptCLI(positional []string, opts ScriptOptions, fail func(error) int) int {
+	var src io.Reader = os.Stdin
+	if positional[0] != "-" {
+		f, err := os.Open(positional[0])
+		if err != nil {
+			return fail(fmt.Errorf("打开脚本失败: %w", err))
+		}
+		defer f.Close()
+		src = f
+	}
+
+	runner := NewScriptRunner(nil, os.Stdout, os.Stderr, opts)
+	if len(positional) == 2 && !opts.DryRun {
+		if err := runner.connect(positional[1]); err != nil {
+			return fail(err)
+		}
+	}
+	result, err := runner.Run(src)
+	if err != nil {
+		return exitCodeFor(err)
+	}
+	if result.Failed > 0 {
+		return ExitFailure
+	}
+	return ExitOK
+}
@@ -0,0 +1,32 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestRunCLILogFileError(t *testing.T) {
+	// log.log 无法创建时返回错误码而不是 panic
+	dir := t.TempDir()
+	if err := os.Mkdir(filepath.Join(dir, "log.log"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chdir(dir); err != nil {
+		t.Fatal(err)
+	}
+	defer os.Chdir(wd)
+	logger := MyLogger
+	defer func() { MyLogger = logger }()
+
+	if code := runCLI([]string{"ls", "ftp://127.0.0.1:1/"}); code != ExitLocal {
+		t.Fatalf("runCLI = %d, want %d", code, ExitLocal)
+	}
+	if MyLogger != logger {
+		t.Fatal("logger was replaced")
+	}
+}
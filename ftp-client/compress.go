@@ -0,0 +1,154 @@
+package main
+
+import (
+	"bytes"
+	"compress/flate"
+	"compress/zlib"
+	"fmt"
+	"io"
+	"net"
+	"strings"
+)
+
+// SetCompression 设置登录后是否在服务器支持时启用 MODE Z，level 为 1-9 的压缩级别，0 表示默认级别。
+// 在 Login 之前调用
+func (ftp *FTPConn) SetCompression(enabled bool, level int) error {
+	if level < 0 || level > 9 {
+		return fmt.Errorf("压缩级别须在 0-9 之间: %d", level)
+	}
+	ftp.compress = enabled
+	ftp.compressLevel = level
+	return nil
+}
+
+// Compressed 返回数据连接当前是否使用 MODE Z 压缩
+func (ftp *FTPConn) Compressed() bool {
+	return ftp.modeZ
+}
+
+// negotiateModeZ 启用了压缩且服务器在 FEAT 中声明 MODE Z 时切换到压缩模式，
+// 失败时继续使用普通的流模式
+func (ftp *FTPConn) negotiateModeZ() {
+	if !ftp.compress {
+		return
+	}
+	modes, ok := ftp.Features()["MODE"]
+	if !ok || !strings.Contains(strings.ToUpper(modes), "Z") {
+		MyLogger.Info("server does not support MODE Z")
+		return
+	}
+	if ftp.compressLevel > 0 {
+		// 服务器发送数据时使用的级别，不支持时服务器使用自己的默认值
+		ftp.Command(fmt.Sprintf("OPTS MODE Z LEVEL %d", ftp.compressLevel))
+	}
+	reply, err := ftp.Command("MODE Z")
+	if err != nil {
+		return
+	}
+	ftp.modeZ = reply.Code == 200
+	MyLogger.Info("MODE Z", "enabled", ftp.modeZ, "reply", reply.Code)
+}
+
+// setStreamMode 切换回不压缩的流模式 (MODE S)
+func (ftp *FTPConn) setStreamMode() error {
+	if !ftp.modeZ {
+		return nil
+	}
+	response, err := ftp.SendCommand("MODE S")
+	if err != nil {
+		return err
+	}
+	if !strings.HasPrefix(response, "200") {
+		return fmt.Errorf("切换到流模式失败: %s", response)
+	}
+	ftp.modeZ = false
+	return nil
+}
+
+// resumeModeZ 在 setStreamMode 临时切换后重新启用 MODE Z，失败时继续使用流模式
+func (ftp *FTPConn) resumeModeZ() {
+	reply, err := ftp.Command("MODE Z")
+	if err != nil || reply.Code != 200 {
+		MyLogger.Info("failed to restore MODE Z", "err", err, "reply", reply.Code)
+		return
+	}
+	ftp.modeZ = true
+}
+
+// deflateConn 在 MODE Z 下对数据连接做 zlib 压缩和解压。
+// 建立数据连接时还不知道传输方向，第一次读或写时才创建解压器或压缩器
+type deflateConn struct {
+	net.Conn
+	level  int
+	upload bool // 用于 STOR/APPE，由发送命令的一方通过 markUpload 设置
+	r      io.ReadCloser
+	w      *zlib.Writer
+}
+
+func newDeflateConn(conn net.Conn, level int) *deflateConn {
+	if level == 0 {
+		level = flate.DefaultCompression
+	}
+	return &deflateConn{Conn: conn, level: level}
+}
+
+func (c *deflateConn) Read(p []byte) (int, error) {
+	if c.r == nil {
+		// 服务器对空的结果可能不发送任何数据，此时直接结束
+		var first [1]byte
+		if _, err := io.ReadFull(c.Conn, first[:]); err != nil {
+			return 0, err
+		}
+		r, err := zlib.NewReader(io.MultiReader(bytes.NewReader(first[:]), c.Conn))
+		if err != nil {
+			return 0, err
+		}
+		c.r = r
+	}
+	return c.r.Read(p)
+}
+
+func (c *deflateConn) Write(p []byte) (int, error) {
+	if c.w == nil {
+		w, err := zlib.NewWriterLevel(c.Conn, c.level)
+		if err != nil {
+			return 0, err
+		}
+		c.w = w
+	}
+	return c.w.Write(p)
+}
+
+// Close 上传时写出压缩流的结尾；上传空文件时没有写过数据，写出一个空的压缩流。
+// 列表、下载和没有收到数据就中止的连接不写任何数据
+func (c *deflateConn) Close() error {
+	if c.upload && c.w == nil {
+		c.Write(nil)
+	}
+	var err error
+	if c.w != nil {
+		err = c.w.Close()
+	}
+	if c.r != nil {
+		c.r.Close()
+	}
+	if closeErr := c.Conn.Close(); err == nil {
+		err = closeErr
+	}
+	return err
+}
+
+// markUpload 标记数据连接用于上传
+func markUpload(conn net.Conn) {
+	for {
+		switch c := conn.(type) {
+		case *deflateConn:
+			c.upload = true
+			return
+		case *progressConn:
+			conn = c.Conn
+		default:
+			return
+		}
+	}
+}
@@ -0,0 +1,120 @@
+package main
+
+import (
+	"bytes"
+	"compress/zlib"
+	"context"
+	"io"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestModeZ(t *testing.T) {
+	srv := newTestServer(t)
+	srv.Features = append(srv.Features, "MODE Z")
+	client := NewFTPClient()
+	if err := client.SetCompression(true, 6); err != nil {
+		t.Fatal(err)
+	}
+	if err := client.Dial(srv.Addr); err != nil {
+		t.Fatal(err)
+	}
+	if err := client.Login("rw", "123"); err != nil {
+		t.Fatal(err)
+	}
+	defer client.Close()
+	if !client.Compressed() {
+		t.Fatal("MODE Z was not enabled")
+	}
+
+	// 上传、列表和下载都经过压缩，内容与原文相同
+	dir := t.TempDir()
+	payload := bytes.Repeat([]byte("2024-01-01 12:00:00 INFO request handled\n"), 1000)
+	local := filepath.Join(dir, "app.log")
+	os.WriteFile(local, payload, 0644)
+	empty := filepath.Join(dir, "empty.log")
+	os.WriteFile(empty, nil, 0644)
+	for _, name := range []string{local, empty} {
+		if err := UploadFile(context.Background(), client, name, "/"+filepath.Base(name)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if data, err := srv.ReadFile("/app.log"); err != nil || !bytes.Equal(data, payload) {
+		t.Fatalf("uploaded %d bytes, %v", len(data), err)
+	}
+	if data, err := srv.ReadFile("/empty.log"); err != nil || len(data) != 0 {
+		t.Fatalf("uploaded %q, %v", data, err)
+	}
+	entries, err := client.List("/")
+	if err != nil || len(entries) != 2 {
+		t.Fatalf("List = %+v, %v", entries, err)
+	}
+	down := filepath.Join(dir, "down.log")
+	if err := DownloadFile(context.Background(), client, "/app.log", down, 0, -1); err != nil {
+		t.Fatal(err)
+	}
+	if data, _ := os.ReadFile(down); !bytes.Equal(data, payload) {
+		t.Fatalf("downloaded %d bytes", len(data))
+	}
+	received := strings.Join(srv.Received(), "\n")
+	if !strings.Contains(received, "OPTS MODE Z LEVEL 6") || !strings.Contains(received, "MODE Z") {
+		t.Fatalf("commands = %v", srv.Received())
+	}
+
+	// 服务器没有声明 MODE Z 时不发送 MODE 命令
+	plain := newTestServer(t)
+	other := NewFTPClient()
+	other.SetCompression(true, 0)
+	if err := other.Dial(plain.Addr); err != nil {
+		t.Fatal(err)
+	}
+	if err := other.Login("rw", "123"); err != nil {
+		t.Fatal(err)
+	}
+	defer other.Close()
+	if other.Compressed() {
+		t.Fatal("MODE Z enabled without FEAT")
+	}
+	for _, cmd := range plain.Received() {
+		if strings.HasPrefix(cmd, "MODE") {
+			t.Fatalf("sent %s", cmd)
+		}
+	}
+	if err := other.SetCompression(true, 10); err == nil {
+		t.Fatal("invalid level accepted")
+	}
+}
+
+func TestDeflateConnClose(t *testing.T) {
+	// 关闭一端，读出另一端收到的所有字节
+	closeAndRead := func(upload bool) []byte {
+		client, server := net.Pipe()
+		c := newDeflateConn(client, 0)
+		if upload {
+			markUpload(&progressConn{Conn: c})
+		}
+		done := make(chan []byte)
+		go func() {
+			data, _ := io.ReadAll(server)
+			done <- data
+		}()
+		c.Close()
+		return <-done
+	}
+	// 没有读写过的列表或下载连接不发送数据
+	if data := closeAndRead(false); len(data) != 0 {
+		t.Fatalf("download connection sent %q", data)
+	}
+	// 上传空文件时发送一个空的压缩流
+	data := closeAndRead(true)
+	r, err := zlib.NewReader(bytes.NewReader(data))
+	if err != nil {
+		t.Fatalf("upload sent %q: %v", data, err)
+	}
+	if content, err := io.ReadAll(r); err != nil || len(content) != 0 {
+		t.Fatalf("empty upload decoded to %q, %v", content, err)
+	}
+}
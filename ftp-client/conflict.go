@@ -0,0 +1,366 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ConflictPolicy 传输的目标文件已存在时的处理方式
+type ConflictPolicy string
+
+const (
+	ConflictOverwrite   ConflictPolicy = "overwrite"    // 覆盖
+	ConflictSkip        ConflictPolicy = "skip"         // 跳过
+	ConflictResume      ConflictPolicy = "resume"       // 目标比源小时从目标的大小处续传，大小相同时跳过，目标更大时覆盖
+	ConflictRename      ConflictPolicy = "rename"       // 保存为 name (1).ext 这样的新名称
+	ConflictNewer       ConflictPolicy = "newer"        // 源文件比目标新时覆盖，否则跳过
+	ConflictSizeDiffers ConflictPolicy = "size-differs" // 大小不同时覆盖，否则跳过
+	ConflictAsk         ConflictPolicy = "ask"          // 通过 "transfer-conflict" 事件询问前端
+)
+
+// ErrSkipped 目标文件已存在，按冲突策略跳过了传输
+var ErrSkipped = errors.New("目标文件已存在，已跳过")
+
+// ParseConflictPolicy 解析冲突策略，空字符串表示覆盖
+func ParseConflictPolicy(s string) (ConflictPolicy, error) {
+	switch p := ConflictPolicy(strings.ToLower(strings.TrimSpace(s))); p {
+	case "":
+		return ConflictOverwrite, nil
+	case ConflictOverwrite, ConflictSkip, ConflictResume, ConflictRename, ConflictNewer, ConflictSizeDiffers, ConflictAsk:
+		return p, nil
+	}
+	return "", fmt.Errorf("不支持的冲突策略: %s (可用: overwrite, skip, resume, rename, newer, size-differs, ask)", s)
+}
+
+// Conflict 一次传输的源文件和已存在的目标文件，策略为 ask 时通过 "transfer-conflict" 事件发送给前端
+type Conflict struct {
+	ID         string    `json:"id"`
+	JobID      string    `json:"jobId"`
+	Kind       string    `json:"kind"` // upload / download
+	Source     string    `json:"source"`
+	Target     string    `json:"target"`
+	SourceSize int64     `json:"sourceSize"`
+	SourceTime time.Time `json:"sourceTime"`
+	TargetSize int64     `json:"targetSize"`
+	TargetTime time.Time `json:"targetTime"`
+}
+
+// fileState 判断冲突用到的文件信息
+type fileState struct {
+	exists bool
+	size   int64
+	time   time.Time
+}
+
+// localState 返回本地文件的信息
+func localState(p string) (fileState, error) {
+	info, err := os.Stat(p)
+	if os.IsNotExist(err) {
+		return fileState{}, nil
+	}
+	if err != nil {
+		return fileState{}, err
+	}
+	if info.IsDir() {
+		return fileState{}, fmt.Errorf("%s 是目录", p)
+	}
+	return fileState{exists: true, size: info.Size(), time: info.ModTime()}, nil
+}
+
+// remoteState 返回远程文件的信息，FTP 优先使用 SIZE 和 MDTM，不支持时使用目录列表
+func remoteState(rfs RemoteFS, p string) (fileState, error) {
+	if ftp, ok := rfs.(interface {
+		Size(string) (int64, error)
+		ModTime(string) (time.Time, error)
+	}); ok {
+		if size, err := ftp.Size(p); err == nil {
+			st := fileState{exists: true, size: size}
+			if t, err := ftp.ModTime(p); err == nil {
+				st.time = t
+			}
+			return st, nil
+		}
+	}
+	e, err := rfs.Stat(p)
+	if errors.Is(err, fs.ErrNotExist) {
+		return fileState{}, nil
+	}
+	if err != nil {
+		return fileState{}, err
+	}
+	if e.IsDir() {
+		return fileState{}, fmt.Errorf("%s 是目录", p)
+	}
+	return fileState{exists: true, size: e.Size, time: e.Time}, nil
+}
+
+// conflictOrDefault 解析单次传输指定的冲突策略，空字符串表示使用默认策略
+func conflictOrDefault(s string) (ConflictPolicy, error) {
+	if strings.TrimSpace(s) == "" {
+		transfers.mu.Lock()
+		defer transfers.mu.Unlock()
+		return transfers.defaultConflict, nil
+	}
+	return ParseConflictPolicy(s)
+}
+
+// ConflictPolicy 返回任务的冲突策略。没有任务时 (直接调用 RETR、STOR 等) 与以前一样覆盖
+func (job *TransferJob) ConflictPolicy() ConflictPolicy {
+	if job == nil {
+		return ConflictOverwrite
+	}
+	return job.Conflict
+}
+
+// decide 按策略决定如何处理冲突，返回 overwrite、skip、resume 或 rename 以及续传的位置
+func decide(policy ConflictPolicy, c Conflict) (ConflictPolicy, int64) {
+	switch policy {
+	case ConflictSkip, ConflictRename:
+		return policy, 0
+	case ConflictResume:
+		switch {
+		case c.TargetSize < c.SourceSize:
+			return ConflictResume, c.TargetSize
+		case c.TargetSize == c.SourceSize:
+			return ConflictSkip, 0
+		}
+	case ConflictNewer:
+		// 列表和 MDTM 的时间只精确到秒或分钟，按秒比较；时间未知时按大小判断
+		if !c.SourceTime.IsZero() && !c.TargetTime.IsZero() {
+			if c.SourceTime.Truncate(time.Second).After(c.TargetTime.Truncate(time.Second)) {
+				return ConflictOverwrite, 0
+			}
+			return ConflictSkip, 0
+		}
+		return decide(ConflictSizeDiffers, c)
+	case ConflictSizeDiffers:
+		if c.SourceSize == c.TargetSize {
+			return ConflictSkip, 0
+		}
+	}
+	return ConflictOverwrite, 0
+}
+
+// resolveConflict 目标已存在时按任务的策略处理，策略为 ask 时先询问。
+// 返回实际写入的目标路径和续传的位置，跳过时返回 ErrSkipped
+func resolveConflict(job *TransferJob, c Conflict, rename func(string) (string, error)) (string, int64, error) {
+	policy := job.ConflictPolicy()
+	if policy == ConflictAsk {
+		if job == nil || job.ask == nil {
+			return "", 0, fmt.Errorf("%s 已存在，需要选择冲突策略", c.Target)
+		}
+		if c.JobID == "" {
+			c.JobID = job.ID
+		}
+		var err error
+		if policy, err = job.ask(c); err != nil {
+			return "", 0, err
+		}
+	}
+	action, offset := decide(policy, c)
+	MyLogger.Info("transfer conflict", "target", c.Target, "policy", policy, "action", action, "offset", offset)
+	switch action {
+	case ConflictSkip:
+		return "", 0, ErrSkipped
+	case ConflictRename:
+		target, err := rename(c.Target)
+		return target, 0, err
+	}
+	return c.Target, offset, nil
+}
+
+// numberedName 返回 name (n).ext 形式的文件名
+func numberedName(name string, n int) string {
+	ext := path.Ext(name)
+	if ext == name {
+		ext = ""
+	}
+	return fmt.Sprintf("%s (%d)%s", strings.TrimSuffix(name, ext), n, ext)
+}
+
+// maxRename 寻找未使用的文件名时的最多尝试次数
+const maxRename = 1000
+
+// uniqueLocalName 返回与 p 在同一目录、尚不存在的本地文件名
+func uniqueLocalName(p string) (string, error) {
+	dir, name := filepath.Split(p)
+	for n := 1; n <= maxRename; n++ {
+		candidate := filepath.Join(dir, numberedName(name, n))
+		if _, err := os.Lstat(candidate); os.IsNotExist(err) {
+			return candidate, nil
+		}
+	}
+	return "", fmt.Errorf("找不到可用的文件名: %s", p)
+}
+
+// uniqueRemoteName 返回与 p 在同一目录、服务器上尚不存在的文件名
+func uniqueRemoteName(rfs RemoteFS, p string) (string, error) {
+	dir, name := path.Split(p)
+	for n := 1; n <= maxRename; n++ {
+		candidate := path.Join(dir, numberedName(name, n))
+		st, err := remoteState(rfs, candidate)
+		if err != nil {
+			return "", err
+		}
+		if !st.exists {
+			return candidate, nil
+		}
+	}
+	return "", fmt.Errorf("找不到可用的文件名: %s", p)
+}
+
+// GetFile 按当前任务的冲突策略把远程文件下载到本地，返回实际保存的本地路径；
+// 跳过时返回 ErrSkipped
+func GetFile(ctx context.Context, rfs RemoteFS, remotePath, localPath string) (string, error) {
+	remote, err := remoteState(rfs, remotePath)
+	if err != nil {
+		return "", err
+	}
+	if !remote.exists {
+		return "", fmt.Errorf("%s: %w", remotePath, fs.ErrNotExist)
+	}
+	local, err := localState(localPath)
+	if err != nil {
+		return "", err
+	}
+	var offset int64
+	if local.exists {
+		c := Conflict{
+			Kind:       "download",
+			Source:     remotePath,
+			Target:     localPath,
+			SourceSize: remote.size,
+			SourceTime: remote.time,
+			TargetSize: local.size,
+			TargetTime: local.time,
+		}
+		localPath, offset, err = resolveConflict(rfs.Job(), c, uniqueLocalName)
+		if err != nil {
+			return "", err
+		}
+	}
+	return localPath, DownloadFile(ctx, rfs, remotePath, localPath, offset, remote.size)
+}
+
+// PutFile 按当前任务的冲突策略把本地文件上传到服务器，返回实际写入的远程路径；
+// 跳过时返回 ErrSkipped
+func PutFile(ctx context.Context, rfs RemoteFS, localPath, remotePath string) (string, error) {
+	local, err := localState(localPath)
+	if err != nil {
+		return "", err
+	}
+	if !local.exists {
+		return "", fmt.Errorf("打开本地文件失败: %w", &fs.PathError{Op: "open", Path: localPath, Err: fs.ErrNotExist})
+	}
+	remote, err := remoteState(rfs, remotePath)
+	if err != nil {
+		return "", err
+	}
+	var offset int64
+	if remote.exists {
+		c := Conflict{
+			Kind:       "upload",
+			Source:     localPath,
+			Target:     remotePath,
+			SourceSize: local.size,
+			SourceTime: local.time,
+			TargetSize: remote.size,
+			TargetTime: remote.time,
+		}
+		remotePath, offset, err = resolveConflict(rfs.Job(), c, func(p string) (string, error) {
+			return uniqueRemoteName(rfs, p)
+		})
+		if err != nil {
+			return "", err
+		}
+	}
+	return remotePath, uploadFile(ctx, rfs, localPath, remotePath, offset)
+}
+
+// conflictRegistry 等待前端回答的冲突
+type conflictRegistry struct {
+	mu      sync.Mutex
+	pending map[string]chan ConflictPolicy
+}
+
+var conflicts = &conflictRegistry{pending: map[string]chan ConflictPolicy{}}
+
+// askConflict 发送 "transfer-conflict" 事件并等待 ResolveConflict 的回答；ctx 取消时放弃等待
+func (a *App) askConflict(ctx context.Context, c Conflict) (ConflictPolicy, error) {
+	if a.ctx == nil {
+		return "", fmt.Errorf("%s already exists", c.Target)
+	}
+	c.ID = newSessionID()
+	answer := make(chan ConflictPolicy, 1)
+	conflicts.mu.Lock()
+	conflicts.pending[c.ID] = answer
+	conflicts.mu.Unlock()
+	defer func() {
+		conflicts.mu.Lock()
+		delete(conflicts.pending, c.ID)
+		conflicts.mu.Unlock()
+	}()
+
+	a.emit("transfer-conflict", c)
+	select {
+	case policy := <-answer:
+		return policy, nil
+	case <-ctx.Done():
+		return "", ctx.Err()
+	case <-a.ctx.Done():
+		return "", a.ctx.Err()
+	}
+}
+
+// ConflictPolicies 返回可选的冲突策略
+func (a *App) ConflictPolicies() []ConflictPolicy {
+	return []ConflictPolicy{ConflictOverwrite, ConflictSkip, ConflictResume, ConflictRename, ConflictNewer, ConflictSizeDiffers, ConflictAsk}
+}
+
+// SetDefaultConflictPolicy 设置之后新建任务在目标文件已存在时的处理方式
+func (a *App) SetDefaultConflictPolicy(p string) error {
+	policy, err := ParseConflictPolicy(p)
+	if err != nil {
+		return err
+	}
+	setDefaultConflictPolicy(policy)
+	MyLogger.Info("default conflict policy", "policy", policy)
+	return nil
+}
+
+// setDefaultConflictPolicy 设置之后新建任务的冲突策略
+func setDefaultConflictPolicy(p ConflictPolicy) {
+	transfers.mu.Lock()
+	transfers.defaultConflict = p
+	transfers.mu.Unlock()
+}
+
+// ResolveConflict 回答 "transfer-conflict" 事件，policy 为除 ask 以外的冲突策略
+func (a *App) ResolveConflict(id, policy string) error {
+	p, err := ParseConflictPolicy(policy)
+	if err != nil {
+		return err
+	}
+	if p == ConflictAsk {
+		return fmt.Errorf("choose a policy other than ask")
+	}
+	conflicts.mu.Lock()
+	answer, ok := conflicts.pending[id]
+	conflicts.mu.Unlock()
+	if !ok {
+		return fmt.Errorf("conflict %q not found", id)
+	}
+	select {
+	case answer <- p:
+	default:
+	}
+	return nil
+}
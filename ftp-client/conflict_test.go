@@ -0,0 +1,169 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+	"time"
+)
+
+func TestConflictPolicy(t *testing.T) {
+	old, now := time.Now().Add(-time.Hour), time.Now()
+	for _, tc := range []struct {
+		policy ConflictPolicy
+		c      Conflict
+		action ConflictPolicy
+		offset int64
+	}{
+		{ConflictResume, Conflict{SourceSize: 10, TargetSize: 4}, ConflictResume, 4},
+		{ConflictResume, Conflict{SourceSize: 10, TargetSize: 10}, ConflictSkip, 0},
+		{ConflictResume, Conflict{SourceSize: 10, TargetSize: 12}, ConflictOverwrite, 0},
+		{ConflictNewer, Conflict{SourceTime: now, TargetTime: old}, ConflictOverwrite, 0},
+		{ConflictNewer, Conflict{SourceTime: old, TargetTime: now}, ConflictSkip, 0},
+		{ConflictNewer, Conflict{SourceSize: 1, TargetSize: 1}, ConflictSkip, 0},
+		{ConflictSizeDiffers, Conflict{SourceSize: 1, TargetSize: 2}, ConflictOverwrite, 0},
+		{ConflictSizeDiffers, Conflict{SourceSize: 2, TargetSize: 2}, ConflictSkip, 0},
+	} {
+		if action, offset := decide(tc.policy, tc.c); action != tc.action || offset != tc.offset {
+			t.Errorf("%s %+v: got %s %d, want %s %d", tc.policy, tc.c, action, offset, tc.action, tc.offset)
+		}
+	}
+
+	srv := newTestServer(t)
+	srv.WriteFile("/data.bin", []byte("0123456789"))
+	client := dialTestServer(t, srv)
+	dir := t.TempDir()
+	local := filepath.Join(dir, "data.bin")
+
+	get := func(policy ConflictPolicy, ask func(Conflict) (ConflictPolicy, error)) (string, error) {
+		job := NewTransferJob("download", "/data.bin", nil)
+		job.Conflict = policy
+		job.ask = ask
+		var saved string
+		err := client.RunJob(job, func() (err error) {
+			saved, err = GetFile(context.Background(), client, "/data.bin", local)
+			return err
+		})
+		job.Finish(err)
+		return saved, err
+	}
+	readLocal := func(p string) string {
+		data, _ := os.ReadFile(p)
+		return string(data)
+	}
+
+	os.WriteFile(local, []byte("mine"), 0644)
+	if _, err := get(ConflictSkip, nil); !errors.Is(err, ErrSkipped) || readLocal(local) != "mine" {
+		t.Fatalf("skip: %v, local = %q", err, readLocal(local))
+	}
+	if _, err := get(ConflictAsk, nil); err == nil || readLocal(local) != "mine" {
+		t.Fatalf("ask without a UI: %v", err)
+	}
+	saved, err := get(ConflictAsk, func(c Conflict) (ConflictPolicy, error) {
+		if c.Kind != "download" || c.SourceSize != 10 || c.TargetSize != 4 || c.JobID == "" {
+			t.Errorf("conflict = %+v", c)
+		}
+		return ConflictRename, nil
+	})
+	if err != nil || saved != filepath.Join(dir, "data (1).bin") || readLocal(saved) != "0123456789" || readLocal(local) != "mine" {
+		t.Fatalf("rename: %q, %v", saved, err)
+	}
+
+	// 只有本地文件是远程文件的开头时续传才有意义，这里用它检查发送了 REST
+	os.WriteFile(local, []byte("0123"), 0644)
+	if _, err := get(ConflictResume, nil); err != nil || readLocal(local) != "0123456789" {
+		t.Fatalf("resume: %v, local = %q", err, readLocal(local))
+	}
+	if !slices.Contains(srv.Received(), "REST 4") {
+		t.Fatalf("no REST in %q", srv.Received())
+	}
+	if _, err := get(ConflictSizeDiffers, nil); !errors.Is(err, ErrSkipped) {
+		t.Fatalf("size-differs on equal sizes: %v", err)
+	}
+	srv.SetModTime("/data.bin", time.Now().Add(-24*time.Hour))
+	os.WriteFile(local, []byte("newer local"), 0644)
+	if _, err := get(ConflictNewer, nil); !errors.Is(err, ErrSkipped) || readLocal(local) != "newer local" {
+		t.Fatalf("newer: %v, local = %q", err, readLocal(local))
+	}
+	if _, err := get(ConflictOverwrite, nil); err != nil || readLocal(local) != "0123456789" {
+		t.Fatalf("overwrite: %v, local = %q", err, readLocal(local))
+	}
+
+	// 上传：续传用 APPE 追加剩余部分，改名时使用服务器上不存在的名称
+	srv.WriteFile("/up.txt", []byte("abc"))
+	upload := filepath.Join(dir, "up.txt")
+	os.WriteFile(upload, []byte("abcdef"), 0644)
+	put := func(policy ConflictPolicy) (string, error) {
+		job := NewTransferJob("upload", "/up.txt", nil)
+		job.Conflict = policy
+		var saved string
+		err := client.RunJob(job, func() (err error) {
+			saved, err = PutFile(context.Background(), client, upload, "/up.txt")
+			return err
+		})
+		job.Finish(err)
+		return saved, err
+	}
+	if _, err := put(ConflictResume); err != nil {
+		t.Fatal(err)
+	}
+	if data, _ := srv.ReadFile("/up.txt"); string(data) != "abcdef" {
+		t.Fatalf("resumed upload = %q", data)
+	}
+	if saved, err := put(ConflictRename); err != nil || saved != "/up (1).txt" || !srv.Exists("/up (1).txt") {
+		t.Fatalf("rename upload: %q, %v", saved, err)
+	}
+
+	// 没有传输任务的 RETR 和 STOR 保持覆盖
+	os.WriteFile(local, []byte("mine"), 0644)
+	if err := client.RETR("/data.bin", local); err != nil || readLocal(local) != "0123456789" {
+		t.Fatalf("RETR without a job: %v, local = %q", err, readLocal(local))
+	}
+	if err := client.STOR(local, "/up.txt"); err != nil {
+		t.Fatalf("STOR without a job: %v", err)
+	}
+	if data, _ := srv.ReadFile("/up.txt"); string(data) != "0123456789" {
+		t.Fatalf("STOR without a job wrote %q", data)
+	}
+
+	app := NewApp()
+	if err := app.ResolveConflict("nope", "skip"); err == nil {
+		t.Fatal("unknown conflict resolved")
+	}
+	if err := app.SetDefaultConflictPolicy("sometimes"); err == nil {
+		t.Fatal("invalid policy accepted")
+	}
+}
+
+func TestTransferConflictArgument(t *testing.T) {
+	srv := newTestServer(t)
+	srv.WriteFile("/data.bin", []byte("0123456789"))
+	app := NewApp()
+	id, err := app.Connect(srv.Addr, "rw", "123")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer app.Disconnect(id)
+	local := filepath.Join(t.TempDir(), "data.bin")
+	os.WriteFile(local, []byte("mine"), 0644)
+
+	// 默认策略是 ask，没有前端应答；单次传输指定的策略优先
+	if err := app.Download(id, "/data.bin", local, -1, "skip", ""); err != nil {
+		t.Fatalf("download with skip: %v", err)
+	}
+	if data, _ := os.ReadFile(local); string(data) != "mine" {
+		t.Fatalf("download with skip wrote %q", data)
+	}
+	if err := app.Upload(id, local, "/data.bin", "rename", ""); err != nil {
+		t.Fatal(err)
+	}
+	if data, _ := srv.ReadFile("/data (1).bin"); string(data) != "mine" {
+		t.Fatalf("upload with rename wrote %q", data)
+	}
+	if err := app.Download(id, "/data.bin", local, -1, "sometimes", ""); err == nil {
+		t.Fatal("invalid policy accepted")
+	}
+}
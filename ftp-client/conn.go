@@ -3,37 +3,84 @@ package main
 import (
 	"bufio"
 	"context"
+	"crypto/tls"
 	"fmt"
-	"io"
 	"net"
-	"os"
 	"strconv"
 	"strings"
 	"time"
 
-	"github.com/wailsapp/wails/v2/pkg/runtime"
+	"golang.org/x/text/encoding"
 )
 
 // FTPConn 封装FTP客户端的核心功能
 type FTPConn struct {
+	addr        string   // 服务器地址 host:port
 	controlConn net.Conn // 控制连接
 	dataConn    net.Conn // 数据连接
 	reader      *bufio.Reader
 	// downloadOffset map[string]int64
+
+	tlsConfig    *tls.Config  // 非空时控制连接和数据连接均使用TLS
+	dialer       Dialer       // 控制连接和数据连接的拨号方式 (如代理)，nil 表示直连
+	job          *TransferJob // 当前传输任务，决定数据连接的限速
+	siteChmod    int          // SITE CHMOD 是否可用 (chmodUnknown/chmodSupported/chmodUnsupported)
+	transferType string       // 服务器当前的 TYPE ("A"/"I")，空表示未知
+
+	compress      bool // 服务器支持时启用 MODE Z
+	compressLevel int  // MODE Z 的压缩级别，0 表示默认
+	modeZ         bool // 数据连接当前使用 MODE Z
+
+	charset     encoding.Encoding // 服务器不支持 UTF8 时使用的字符集，nil 表示 UTF-8
+	charsetName string
+	utf8        bool              // 已通过 OPTS UTF8 ON 切换到 UTF-8
+	features    map[string]string // FEAT 的结果，第一次使用时获取
+
+	sessionID string    // 会话标识，用于协议跟踪
+	seq       uint64    // 最近一条命令的序号
+	sentAt    time.Time // 最近一条命令的发送时间
 }
 
 // NewFTPConn 初始化FTP客户端
 func NewFTPConn() *FTPConn {
-	return &FTPConn{}
+	return &FTPConn{sessionID: newSessionID()}
+}
+
+// SessionID 返回当前连接的会话标识
+func (ftp *FTPConn) SessionID() string {
+	return ftp.sessionID
+}
+
+// Addr 返回最近一次 Dial 的服务器地址
+func (ftp *FTPConn) Addr() string {
+	return ftp.addr
+}
+
+// SetDialer 设置之后建立连接所用的拨号器，nil 表示直连
+func (ftp *FTPConn) SetDialer(d Dialer) {
+	ftp.dialer = d
+}
+
+// dial 通过拨号器建立 TCP 连接
+func (ftp *FTPConn) dial(addr string) (net.Conn, error) {
+	if ftp.dialer == nil {
+		return net.Dial("tcp", addr)
+	}
+	return ftp.dialer.Dial("tcp", addr)
 }
 
 // Connect 连接到FTP服务器
 func (ftp *FTPConn) Dial(serverAddr string) error {
-	conn, err := net.Dial("tcp", serverAddr)
+	conn, err := ftp.dial(serverAddr)
 	if err != nil {
 		return fmt.Errorf("连接到FTP服务器失败: %v", err)
 	}
 	ftp.controlConn = conn
+	ftp.addr = serverAddr
+	ftp.utf8 = false
+	ftp.features = nil
+	ftp.transferType = ""
+	ftp.modeZ = false
 
 	ftp.reader = bufio.NewReader(conn)
 
@@ -53,19 +100,69 @@ func (ftp *FTPConn) Dial(serverAddr string) error {
 }
 
 // readResponse reads a response from the server
+// 多行响应 (如 "211-Features:" ... "211 End") 会读到结束行为止，各行以 "\n" 连接
 func (ftp *FTPConn) readResponse() (string, error) {
-	response, err := ftp.reader.ReadString('\n')
+	response, err := ftp.readLine()
+	if err != nil {
+		return "", err
+	}
+	if code, ok := isMultiLineStart(response); ok {
+		lines := []string{response}
+		for {
+			line, err := ftp.readLine()
+			if err != nil {
+				return "", err
+			}
+			lines = append(lines, line)
+			if strings.HasPrefix(line, code+" ") || line == code {
+				break
+			}
+		}
+		response = strings.Join(lines, "\n")
+	}
+	return response, nil
+}
+
+// readLine 从控制连接读取一行并记录到协议跟踪
+func (ftp *FTPConn) readLine() (string, error) {
+	line, err := ftp.reader.ReadString('\n')
 	if err != nil {
 		return "", fmt.Errorf("读取响应失败: %v", err)
 	}
-	return strings.TrimSpace(response), nil
+	line = ftp.decode(strings.TrimRight(line, "\r\n"))
+	ftp.trace(TraceRecv, line)
+	return line, nil
+}
+
+// trace 把一行协议数据写入跟踪日志和协议控制台
+func (ftp *FTPConn) trace(direction, line string) {
+	var elapsed time.Duration
+	if direction == TraceRecv {
+		elapsed = time.Since(ftp.sentAt)
+	}
+	MyTracer.Trace(ftp.sessionID, ftp.seq, direction, line, elapsed)
+	MyConsole.Append(ftp.sessionID, direction, line, elapsed)
+}
+
+// writeCommand 只发送命令，不读取响应
+func (ftp *FTPConn) writeCommand(command string) error {
+	ftp.seq++
+	ftp.sentAt = time.Now()
+	ftp.trace(TraceSend, command)
+	data, err := ftp.encode(command + "\r\n")
+	if err != nil {
+		return err
+	}
+	if _, err := ftp.controlConn.Write(data); err != nil {
+		return fmt.Errorf("发送命令失败: %v", err)
+	}
+	return nil
 }
 
 // SendCommand 向服务器发送命令，并接收响应
 func (ftp *FTPConn) SendCommand(command string) (string, error) {
-	_, err := ftp.controlConn.Write([]byte(command + "\r\n"))
-	if err != nil {
-		return "", fmt.Errorf("发送命令失败: %v", err)
+	if err := ftp.writeCommand(command); err != nil {
+		return "", err
 	}
 
 	// 读取服务器响应
@@ -76,20 +173,22 @@ func (ftp *FTPConn) SendCommand(command string) (string, error) {
 	return strings.TrimSpace(response), nil
 }
 
-// Close 关闭控制连接和数据连接
-func (ftp *FTPConn) Close() error {
-	if ftp.controlConn != nil {
-		ftp.controlConn.Close()
-		res, _ := ftp.readResponse()
-		MyLogger.Info("关闭控制连接:", res)
+// Command 发送命令并返回解析后的响应
+func (ftp *FTPConn) Command(command string) (Reply, error) {
+	response, err := ftp.SendCommand(command)
+	if err != nil {
+		return Reply{}, err
 	}
+	return ParseReply(response), nil
+}
+
+// Close 关闭数据连接，并发送QUIT关闭控制连接
+func (ftp *FTPConn) Close() error {
 	if ftp.dataConn != nil {
 		ftp.dataConn.Close()
-		res, _ := ftp.readResponse()
-		MyLogger.Info("关闭数据连接:", res)
+		ftp.dataConn = nil
 	}
-	// MyLogger.Info("成功关闭连接")
-	return nil
+	return ftp.Quit()
 }
 
 // Login 登录FTP服务器
@@ -110,23 +209,15 @@ func (ftp *FTPConn) Login(username, password string) error {
 	if !strings.HasPrefix(response, "230") {
 		return fmt.Errorf("登录失败: %s", response)
 	}
+	ftp.negotiateUTF8()
+	ftp.negotiateModeZ()
 	return nil
 }
 
 // ListFiles 获取指定路径下的文件列表
 func (ftp *FTPConn) ListFiles(path string) ([]string, error) {
-	// 建立数据连接
-	dataConn, err := ftp.establishDataConn()
-	if err != nil {
-		return nil, err
-	}
-	ftp.dataConn = dataConn
-	defer ftp.closeDataConn() // 确保数据连接关闭
-
-	// 发送LIST命令，附加路径参数
-	command := fmt.Sprintf("LIST %s", path)
-	_, err = ftp.SendCommand(command)
-	if err != nil {
+	// 建立数据连接并发送LIST命令，附加路径参数
+	if err := ftp.startTransfer(fmt.Sprintf("LIST %s", path)); err != nil {
 		return nil, fmt.Errorf("发送LIST命令失败: %v", err)
 	}
 
@@ -135,14 +226,18 @@ func (ftp *FTPConn) ListFiles(path string) ([]string, error) {
 	scanner := bufio.NewScanner(ftp.dataConn)
 	MyLogger.Info(fmt.Sprintf("目录 '%s' 下的文件列表:", path))
 	for scanner.Scan() {
-		line := scanner.Text()
+		line := ftp.decode(scanner.Text())
 		// MyLogger.Info(line)
 		files = append(files, line)
 	}
 
 	// 检查扫描是否出错
-	if err := scanner.Err(); err != nil {
-		return nil, fmt.Errorf("读取文件列表时出错: %v", err)
+	scanErr := scanner.Err()
+	if err := ftp.closeDataConn(); err != nil {
+		return nil, err
+	}
+	if scanErr != nil {
+		return nil, fmt.Errorf("读取文件列表时出错: %v", scanErr)
 	}
 
 	return files, nil
@@ -195,86 +290,98 @@ func (ftp *FTPConn) establishDataConn() (net.Conn, error) {
 		return nil, fmt.Errorf("解析PASV响应失败: %v", err)
 	}
 
-	dataConn, err := net.Dial("tcp", dataAddr)
+	dataConn, err := ftp.dial(dataAddr)
 	if err != nil {
 		return nil, fmt.Errorf("建立数据连接失败: %v", err)
 	}
+	if ftp.tlsConfig != nil {
+		dataConn = tls.Client(dataConn, ftp.tlsConfig)
+	}
 
-	fmt.Println("成功建立数据连接 ", dataAddr)
-	return dataConn, nil
+	MyLogger.Debug("成功建立数据连接", "addr", dataAddr)
+	return ftp.wrapDataConn(dataConn), nil
 }
 
-// closeDataConn
-func (ftp *FTPConn) closeDataConn() error {
-	if ftp.dataConn != nil {
-		ftp.dataConn.Close()
-		ftp.dataConn = nil
+// wrapDataConn 按全局和当前任务的限速包装数据连接，并统计任务进度。
+// MODE Z 下限速按压缩后的字节计算，进度按压缩前的字节计算
+func (ftp *FTPConn) wrapDataConn(conn net.Conn) net.Conn {
+	if ftp.job == nil {
+		conn = newThrottledConn(conn, GlobalLimiter)
+	} else {
+		conn = newThrottledConn(conn, GlobalLimiter, ftp.job.Limiter)
 	}
-	res, _ := ftp.readResponse() // 读取服务器响应
-	MyLogger.Info("关闭数据连接:", res)
-	return nil
+	if ftp.modeZ {
+		conn = newDeflateConn(conn, ftp.compressLevel)
+	}
+	if ftp.job == nil {
+		return conn
+	}
+	return &progressConn{Conn: conn, job: ftp.job}
 }
 
-// UploadFile 上传文件到服务器
-func (ftp *FTPConn) STOR(localPath, remotePath string) error {
-	// 切换到被动模式
-	dataconn, err := ftp.establishDataConn()
-	if err != nil {
-		return err
-	}
-	ftp.dataConn = dataconn
-	defer ftp.closeDataConn() // 确保数据连接关闭
+// startTransfer 建立数据连接并发送传输命令 (LIST/RETR/STOR 等)，
+// 服务器返回 1xx 后数据连接保存在 ftp.dataConn，传输结束后须调用 closeDataConn
+func (ftp *FTPConn) startTransfer(command string) error {
+	return ftp.startTransferAt(command, 0)
+}
 
-	// 发送STOR命令
-	_, err = ftp.SendCommand(fmt.Sprintf("STOR %s", remotePath))
+// startTransferAt 与 startTransfer 相同，offset 大于 0 时先发送 REST 从断点开始传输
+func (ftp *FTPConn) startTransferAt(command string, offset int64) error {
+	dataConn, err := ftp.establishDataConn()
 	if err != nil {
 		return err
 	}
-
-	// 打开本地文件并发送数据
-	file, err := os.Open(localPath)
-	if err != nil {
-		return fmt.Errorf("打开本地文件失败: %v", err)
+	if offset > 0 {
+		response, err := ftp.SendCommand(fmt.Sprintf("REST %d", offset))
+		if err != nil || !strings.HasPrefix(response, "350") {
+			dataConn.Close()
+			return fmt.Errorf("REST 命令失败: %v", response)
+		}
 	}
-	defer file.Close()
 
-	_, err = io.Copy(ftp.dataConn, file)
+	response, err := ftp.SendCommand(command)
 	if err != nil {
-		return fmt.Errorf("文件上传失败: %v", err)
+		dataConn.Close()
+		return err
+	}
+	if !strings.HasPrefix(response, "1") {
+		// 服务器拒绝了命令，不会再有传输完成的响应
+		dataConn.Close()
+		return fmt.Errorf("服务器拒绝传输: %s", response)
 	}
+	ftp.dataConn = dataConn
 	return nil
 }
 
-// DownloadFile 从服务器下载文件
-func (ftp *FTPConn) RETR(remotePath, localPath string) error {
-	// 切换到被动模式
-	dataConn, err := ftp.establishDataConn()
-	if err != nil {
-		return err
+// closeDataConn 关闭数据连接并读取传输结束的响应 (226/250)
+func (ftp *FTPConn) closeDataConn() error {
+	if ftp.dataConn != nil {
+		ftp.dataConn.Close()
+		ftp.dataConn = nil
 	}
-	ftp.dataConn = dataConn
-	defer ftp.closeDataConn() // 确保数据连接关闭
-
-	// 发送RETR命令
-	_, err = ftp.SendCommand(fmt.Sprintf("RETR %s", remotePath))
+	res, err := ftp.readResponse() // 读取服务器响应
 	if err != nil {
 		return err
 	}
-
-	// 保存接收到的数据到本地文件
-	file, err := os.Create(localPath)
-	if err != nil {
-		return fmt.Errorf("创建本地文件失败: %v", err)
-	}
-	defer file.Close()
-
-	_, err = io.Copy(file, ftp.dataConn)
-	if err != nil {
-		return fmt.Errorf("文件下载失败: %v", err)
+	MyLogger.Info("关闭数据连接:", res)
+	if !strings.HasPrefix(res, "2") {
+		return fmt.Errorf("传输未正确完成: %s", res)
 	}
 	return nil
 }
 
+// UploadFile 上传文件到服务器，远程文件已存在时按当前任务的冲突策略处理
+func (ftp *FTPConn) STOR(localPath, remotePath string) error {
+	_, err := PutFile(context.Background(), ftp, localPath, remotePath)
+	return err
+}
+
+// DownloadFile 从服务器下载文件，本地文件已存在时按当前任务的冲突策略处理
+func (ftp *FTPConn) RETR(remotePath, localPath string) error {
+	_, err := GetFile(context.Background(), ftp, remotePath, localPath)
+	return err
+}
+
 // MakeDirectory 在FTP服务器上创建新文件夹
 func (ftp *FTPConn) MakeDir(directoryName string) error {
 	// 发送MKD命令到服务器
@@ -319,172 +426,103 @@ func (ftp *FTPConn) Dele(target string, isDirectory bool) error {
 	return nil
 }
 
-func (ftp *FTPConn) SetBinaryMode() error {
-	response, err := ftp.SendCommand("TYPE I")
+// Rename 重命名或移动服务器上的文件 (RNFR/RNTO)
+func (ftp *FTPConn) Rename(from, to string) error {
+	response, err := ftp.SendCommand(fmt.Sprintf("RNFR %s", from))
 	if err != nil {
-		return fmt.Errorf("设置二进制模式失败: %v", err)
+		return fmt.Errorf("发送RNFR命令失败: %v", err)
+	}
+	if !strings.HasPrefix(response, "350") {
+		return fmt.Errorf("重命名失败: %s", response)
 	}
-	MyLogger.Info("TYPE 服务器响应:", response)
 
-	if !strings.HasPrefix(response, "200") {
-		return fmt.Errorf("设置二进制模式失败: %s", response)
+	response, err = ftp.SendCommand(fmt.Sprintf("RNTO %s", to))
+	if err != nil {
+		return fmt.Errorf("发送RNTO命令失败: %v", err)
+	}
+	MyLogger.Info("RNTO 服务器响应:", response)
+	if !strings.HasPrefix(response, "250") {
+		return fmt.Errorf("重命名失败: %s", response)
 	}
 	return nil
 }
 
-type Progress struct {
-	FileName   string `json:"fileName"`
-	Downloaded int64  `json:"downloaded"`
-	TotalSize  int64  `json:"totalSize"`
-}
-
-// ResumeDownload 恢复下载文件 TODO
-func (ftp *FTPClient) REST_RETR(remoteFile, localFile string, offset int64, c context.Context) error {
-
-	// 打开本地文件，准备写入（从断点开始）
-	file, err := os.OpenFile(localFile, os.O_CREATE|os.O_WRONLY, 0666)
+// ChangeDir 切换服务器上的当前目录 (CWD)
+func (ftp *FTPConn) ChangeDir(path string) error {
+	response, err := ftp.SendCommand(fmt.Sprintf("CWD %s", path))
 	if err != nil {
-		return fmt.Errorf("无法打开本地文件: %v", err)
+		return fmt.Errorf("发送CWD命令失败: %v", err)
 	}
-
-	// 设置文件写入的偏移量
-	if _, err := file.Seek(offset, 0); err != nil {
-		return fmt.Errorf("设置本地文件偏移量失败: %v", err)
+	if !strings.HasPrefix(response, "250") {
+		return fmt.Errorf("切换目录失败: %s", response)
 	}
+	return nil
+}
 
-	// change to binary mode
-	if err := ftp.SetBinaryMode(); err != nil {
-		return fmt.Errorf("设置二进制模式失败: %v", err)
+// CurrentDir 返回服务器上的当前目录 (PWD)
+func (ftp *FTPConn) CurrentDir() (string, error) {
+	response, err := ftp.SendCommand("PWD")
+	if err != nil {
+		return "", fmt.Errorf("发送PWD命令失败: %v", err)
 	}
-
-	// 发送 REST 命令指定恢复点
-	response, err := ftp.SendCommand(fmt.Sprintf("REST %d", offset))
-	if err != nil || !strings.HasPrefix(response, "350") {
-		return fmt.Errorf("REST 命令失败: %v", response)
+	if !strings.HasPrefix(response, "257") {
+		return "", fmt.Errorf("获取当前目录失败: %s", response)
 	}
-
-	// 发送 RETR 命令开始下载文件
-	response, err = ftp.SendCommand(fmt.Sprintf("RETR %s", remoteFile))
-	if err != nil || !strings.HasPrefix(response, "150") {
-		return fmt.Errorf("RETR 命令失败: %v", response)
+	// 257 "/path" is the current directory，路径中的 " 以 "" 转义
+	start := strings.Index(response, "\"")
+	end := strings.LastIndex(response, "\"")
+	if start == -1 || end <= start {
+		return "", fmt.Errorf("无效的PWD响应: %s", response)
 	}
+	return strings.ReplaceAll(response[start+1:end], "\"\"", "\""), nil
+}
 
-	// 建立数据连接
-	dataConn, err := ftp.establishDataConn()
+// Size 获取服务器上文件的大小 (SIZE)
+func (ftp *FTPConn) Size(path string) (int64, error) {
+	response, err := ftp.SendCommand(fmt.Sprintf("SIZE %s", path))
 	if err != nil {
-		return fmt.Errorf("数据连接建立失败: %v", err)
+		return 0, fmt.Errorf("发送SIZE命令失败: %v", err)
 	}
-	ftp.dataConn = dataConn
-	defer ftp.dataConn.Close() // 确保数据连接关闭
-
-	// 下载文件并反馈进度
-	buf := make([]byte, 4*1024*1024) // 每次读取
-	downloaded := offset             // 已下载的字节数，从偏移量开始
-	runtime.EventsEmit(c, "download-progress", Progress{
-		FileName:   remoteFile,
-		Downloaded: downloaded,
-	})
-	lastUpdateTime := time.Now()
-	complated := false
-
-	defer func() {
-		// 如果任务被取消，清理部分下载的文件
-		if ftp.ctx.Err() != nil {
-			// change to ascii mode
-			if err := ftp.SetAsciiMode(); err != nil {
-				fmt.Println("设置ASCII模式失败: ", err)
-			}
-			err = file.Close()
-			if err != nil {
-				fmt.Println("关闭文件失败: ", err)
-			}
-			ftp.dataConn.Close()
-			response, err = ftp.readResponse()
-			if err != nil {
-				fmt.Println("读取服务器响应失败: ", err)
-			}
-			fmt.Println("下载任务暂停，终止dataConn", response)
-		}
-	}()
-
-	for {
-		select {
-		case <-ftp.ctx.Done():
-			fmt.Println("下载任务被取消")
-			return fmt.Errorf("下载被取消: %v", ftp.ctx.Err())
-		default:
-			// 从数据连接中读取数据
-			n, readErr := ftp.dataConn.Read(buf)
-			if n > 0 {
-				// 写入本地文件
-				if _, writeErr := file.Write(buf[:n]); writeErr != nil {
-					return fmt.Errorf("写入文件失败: %v", writeErr)
-				}
-
-				// 更新已下载的字节数
-				downloaded += int64(n)
-				time.Sleep(2 * time.Second)
-
-				// 限制触发进度事件的频率
-				if downloaded%1024 == 0 || time.Since(lastUpdateTime) > time.Second {
-					runtime.EventsEmit(c, "download-progress", Progress{
-						FileName:   remoteFile,
-						Downloaded: downloaded,
-					})
-					lastUpdateTime = time.Now()
-				}
-			}
-
-			if readErr != nil {
-				if readErr == io.EOF {
-					fmt.Println("文件读取完成")
-					runtime.EventsEmit(c, "download-progress", Progress{
-						FileName:   remoteFile,
-						Downloaded: downloaded,
-					})
-					complated = true
-					// 检查服务器返回的结束状态码
-					response, err = ftp.readResponse()
-					if err != nil || !strings.HasPrefix(response, "226") {
-						return fmt.Errorf("下载未正确完成: %v", response)
-					}
-					// change to ascii mode
-					if err := ftp.SetAsciiMode(); err != nil {
-						return err
-					}
-					err = file.Close()
-					if err != nil {
-						return fmt.Errorf("关闭文件失败: %v", err)
-					}
-					fmt.Println("文件下载完成", remoteFile)
-					ftp.validateDataConn()
-					break
-				}
-				return fmt.Errorf("读取数据失败: %v", readErr)
-			}
-		}
-		if complated {
-			break
-		}
+	if !strings.HasPrefix(response, "213") {
+		return 0, fmt.Errorf("获取文件大小失败: %s", response)
 	}
-
-	return nil
+	size, err := strconv.ParseInt(strings.TrimSpace(response[3:]), 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("无效的SIZE响应: %s", response)
+	}
+	return size, nil
 }
 
-func GetDownloadedOffset(localFile string) (int64, error) {
-	// 检查本地文件是否存在
-	fileInfo, err := os.Stat(localFile)
+// ModTime 获取服务器上文件的修改时间 (MDTM)，返回 UTC 时间
+func (ftp *FTPConn) ModTime(path string) (time.Time, error) {
+	response, err := ftp.SendCommand(fmt.Sprintf("MDTM %s", path))
 	if err != nil {
-		if os.IsNotExist(err) {
-			// 文件不存在，说明尚未开始下载
-			return 0, nil
-		}
-		return 0, fmt.Errorf("无法获取本地文件信息: %v", err)
+		return time.Time{}, fmt.Errorf("发送MDTM命令失败: %v", err)
 	}
+	if !strings.HasPrefix(response, "213") {
+		return time.Time{}, fmt.Errorf("获取修改时间失败: %s", response)
+	}
+	// 部分服务器会带上毫秒，如 20240102150405.123
+	value := strings.TrimSpace(response[3:])
+	t, err := time.Parse("20060102150405", value)
+	if err != nil {
+		t, err = time.Parse("20060102150405.999999999", value)
+	}
+	if err != nil {
+		return time.Time{}, fmt.Errorf("无效的MDTM响应: %s", response)
+	}
+	return t, nil
+}
 
-	// 返回文件的大小作为偏移量
-	fmt.Println("文件名", fileInfo.Name(), "文件大小", fileInfo.Size())
-	return fileInfo.Size(), nil
+// Quit 发送QUIT并关闭控制连接
+func (ftp *FTPConn) Quit() error {
+	if ftp.controlConn == nil {
+		return nil
+	}
+	_, err := ftp.SendCommand("QUIT")
+	ftp.controlConn.Close()
+	ftp.controlConn = nil
+	return err
 }
 
 // ResumeUpload 恢复上传文件
@@ -548,20 +586,6 @@ func GetDownloadedOffset(localFile string) (int64, error) {
 // 	return nil
 // }
 
-// SetAsciiMode sets the FTP transfer mode to ASCII
-func (ftp *FTPClient) SetAsciiMode() error {
-	response, err := ftp.SendCommand("TYPE A")
-	if err != nil {
-		return fmt.Errorf("设置ASCII模式失败: %v", err)
-	}
-	MyLogger.Info("TYPE A服务器响应:", response)
-
-	if !strings.HasPrefix(response, "200") {
-		return fmt.Errorf("设置ASCII模式失败: %s", response)
-	}
-	return nil
-}
-
 func (ftp *FTPClient) validateDataConn() error {
 	if ftp.dataConn == nil {
 		return fmt.Errorf("数据连接已经关闭")
@@ -0,0 +1,227 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"changeme/internal/ftptest"
+)
+
+func TestMain(m *testing.M) {
+	// 测试的日志不写入仓库中的 log.log
+	dir, err := os.MkdirTemp("", "ftp-client-test-")
+	if err != nil {
+		panic(err)
+	}
+	logger, err := NewMySlogWriter("info", filepath.Join(dir, "test.log"), nil)
+	if err != nil {
+		panic(err)
+	}
+	MyLogger = logger
+	// 连接配置、传输记录和定时任务也写到临时目录
+	configDir = func() (string, error) { return dir, nil }
+	code := m.Run()
+	os.RemoveAll(dir)
+	os.Exit(code)
+}
+
+// newTestServer 启动带一个读写用户 (rw/123) 的测试服务器
+func newTestServer(t *testing.T) *ftptest.Server {
+	t.Helper()
+	srv := ftptest.NewServer()
+	t.Cleanup(srv.Close)
+	srv.AddUser(ftptest.User{Name: "rw", Password: "123"})
+	return srv
+}
+
+// dialTestServer 连接并登录测试服务器
+func dialTestServer(t *testing.T, srv *ftptest.Server) *FTPClient {
+	t.Helper()
+	client := NewFTPClient()
+	if err := client.Dial(srv.Addr); err != nil {
+		t.Fatal(err)
+	}
+	if err := client.Login("rw", "123"); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { client.Close() })
+	return client
+}
+
+func TestLoginFailure(t *testing.T) {
+	srv := newTestServer(t)
+	client := NewFTPClient()
+	if err := client.Dial(srv.Addr); err != nil {
+		t.Fatal(err)
+	}
+	defer client.Close()
+	if err := client.Login("rw", "wrong"); err == nil {
+		t.Fatal("login with a wrong password succeeded")
+	}
+}
+
+func TestListAndTransfer(t *testing.T) {
+	srv := newTestServer(t)
+	srv.WriteFile("/docs/readme.txt", []byte("hello world"))
+	srv.Mkdir("/docs/sub")
+	client := dialTestServer(t, srv)
+
+	entries, err := client.List("/docs")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 2 || entries[0].Name != "readme.txt" || entries[0].Size != 11 || !entries[1].IsDir() {
+		t.Fatalf("unexpected listing: %+v", entries)
+	}
+	if entries[0].Perms == nil || entries[0].Perms.Octal != "0644" {
+		t.Fatalf("unexpected permissions: %+v", entries[0].Perms)
+	}
+
+	dir := t.TempDir()
+	local := filepath.Join(dir, "readme.txt")
+	if err := DownloadFile(context.Background(), client, "/docs/readme.txt", local, 0, -1); err != nil {
+		t.Fatal(err)
+	}
+	if data, _ := os.ReadFile(local); string(data) != "hello world" {
+		t.Fatalf("downloaded %q", data)
+	}
+
+	// REST 续传只追加剩余部分
+	os.WriteFile(local, []byte("hello"), 0644)
+	if err := DownloadFile(context.Background(), client, "/docs/readme.txt", local, 5, -1); err != nil {
+		t.Fatal(err)
+	}
+	if data, _ := os.ReadFile(local); string(data) != "hello world" {
+		t.Fatalf("resumed download gave %q", data)
+	}
+
+	upload := filepath.Join(dir, "up.bin")
+	payload := bytes.Repeat([]byte("0123456789"), 10000)
+	os.WriteFile(upload, payload, 0644)
+	if err := UploadFile(context.Background(), client, upload, "/docs/sub/up.bin"); err != nil {
+		t.Fatal(err)
+	}
+	if data, err := srv.ReadFile("/docs/sub/up.bin"); err != nil || !bytes.Equal(data, payload) {
+		t.Fatalf("uploaded file differs (%d bytes, %v)", len(data), err)
+	}
+}
+
+func TestCancelTransfer(t *testing.T) {
+	srv := newTestServer(t)
+	client := dialTestServer(t, srv)
+	payload := bytes.Repeat([]byte("0123456789"), 100000)
+	srv.WriteFile("/big.bin", payload)
+	dir := t.TempDir()
+
+	// 限速到 32 KB/s，完整传输需要半分钟；取消后阻塞的读写立即返回，连接仍可使用
+	job := NewTransferJob("download", "big.bin", nil)
+	job.Limiter = NewRateLimiter(32 << 10)
+	defer job.Finish(nil)
+	transfer := func(fn func(ctx context.Context) error) {
+		t.Helper()
+		ctx, cancel := context.WithCancel(context.Background())
+		time.AfterFunc(200*time.Millisecond, cancel)
+		start := time.Now()
+		err := client.RunJob(job, func() error { return fn(ctx) })
+		if !errors.Is(err, context.Canceled) {
+			t.Fatalf("cancelled transfer returned %v", err)
+		}
+		if elapsed := time.Since(start); elapsed > 5*time.Second {
+			t.Fatalf("cancel took %v", elapsed)
+		}
+		if _, err := client.List("/"); err != nil {
+			t.Fatalf("list after cancel: %v", err)
+		}
+	}
+	local := filepath.Join(dir, "big.bin")
+	transfer(func(ctx context.Context) error {
+		return DownloadFile(ctx, client, "/big.bin", local, 0, -1)
+	})
+	upload := filepath.Join(dir, "up.bin")
+	os.WriteFile(upload, payload, 0644)
+	transfer(func(ctx context.Context) error {
+		return UploadFile(ctx, client, upload, "/up.bin")
+	})
+}
+
+func TestRemoveAllAndRename(t *testing.T) {
+	srv := newTestServer(t)
+	srv.WriteFile("/a/b/c.txt", []byte("c"))
+	srv.WriteFile("/a/d.txt", []byte("d"))
+	client := dialTestServer(t, srv)
+
+	if err := client.Rename("/a/d.txt", "/a/e.txt"); err != nil {
+		t.Fatal(err)
+	}
+	if !srv.Exists("/a/e.txt") || srv.Exists("/a/d.txt") {
+		t.Fatal("rename did not move the file")
+	}
+	if err := RemoveAll(client, "/a"); err != nil {
+		t.Fatal(err)
+	}
+	if srv.Exists("/a") {
+		t.Fatal("/a still exists")
+	}
+}
+
+func TestInjectedErrors(t *testing.T) {
+	srv := newTestServer(t)
+	srv.WriteFile("/f.txt", []byte("data"))
+	client := dialTestServer(t, srv)
+
+	srv.Handle(ftptest.Rule{Command: "RETR", Times: 1, Reply: "550 injected failure"})
+	_, err := client.Open("/f.txt", 0)
+	if err == nil || !strings.Contains(err.Error(), "injected failure") {
+		t.Fatalf("expected the injected RETR error, got %v", err)
+	}
+
+	// 规则用完后恢复正常
+	r, err := client.Open("/f.txt", 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	r.Close()
+
+	srv.Handle(ftptest.Rule{Command: "PASV", Times: 1, PASVAddress: "127.0.0.1:1"})
+	if _, err := client.List("/"); err == nil {
+		t.Fatal("expected an error for an unreachable PASV address")
+	}
+
+	srv.Handle(ftptest.Rule{Command: "FEAT", Reply: ftptest.MultiLine(211, "Features:", " SIZE", " MLST type*;size*;", "End")})
+	reply, err := client.Command("FEAT")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if reply.Code != 211 || len(reply.Lines) != 4 {
+		t.Fatalf("unexpected multi-line reply: %+v", reply)
+	}
+}
+
+func TestDelayedReply(t *testing.T) {
+	srv := newTestServer(t)
+	client := dialTestServer(t, srv)
+	srv.Handle(ftptest.Rule{Command: "PWD", Times: 1, Delay: 100 * time.Millisecond})
+	start := time.Now()
+	dir, err := client.CurrentDir()
+	if err != nil || dir != "/" {
+		t.Fatalf("PWD = %q, %v", dir, err)
+	}
+	if time.Since(start) < 100*time.Millisecond {
+		t.Fatal("reply was not delayed")
+	}
+}
+
+func TestDisconnect(t *testing.T) {
+	srv := newTestServer(t)
+	client := dialTestServer(t, srv)
+	srv.Handle(ftptest.Rule{Command: "LIST", Disconnect: true})
+	if _, err := client.List("/"); err == nil {
+		t.Fatal("expected an error after the server closed the connection")
+	}
+}
@@ -0,0 +1,188 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/wailsapp/wails/v2/pkg/runtime"
+)
+
+// ConsoleEntry 协议控制台中的一行记录
+type ConsoleEntry struct {
+	ID        uint64    `json:"id"`
+	Session   string    `json:"session"`
+	Direction string    `json:"direction"`
+	Line      string    `json:"line"`
+	Time      time.Time `json:"time"`
+	ElapsedMs float64   `json:"elapsedMs"`
+}
+
+// ConsolePage 一页控制台记录，按 ID 从旧到新排列
+type ConsolePage struct {
+	Entries []ConsoleEntry `json:"entries"`
+	HasMore bool           `json:"hasMore"` // 是否还有更早的记录
+}
+
+// ProtocolConsole 保存最近的控制连接交互 (有界环形缓冲区)，并实时推送给前端
+type ProtocolConsole struct {
+	mu      sync.Mutex
+	entries []ConsoleEntry
+	next    int    // 下一条写入的位置
+	full    bool   // 缓冲区是否已写满一圈
+	lastID  uint64 // 最近一条记录的 ID
+	ctx     context.Context
+}
+
+// NewProtocolConsole 创建容量为 capacity 的协议控制台
+func NewProtocolConsole(capacity int) *ProtocolConsole {
+	return &ProtocolConsole{entries: make([]ConsoleEntry, capacity)}
+}
+
+// SetContext 设置 Wails 上下文，之后每条记录都会以 "protocol-console" 事件推送
+func (c *ProtocolConsole) SetContext(ctx context.Context) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.ctx = ctx
+}
+
+// Append 记录一行协议数据
+func (c *ProtocolConsole) Append(session, direction, line string, elapsed time.Duration) {
+	if c == nil {
+		return
+	}
+	c.mu.Lock()
+	c.lastID++
+	entry := ConsoleEntry{
+		ID:        c.lastID,
+		Session:   session,
+		Direction: direction,
+		Line:      RedactCommand(line),
+		Time:      time.Now(),
+	}
+	if direction == TraceRecv {
+		entry.ElapsedMs = float64(elapsed.Microseconds()) / 1000
+	}
+	c.entries[c.next] = entry
+	c.next = (c.next + 1) % len(c.entries)
+	if c.next == 0 {
+		c.full = true
+	}
+	ctx := c.ctx
+	c.mu.Unlock()
+
+	if ctx != nil {
+		runtime.EventsEmit(ctx, "protocol-console", entry)
+	}
+}
+
+// Page 返回 ID 小于 before 的最近 limit 条记录；before 为 0 表示从最新开始，
+// session 非空时只返回该会话的记录
+func (c *ProtocolConsole) Page(session string, before uint64, limit int) ConsolePage {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if limit <= 0 {
+		limit = 100
+	}
+	size := c.next
+	if c.full {
+		size = len(c.entries)
+	}
+
+	var page ConsolePage
+	// 从最新一条往回遍历
+	for i := 0; i < size; i++ {
+		idx := (c.next - 1 - i + len(c.entries)) % len(c.entries)
+		entry := c.entries[idx]
+		if before != 0 && entry.ID >= before {
+			continue
+		}
+		if session != "" && entry.Session != session {
+			continue
+		}
+		if len(page.Entries) == limit {
+			page.HasMore = true
+			break
+		}
+		page.Entries = append(page.Entries, entry)
+	}
+	// 反转为从旧到新
+	for i, j := 0, len(page.Entries)-1; i < j; i, j = i+1, j-1 {
+		page.Entries[i], page.Entries[j] = page.Entries[j], page.Entries[i]
+	}
+	return page
+}
+
+// 需要数据连接的命令不能在控制台直接发送，否则数据连接和响应会错位
+var dataCommands = map[string]bool{
+	"LIST": true, "NLST": true, "MLSD": true, "RETR": true, "STOR": true,
+	"STOU": true, "APPE": true, "PASV": true, "EPSV": true, "PORT": true, "EPRT": true,
+}
+
+// stateCommands 改变客户端记录的连接状态 (MODE Z 压缩、续传位置、TLS 和数据连接保护、登录) 的命令，
+// 直接发送后客户端的记录与服务器不一致，之后的传输会出错
+var stateCommands = map[string]bool{
+	"MODE": true, "REST": true, "REIN": true,
+	"AUTH": true, "PBSZ": true, "PROT": true, "CCC": true,
+	"USER": true, "PASS": true, "ACCT": true,
+}
+
+// stateCommand 返回原始命令中会改变连接状态的部分，不改变时返回空字符串。
+// OPTS UTF8 切换文件名的字符集，其余 OPTS 不影响客户端
+func stateCommand(command string) string {
+	fields := strings.Fields(strings.ToUpper(command))
+	switch {
+	case len(fields) == 0:
+		return ""
+	case fields[0] == "OPTS" && len(fields) > 1 && fields[1] == "UTF8":
+		return "OPTS UTF8"
+	case stateCommands[fields[0]]:
+		return fields[0]
+	}
+	return ""
+}
+
+// RawCommand 发送用户输入的原始命令。命令可能用 TYPE 改变了服务器的传输类型，
+// 之后的传输会重新发送 TYPE，避免二进制文件按 ASCII 传输
+func (ftp *FTPConn) RawCommand(command string) (Reply, error) {
+	reply, err := ftp.Command(command)
+	ftp.transferType = ""
+	return reply, err
+}
+
+// ConsoleEntries 分页获取协议控制台记录，before 为 0 表示从最新开始
+func (a *App) ConsoleEntries(session string, before uint64, limit int) ConsolePage {
+	return MyConsole.Page(session, before, limit)
+}
+
+// SendRawCommand 通过会话的控制连接发送用户输入的原始命令 (如 SITE、STAT、HELP) 并返回解析后的响应
+func (a *App) SendRawCommand(sessionID, command string) (Reply, error) {
+	command = strings.TrimSpace(command)
+	if command == "" {
+		return Reply{}, fmt.Errorf("empty command")
+	}
+	verb := strings.ToUpper(strings.Fields(command)[0])
+	if dataCommands[verb] {
+		return Reply{}, fmt.Errorf("%s needs a data connection and cannot be sent from the console", verb)
+	}
+	if state := stateCommand(command); state != "" {
+		return Reply{}, fmt.Errorf("%s changes the connection state and cannot be sent from the console", state)
+	}
+
+	var reply Reply
+	err := withSession(sessionID, func(s *Session) (err error) {
+		if s.ftp == nil {
+			return fmt.Errorf("raw commands are only available on FTP connections")
+		}
+		reply, err = s.ftp.RawCommand(command)
+		return err
+	})
+	if err != nil {
+		MyLogger.Info("failed to send command: ", err)
+		return Reply{}, fmt.Errorf("failed to send command: %v", err)
+	}
+	return reply, nil
+}
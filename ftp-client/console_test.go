@@ -0,0 +1,70 @@
+package main
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestStateCommand(t *testing.T) {
+	tests := map[string]string{
+		"MODE Z":            "MODE",
+		"rest 100":          "REST",
+		"REIN":              "REIN",
+		"AUTH TLS":          "AUTH",
+		"prot p":            "PROT",
+		"PBSZ 0":            "PBSZ",
+		"USER other":        "USER",
+		"PASS secret":       "PASS",
+		"OPTS UTF8 ON":      "OPTS UTF8",
+		"opts utf8 off":     "OPTS UTF8",
+		"OPTS MLST type;":   "",
+		"SITE HELP":         "",
+		"STAT":              "",
+		"  ":                "",
+		"MODES":             "",
+		"HELP AUTH":         "",
+		"SITE CHMOD 644 /a": "",
+	}
+	for command, want := range tests {
+		if got := stateCommand(command); got != want {
+			t.Errorf("stateCommand(%q) = %q, want %q", command, got, want)
+		}
+	}
+}
+
+func TestRawStateCommands(t *testing.T) {
+	srv := newTestServer(t)
+	client := dialTestServer(t, srv)
+	refused := []string{"MODE S", "rest 100", "REIN", "AUTH TLS", "PBSZ 0", "PROT P", "OPTS UTF8 OFF", "USER other", "PASS secret"}
+
+	// 登录时发送的命令之后，被拒绝的命令都不会到达服务器
+	sent := len(srv.Received())
+	sh := NewShell(client, &bytes.Buffer{}, false)
+	for _, command := range refused {
+		if err := sh.Exec("quote " + command); err == nil {
+			t.Errorf("quote %s was sent", command)
+		}
+	}
+	if received := srv.Received()[sent:]; len(received) != 0 {
+		t.Fatalf("server received %v", received)
+	}
+
+	app := NewApp()
+	id, err := app.Connect(srv.Addr, "rw", "123")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer app.Disconnect(id)
+	sent = len(srv.Received())
+	for _, command := range append(refused, "MODE Z") {
+		if _, err := app.SendRawCommand(id, command); err == nil {
+			t.Errorf("%s was sent from the console", command)
+		}
+	}
+	if received := srv.Received()[sent:]; len(received) != 0 {
+		t.Fatalf("server received %v", received)
+	}
+	if reply, err := app.SendRawCommand(id, "SITE HELP"); err != nil || !reply.Positive() {
+		t.Fatalf("SITE HELP = %+v, %v", reply, err)
+	}
+}
@@ -0,0 +1,422 @@
+package main
+
+import (
+	"context"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+)
+
+// editDebounce 本地文件停止变化多久后上传，编辑器保存时通常会连续写入几次
+const editDebounce = 500 * time.Millisecond
+
+// 编辑会话的状态
+const (
+	EditOpen      = "open"      // 已下载并打开，等待修改
+	EditUploading = "uploading" // 正在上传修改
+	EditSynced    = "synced"    // 修改已上传
+	EditConflict  = "conflict"  // 远程文件在编辑期间被修改，等待用户选择
+	EditFailed    = "error"     // 上传失败，下次保存时重试
+	EditClosed    = "closed"
+)
+
+// ErrEditConflict 远程文件在上次同步后被其他人修改
+var ErrEditConflict = errors.New("远程文件已被修改")
+
+// EditSessionInfo 编辑会话的状态，也是 edit-session 事件的内容
+type EditSessionInfo struct {
+	ID         string    `json:"id"`
+	RemotePath string    `json:"remotePath"`
+	LocalPath  string    `json:"localPath"`
+	State      string    `json:"state"`
+	Uploads    int       `json:"uploads"`  // 已上传的次数
+	SyncedAt   time.Time `json:"syncedAt"` // 上次下载或上传的时间
+	Error      string    `json:"error,omitempty"`
+}
+
+// fileVersion 用于检测冲突的远程文件版本
+type fileVersion struct {
+	Size    int64
+	ModTime time.Time
+}
+
+func (v fileVersion) equal(o fileVersion) bool {
+	return v.Size == o.Size && v.ModTime.Equal(o.ModTime)
+}
+
+// remoteVersion 返回远程文件的大小和修改时间。FTP 使用 SIZE 和 MDTM，
+// 服务器不支持 SIZE 时退回到目录列表；文件不存在时错误满足 errors.Is(err, fs.ErrNotExist)
+func remoteVersion(rfs RemoteFS, p string) (fileVersion, error) {
+	type sizeModTimer interface {
+		Size(path string) (int64, error)
+		ModTime(path string) (time.Time, error)
+	}
+	if ftp, ok := rfs.(sizeModTimer); ok {
+		if size, err := ftp.Size(p); err == nil {
+			// MDTM 不是所有服务器都支持，此时只比较大小
+			mtime, _ := ftp.ModTime(p)
+			return fileVersion{Size: size, ModTime: mtime}, nil
+		}
+	}
+	e, err := rfs.Stat(p)
+	if err != nil {
+		return fileVersion{}, err
+	}
+	return fileVersion{Size: e.Size, ModTime: e.Time}, nil
+}
+
+// fileHash 返回本地文件内容的 sha256
+func fileHash(name string) ([sha256.Size]byte, error) {
+	var sum [sha256.Size]byte
+	f, err := os.Open(name)
+	if err != nil {
+		return sum, err
+	}
+	defer f.Close()
+	h := sha256.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return sum, err
+	}
+	copy(sum[:], h.Sum(nil))
+	return sum, nil
+}
+
+// EditSession 在本地编辑远程文件：文件下载到临时目录，保存后自动上传。
+// 每次同步都用 profile 建立新的连接，编辑期间控制连接空闲超时不会造成影响
+type EditSession struct {
+	mu      sync.Mutex
+	info    EditSessionInfo
+	profile Profile
+	dir     string
+	version fileVersion       // 上次同步时的远程版本
+	hash    [sha256.Size]byte // 上次同步时的本地内容
+	watcher *fsnotify.Watcher
+	notify  func(EditSessionInfo)
+	done    chan struct{}
+	stopped chan struct{}
+}
+
+// OpenEditSession 把 remotePath 下载到新的临时目录并开始监视本地文件。
+// notify 在状态变化时被调用，可以为 nil
+func OpenEditSession(id string, profile Profile, remotePath string, notify func(EditSessionInfo)) (*EditSession, error) {
+	dir, err := os.MkdirTemp("", "ftp-edit-")
+	if err != nil {
+		return nil, fmt.Errorf("创建临时目录失败: %v", err)
+	}
+	// 保留原文件名，系统按扩展名选择打开的程序
+	s := &EditSession{
+		info: EditSessionInfo{
+			ID:         id,
+			RemotePath: remotePath,
+			LocalPath:  filepath.Join(dir, path.Base(remotePath)),
+			State:      EditOpen,
+		},
+		profile: profile,
+		dir:     dir,
+		notify:  notify,
+		done:    make(chan struct{}),
+		stopped: make(chan struct{}),
+	}
+	if err := s.download(); err != nil {
+		os.RemoveAll(dir)
+		return nil, err
+	}
+	// 监视目录而不是文件：很多编辑器保存时先写新文件再重命名覆盖
+	watcher, err := fsnotify.NewWatcher()
+	if err == nil {
+		err = watcher.Add(dir)
+	}
+	if err != nil {
+		if watcher != nil {
+			watcher.Close()
+		}
+		os.RemoveAll(dir)
+		return nil, fmt.Errorf("监视本地文件失败: %v", err)
+	}
+	s.watcher = watcher
+	go s.watch()
+	return s, nil
+}
+
+// Info 返回会话当前的状态
+func (s *EditSession) Info() EditSessionInfo {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.info
+}
+
+// setState 更新状态并通知，调用者持有 s.mu
+func (s *EditSession) setState(state string, err error) {
+	s.info.State = state
+	s.info.Error = ""
+	if err != nil {
+		s.info.Error = err.Error()
+	}
+	if s.notify != nil {
+		s.notify(s.info)
+	}
+}
+
+// download 用远程文件覆盖本地文件，调用者持有 s.mu 或会话尚未开始监视
+func (s *EditSession) download() error {
+	rfs, err := s.profile.Open()
+	if err != nil {
+		return err
+	}
+	defer rfs.Close()
+	version, err := remoteVersion(rfs, s.info.RemotePath)
+	if err != nil {
+		return err
+	}
+	if err := DownloadFile(context.Background(), rfs, s.info.RemotePath, s.info.LocalPath, 0, version.Size); err != nil {
+		return err
+	}
+	hash, err := fileHash(s.info.LocalPath)
+	if err != nil {
+		return err
+	}
+	s.version = version
+	s.hash = hash
+	s.info.SyncedAt = time.Now()
+	return nil
+}
+
+// watch 在本地文件变化并稳定 editDebounce 后上传
+func (s *EditSession) watch() {
+	defer close(s.stopped)
+	var timer <-chan time.Time
+	for {
+		select {
+		case <-s.done:
+			return
+		case ev, ok := <-s.watcher.Events:
+			if !ok {
+				return
+			}
+			if filepath.Clean(ev.Name) == s.info.LocalPath && (ev.Has(fsnotify.Write) || ev.Has(fsnotify.Create)) {
+				timer = time.After(editDebounce)
+			}
+		case err, ok := <-s.watcher.Errors:
+			if !ok {
+				return
+			}
+			MyLogger.Info("edit: watcher error", "path", s.info.LocalPath, "error", err)
+		case <-timer:
+			timer = nil
+			if err := s.Sync(false); err != nil && !errors.Is(err, ErrEditConflict) {
+				MyLogger.Info("edit: failed to upload", "remote", s.info.RemotePath, "error", err)
+			}
+		}
+	}
+}
+
+// Sync 上传本地修改，内容与上次同步相同时不上传。远程文件在上次同步后被修改时
+// 进入冲突状态并返回 ErrEditConflict，force 为 true 时直接覆盖
+func (s *EditSession) Sync(force bool) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.info.State == EditClosed {
+		return nil
+	}
+	hash, err := fileHash(s.info.LocalPath)
+	if err != nil {
+		// 编辑器重命名保存的中间状态，等下一次事件
+		return nil
+	}
+	if hash == s.hash && !force {
+		return nil
+	}
+	if s.info.State == EditConflict && !force {
+		// 冲突解决前不再上传
+		return ErrEditConflict
+	}
+
+	s.setState(EditUploading, nil)
+	rfs, err := s.profile.Open()
+	if err != nil {
+		s.setState(EditFailed, err)
+		return err
+	}
+	defer rfs.Close()
+
+	if !force {
+		current, err := remoteVersion(rfs, s.info.RemotePath)
+		if err != nil && !errors.Is(err, fs.ErrNotExist) {
+			s.setState(EditFailed, err)
+			return err
+		}
+		// 远程文件被删除也算作冲突
+		if err != nil || !current.equal(s.version) {
+			MyLogger.Info("edit: remote file changed", "remote", s.info.RemotePath, "size", current.Size, "modTime", current.ModTime)
+			s.setState(EditConflict, ErrEditConflict)
+			return ErrEditConflict
+		}
+	}
+	if err := UploadFile(context.Background(), rfs, s.info.LocalPath, s.info.RemotePath); err != nil {
+		s.setState(EditFailed, err)
+		return err
+	}
+	version, err := remoteVersion(rfs, s.info.RemotePath)
+	if err != nil {
+		s.setState(EditFailed, err)
+		return err
+	}
+	s.version = version
+	s.hash = hash
+	s.info.Uploads++
+	s.info.SyncedAt = time.Now()
+	MyLogger.Info("edit: uploaded", "remote", s.info.RemotePath, "size", version.Size)
+	s.setState(EditSynced, nil)
+	return nil
+}
+
+// Reload 放弃本地修改，重新下载远程文件，用于解决冲突
+func (s *EditSession) Reload() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err := s.download(); err != nil {
+		s.setState(EditFailed, err)
+		return err
+	}
+	s.setState(EditSynced, nil)
+	return nil
+}
+
+// Close 停止监视并删除临时目录。discard 为 false 时先上传未同步的修改，
+// 上传失败或存在冲突时返回错误，会话保持打开
+func (s *EditSession) Close(discard bool) error {
+	if !discard {
+		if err := s.Sync(false); err != nil {
+			return err
+		}
+	}
+	s.mu.Lock()
+	if s.info.State == EditClosed {
+		s.mu.Unlock()
+		return nil
+	}
+	close(s.done)
+	s.watcher.Close()
+	s.setState(EditClosed, nil)
+	s.mu.Unlock()
+	<-s.stopped
+	return os.RemoveAll(s.dir)
+}
+
+// editRegistry 打开的编辑会话
+type editRegistry struct {
+	mu       sync.Mutex
+	sessions map[string]*EditSession
+	nextID   atomic.Uint64
+}
+
+var edits = &editRegistry{sessions: map[string]*EditSession{}}
+
+func (r *editRegistry) lookup(id string) (*EditSession, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	s, ok := r.sessions[id]
+	if !ok {
+		return nil, fmt.Errorf("edit session %s not found", id)
+	}
+	return s, nil
+}
+
+// EditRemote 下载远程文件并用系统默认程序打开，保存后自动上传。
+// 状态变化以 "edit-session" 事件推送，远程文件被他人修改时状态为 conflict
+func (a *App) EditRemote(sessionID, remotePath string) (EditSessionInfo, error) {
+	session, err := lookupSession(sessionID)
+	if err != nil {
+		return EditSessionInfo{}, err
+	}
+	id := fmt.Sprintf("edit-%d", edits.nextID.Add(1))
+	s, err := OpenEditSession(id, session.profile, remotePath, func(info EditSessionInfo) {
+		a.emit("edit-session", info)
+	})
+	if err != nil {
+		MyLogger.Info("failed to open edit session", "remote", remotePath, "error", err)
+		return EditSessionInfo{}, fmt.Errorf("failed to download %s: %v", remotePath, err)
+	}
+	edits.mu.Lock()
+	edits.sessions[id] = s
+	edits.mu.Unlock()
+
+	info := s.Info()
+	if err := openWithSystem(info.LocalPath); err != nil {
+		MyLogger.Info("failed to open: ", err)
+		s.Close(true)
+		edits.mu.Lock()
+		delete(edits.sessions, id)
+		edits.mu.Unlock()
+		return EditSessionInfo{}, fmt.Errorf("failed to open %s: %v", info.LocalPath, err)
+	}
+	MyLogger.Info("editing", "remote", remotePath, "local", info.LocalPath)
+	return info, nil
+}
+
+// EditSessions 返回打开的编辑会话
+func (a *App) EditSessions() []EditSessionInfo {
+	edits.mu.Lock()
+	defer edits.mu.Unlock()
+	infos := make([]EditSessionInfo, 0, len(edits.sessions))
+	for _, s := range edits.sessions {
+		infos = append(infos, s.Info())
+	}
+	return infos
+}
+
+// ResolveEditConflict 解决冲突：overwrite 为 true 时用本地文件覆盖远程文件，
+// 否则放弃本地修改并重新下载
+func (a *App) ResolveEditConflict(id string, overwrite bool) error {
+	s, err := edits.lookup(id)
+	if err != nil {
+		return err
+	}
+	if overwrite {
+		err = s.Sync(true)
+	} else {
+		err = s.Reload()
+	}
+	if err != nil {
+		return fmt.Errorf("failed to resolve conflict: %v", err)
+	}
+	return nil
+}
+
+// CloseEdit 关闭编辑会话并删除临时文件，discard 为 false 时先上传未同步的修改
+func (a *App) CloseEdit(id string, discard bool) error {
+	s, err := edits.lookup(id)
+	if err != nil {
+		return err
+	}
+	if err := s.Close(discard); err != nil {
+		return fmt.Errorf("failed to close edit session: %v", err)
+	}
+	edits.mu.Lock()
+	delete(edits.sessions, id)
+	edits.mu.Unlock()
+	return nil
+}
+
+// closeEdits 程序退出时关闭所有编辑会话；无法上传的会话保留临时文件，避免丢失修改
+func closeEdits() {
+	edits.mu.Lock()
+	defer edits.mu.Unlock()
+	for id, s := range edits.sessions {
+		if err := s.Close(false); err != nil {
+			MyLogger.Info("edit: keeping local copy", "local", s.info.LocalPath, "error", err)
+			continue
+		}
+		delete(edits.sessions, id)
+	}
+}
@@ -0,0 +1,4 @@
+import { ref } from "vue";
+
+// 当前标签页连接的会话 ID，由 Connect 或 ConnectProfile 返回，调用后端方法时传入
+export const currentSession = ref("");
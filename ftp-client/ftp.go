@@ -2,15 +2,15 @@ package main
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"net"
 )
 
 type FTPClient struct {
 	*FTPConn
 	DEFAULT_CONTROL_PORT int
 	DEFAULT_ADDR         string
-	ctx                  context.Context
-	cancel               context.CancelFunc
 }
 
 // NewFTPClient initializes a new FTP client
@@ -22,30 +22,48 @@ func NewFTPClient() *FTPClient {
 	}
 }
 
-// Connect to FTP server
-func (a *App) Connect(address, username, password string) error {
-	err := a.ftp.Dial(address)
+// Connect to FTP server and return the ID of the new session
+// An empty password is looked up in FTP_USER/FTP_PASSWORD and ~/.netrc
+func (a *App) Connect(address, username, password string) (string, error) {
+	host, _, err := net.SplitHostPort(address)
+	if err != nil {
+		host = address
+	}
+	username, password, err = ResolveCredentials(host, username, password)
+	if err != nil {
+		MyLogger.Info("failed to read credentials: ", err)
+		return "", fmt.Errorf("failed to read credentials: %v", err)
+	}
+
+	client := NewFTPClient()
+	err = client.Dial(address)
 	if err != nil {
 		MyLogger.Info("failed to connect", err)
-		return fmt.Errorf("failed to connect: %v", err)
+		return "", fmt.Errorf("failed to connect: %v", err)
 	}
-	MyLogger.Info("password ", password)
-	if err := a.ftp.Login(username, password); err != nil {
+	if err := client.Login(username, password); err != nil {
+		client.Quit()
 		MyLogger.Info("failed to login: ", err)
-		return fmt.Errorf("failed to login: %v", err)
+		return "", fmt.Errorf("failed to login: %v", err)
 	}
+	s := addSession(client, client, Profile{Protocol: ProtocolFTP, Address: address, Username: username, Password: password})
+	MyLogger.Info("connected", "session", s.ID, "address", address)
 
-	return nil
+	return s.ID, nil
 }
 
 // List files and directories
-func (a *App) List(path string) ([]string, error) {
-	if a.ftp.controlConn == nil {
-		MyLogger.Info("not connected")
-		return nil, fmt.Errorf("not connected")
-	}
-
-	entries, err := a.ftp.ListFiles(path)
+func (a *App) List(sessionID, path string) ([]Entry, error) {
+	var entries []Entry
+	err := withSession(sessionID, func(s *Session) error {
+		job := a.startTransfer("list", path)
+		err := s.fs.RunJob(job, func() (err error) {
+			entries, err = s.fs.List(path)
+			return err
+		})
+		job.Finish(err)
+		return err
+	})
 	if err != nil {
 		MyLogger.Info("failed to list directory: ", err)
 		return nil, fmt.Errorf("failed to list directory: %v", err)
@@ -55,13 +73,46 @@ func (a *App) List(path string) ([]string, error) {
 }
 
 // Upload file
-func (a *App) Upload(localFile, remotePath string) error {
-	if a.ftp.controlConn == nil {
-		MyLogger.Info("not connected")
-		return fmt.Errorf("not connected")
+// An existing remote file is handled by the conflict policy, transferType is auto/ascii/binary,
+// "" uses the default policy or type
+func (a *App) Upload(sessionID, localFile, remotePath, conflict, transferType string) error {
+	policy, err := conflictOrDefault(conflict)
+	if err != nil {
+		return err
 	}
-
-	if err := a.ftp.STOR(localFile, remotePath); err != nil {
+	typ, err := typeOrDefault(transferType)
+	if err != nil {
+		return err
+	}
+	err = withSession(sessionID, func(s *Session) error {
+		ctx, cancel := context.WithCancel(context.Background())
+		s.setCancel(cancel)
+		defer s.setCancel(nil)
+		defer cancel()
+
+		job := a.startTransfer("upload", remotePath)
+		job.Conflict = policy
+		job.Type = typ
+		job.ask = func(c Conflict) (ConflictPolicy, error) {
+			return a.askConflict(ctx, c)
+		}
+		target := remotePath
+		err := s.fs.RunJob(job, func() error {
+			saved, err := PutFile(ctx, s.fs, localFile, remotePath)
+			if saved != "" {
+				target = saved
+			}
+			return err
+		})
+		job.Finish(err)
+		s.record("upload", job, target, localFile, err)
+		return err
+	})
+	if errors.Is(err, ErrSkipped) {
+		MyLogger.Info("upload skipped", "remote", remotePath)
+		return nil
+	}
+	if err != nil {
 		MyLogger.Info("failed to upload file: %v", err)
 		return fmt.Errorf("failed to upload file: %v", err)
 	}
@@ -69,56 +120,80 @@ func (a *App) Upload(localFile, remotePath string) error {
 }
 
 // Download file
-func (a *App) Download(remotePath, localPath string, size int64) error {
-	if a.ftp.controlConn == nil {
-		MyLogger.Info("not connected")
-		return fmt.Errorf("not connected")
-	}
-
-	if a.ftp.ctx == nil {
-		a.ftp.ctx, a.ftp.cancel = context.WithCancel(context.Background())
-	} else {
-		a.ftp.ctx, a.ftp.cancel = context.WithCancel(context.Background())
+// An existing local file is handled by the conflict policy (resume, overwrite, ask...), transferType is
+// auto/ascii/binary, "" uses the default policy or type
+// size is only a hint from the listing, the policies use the size reported by the server
+func (a *App) Download(sessionID, remotePath, localPath string, size int64, conflict, transferType string) error {
+	policy, err := conflictOrDefault(conflict)
+	if err != nil {
+		return err
 	}
-
-	// 获取本地文件大小
-	localFileSize, err := GetDownloadedOffset(localPath)
+	typ, err := typeOrDefault(transferType)
 	if err != nil {
-		MyLogger.Info("获取本地文件大小失败: ", err)
 		return err
 	}
-
-	// 恢复下载
-	err = a.ftp.REST_RETR(remotePath, localPath, localFileSize, a.ctx)
+	target := localPath
+	err = withSession(sessionID, func(s *Session) error {
+		ctx, cancel := context.WithCancel(context.Background())
+		s.setCancel(cancel)
+		defer s.setCancel(nil)
+		defer cancel()
+
+		job := a.startTransfer("download", remotePath)
+		job.Conflict = policy
+		job.Type = typ
+		job.ask = func(c Conflict) (ConflictPolicy, error) {
+			return a.askConflict(ctx, c)
+		}
+		err := s.fs.RunJob(job, func() error {
+			saved, err := GetFile(ctx, s.fs, remotePath, localPath)
+			if saved != "" {
+				target = saved
+			}
+			return err
+		})
+		job.Finish(err)
+		s.record("download", job, remotePath, target, err)
+		return err
+	})
+	if errors.Is(err, ErrSkipped) {
+		MyLogger.Info("download skipped", "local", localPath)
+		return nil
+	}
 	if err != nil {
-		MyLogger.Info("恢复下载失败: ", err)
+		MyLogger.Info("下载失败: ", err)
 		return err
 	}
+	if target != localPath {
+		MyLogger.Info("downloaded under a new name", "local", target)
+	}
 
 	return nil
 }
 
-func (a *App) StopDownload() error {
-	if a.ftp.controlConn == nil {
+// StopDownload cancels the download or upload running in the session
+func (a *App) StopDownload(sessionID string) error {
+	s, err := lookupSession(sessionID)
+	if err != nil {
 		MyLogger.Info("not connected")
-		return fmt.Errorf("not connected")
+		return err
 	}
-	if a.ftp.cancel != nil {
-		fmt.Println("cancel")
-		a.ftp.cancel()
-		a.ftp.cancel = nil
+	s.cancelMu.Lock()
+	if s.cancel != nil {
+		s.cancel()
+		s.cancel = nil
 	}
+	s.cancelMu.Unlock()
 
 	return nil
 }
 
 // Create folder
-func (a *App) CreateFolder(path string) error {
-	if a.ftp.controlConn == nil {
-		return fmt.Errorf("not connected")
-	}
-
-	if err := a.ftp.MakeDir(path); err != nil {
+func (a *App) CreateFolder(sessionID, path string) error {
+	err := withSession(sessionID, func(s *Session) error {
+		return s.fs.Mkdir(path)
+	})
+	if err != nil {
 		MyLogger.Info("failed to create folder: ", err)
 		return fmt.Errorf("failed to create folder: %v", err)
 	}
@@ -126,22 +201,45 @@ func (a *App) CreateFolder(path string) error {
 }
 
 // Delete folder or file
-func (a *App) Delete(path string) error {
-	if a.ftp.controlConn == nil {
-		return fmt.Errorf("not connected")
-	}
-
-	if err := a.ftp.Dele(path, false); err != nil {
+func (a *App) Delete(sessionID, path string) error {
+	err := withSession(sessionID, func(s *Session) error {
+		return s.fs.Remove(path)
+	})
+	if err != nil {
 		MyLogger.Info("failed to delete: ", err)
 		return fmt.Errorf("failed to delete: %v", err)
 	}
 	return nil
 }
 
-// Disconnect from FTP server
-func (a *App) Disconnect() error {
-	if a.ftp.controlConn != nil {
-		return a.ftp.Close()
+// Rename file or folder
+func (a *App) Rename(sessionID, from, to string) error {
+	err := withSession(sessionID, func(s *Session) error {
+		return s.fs.Rename(from, to)
+	})
+	if err != nil {
+		MyLogger.Info("failed to rename: ", err)
+		return fmt.Errorf("failed to rename: %v", err)
 	}
 	return nil
 }
+
+// Stat returns the entry of a single file or folder
+func (a *App) Stat(sessionID, path string) (Entry, error) {
+	var entry Entry
+	err := withSession(sessionID, func(s *Session) (err error) {
+		entry, err = s.fs.Stat(path)
+		return err
+	})
+	return entry, err
+}
+
+// startTransfer 创建传输任务并通知前端任务 ID，前端可据此调整该任务的限速；
+// 任务进度以 "transfer-progress" 事件推送
+func (a *App) startTransfer(kind, name string) *TransferJob {
+	job := NewTransferJob(kind, name, func(p TransferProgress) {
+		a.emit("transfer-progress", p)
+	})
+	a.emit("transfer-started", job)
+	return job
+}
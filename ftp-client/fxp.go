@@ -0,0 +1,235 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ErrFXPRefused 服务器不允许与其他主机之间的数据连接 (未开启 FXP)
+var ErrFXPRefused = errors.New("服务器不允许FXP传输")
+
+// fxpAbortTimeout 出错时等待服务器响应 ABOR 的最长时间
+const fxpAbortTimeout = 5 * time.Second
+
+// FXPResult 服务器之间传输的结果，包含两端控制连接上的完成响应
+type FXPResult struct {
+	Source string `json:"source"` // 源服务器 RETR 的完成响应
+	Target string `json:"target"` // 目标服务器 STOR 的完成响应
+	Size   int64  `json:"size"`   // 源文件大小，-1 表示未知
+}
+
+// formatPORTAddress 把 PASV 返回的 ip:port 转换为 PORT 参数 h1,h2,h3,h4,p1,p2
+func formatPORTAddress(addr string) (string, error) {
+	host, portStr, err := net.SplitHostPort(addr)
+	if err != nil {
+		return "", err
+	}
+	ip := net.ParseIP(host).To4()
+	if ip == nil {
+		return "", fmt.Errorf("PORT 只支持 IPv4 地址: %s", host)
+	}
+	port, err := strconv.Atoi(portStr)
+	if err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("%d,%d,%d,%d,%d,%d", ip[0], ip[1], ip[2], ip[3], port>>8, port&0xff), nil
+}
+
+// FXP 在两台服务器之间直接传输文件，数据不经过本机：
+// 目标服务器 PASV 监听，源服务器 PORT 到该地址，先向目标发送 STOR，再向源发送 RETR
+func FXP(src *FTPConn, srcPath string, dst *FTPConn, dstPath string) (FXPResult, error) {
+	result := FXPResult{Size: -1}
+	if src.tlsConfig != nil || dst.tlsConfig != nil {
+		return result, fmt.Errorf("FXP 暂不支持加密的数据连接")
+	}
+	if size, err := src.Size(srcPath); err == nil {
+		result.Size = size
+	}
+	// 数据在两台服务器之间直接传输，只有一端压缩时压缩的一端临时改用流模式，结束后恢复
+	if src.modeZ != dst.modeZ {
+		compressed := src
+		if dst.modeZ {
+			compressed = dst
+		}
+		if err := compressed.setStreamMode(); err != nil {
+			return result, err
+		}
+		defer compressed.resumeModeZ()
+	}
+	if err := src.SetBinaryMode(); err != nil {
+		return result, err
+	}
+	if err := dst.SetBinaryMode(); err != nil {
+		return result, err
+	}
+
+	response, err := dst.SendCommand("PASV")
+	if err != nil {
+		return result, fmt.Errorf("目标服务器 PASV 失败: %v", err)
+	}
+	dataAddr, err := parsePASVResponse(response)
+	if err != nil {
+		return result, fmt.Errorf("目标服务器 PASV 失败: %v", err)
+	}
+	portArg, err := formatPORTAddress(dataAddr)
+	if err != nil {
+		return result, err
+	}
+	response, err = src.SendCommand("PORT " + portArg)
+	if err != nil {
+		return result, fmt.Errorf("源服务器 PORT 失败: %v", err)
+	}
+	if !strings.HasPrefix(response, "2") {
+		return result, fmt.Errorf("%w: 源服务器拒绝连接到目标服务器 %s (%s)", ErrFXPRefused, dataAddr, response)
+	}
+
+	// 目标服务器可能要等数据连接建立后才回复 150，因此先只发送 STOR
+	if err := dst.writeCommand("STOR " + dstPath); err != nil {
+		return result, err
+	}
+	response, err = src.SendCommand("RETR " + srcPath)
+	if err != nil {
+		dst.abortTransfer()
+		return result, err
+	}
+	if !strings.HasPrefix(response, "1") {
+		dst.abortTransfer()
+		if strings.HasPrefix(response, "425") {
+			return result, fmt.Errorf("%w: 源服务器无法连接目标服务器 %s (%s)", ErrFXPRefused, dataAddr, response)
+		}
+		return result, fmt.Errorf("源服务器拒绝传输: %s", response)
+	}
+
+	response, err = dst.readResponse()
+	if err != nil {
+		src.abortTransfer()
+		return result, fmt.Errorf("读取目标服务器响应失败: %v", err)
+	}
+	if !strings.HasPrefix(response, "1") {
+		src.abortTransfer()
+		if strings.HasPrefix(response, "425") {
+			return result, fmt.Errorf("%w: 目标服务器拒绝来自源服务器的数据连接 (%s)", ErrFXPRefused, response)
+		}
+		return result, fmt.Errorf("目标服务器拒绝传输: %s", response)
+	}
+
+	// 两端各自报告传输完成
+	srcErr := fxpFinalReply(src, &result.Source)
+	dstErr := fxpFinalReply(dst, &result.Target)
+	if srcErr != nil {
+		return result, fmt.Errorf("源服务器: %v", srcErr)
+	}
+	if dstErr != nil {
+		return result, fmt.Errorf("目标服务器: %v", dstErr)
+	}
+	return result, nil
+}
+
+// fxpFinalReply 读取传输结束的响应 (226/250)
+func fxpFinalReply(ftp *FTPConn, reply *string) error {
+	response, err := ftp.readResponse()
+	if err != nil {
+		return err
+	}
+	*reply = response
+	if !strings.HasPrefix(response, "2") {
+		return fmt.Errorf("传输未正确完成: %s", response)
+	}
+	return nil
+}
+
+// abortTransfer 发送 ABOR 放弃已发出的传输命令并读取剩余响应；
+// 服务器没有及时回应时关闭控制连接，避免之后的命令读到错位的响应
+func (ftp *FTPConn) abortTransfer() {
+	if ftp.controlConn == nil {
+		return
+	}
+	ftp.controlConn.SetReadDeadline(time.Now().Add(fxpAbortTimeout))
+	defer func() {
+		if ftp.controlConn != nil {
+			ftp.controlConn.SetReadDeadline(time.Time{})
+		}
+	}()
+	if err := ftp.writeCommand("ABOR"); err == nil {
+		for {
+			response, err := ftp.readResponse()
+			if err != nil {
+				break
+			}
+			// 225/226 为 ABOR 的最终响应，5xx 表示服务器不认识 ABOR
+			if strings.HasPrefix(response, "225") || strings.HasPrefix(response, "226") || strings.HasPrefix(response, "5") {
+				return
+			}
+		}
+	}
+	MyLogger.Info("ABOR 没有响应，关闭控制连接")
+	ftp.controlConn.Close()
+	ftp.controlConn = nil
+}
+
+// FXPSession 用于服务器之间传输的两个会话
+type FXPSession struct {
+	Source *FTPClient
+	Target *FTPClient
+}
+
+// Copy 把源服务器上的文件直接传输到目标服务器
+func (s *FXPSession) Copy(srcPath, dstPath string) (FXPResult, error) {
+	if s.Source.controlConn == nil || s.Target.controlConn == nil {
+		return FXPResult{}, fmt.Errorf("not connected")
+	}
+	return FXP(s.Source.FTPConn, srcPath, s.Target.FTPConn, dstPath)
+}
+
+// Close 断开两个会话
+func (s *FXPSession) Close() {
+	s.Source.Quit()
+	s.Target.Quit()
+}
+
+// fxpJob 在 job 下用 FXP 传输文件；数据不经过本机，完成后一次性记为已传输
+func fxpJob(job *TransferJob, src *FTPConn, srcPath string, dst *FTPConn, dstPath string) (FXPResult, error) {
+	result, err := FXP(src, srcPath, dst, dstPath)
+	if err == nil && result.Size > 0 {
+		job.Resume(result.Size)
+	}
+	return result, err
+}
+
+// FXPCopy 在两个 FTP 会话的服务器之间直接传输文件，结束时发送 transfer-progress 事件
+func (a *App) FXPCopy(srcSessionID, dstSessionID, srcPath, dstPath string) (FXPResult, error) {
+	src, err := lookupSession(srcSessionID)
+	if err != nil {
+		return FXPResult{}, err
+	}
+	dst, err := lookupSession(dstSessionID)
+	if err != nil {
+		return FXPResult{}, err
+	}
+	if src.ftp == nil || dst.ftp == nil {
+		return FXPResult{}, fmt.Errorf("fxp needs two FTP sessions")
+	}
+	if src == dst {
+		return FXPResult{}, fmt.Errorf("fxp needs two different sessions, use CopyBetween to copy within a server")
+	}
+	unlock := lockSessions(src, dst)
+	defer unlock()
+
+	job := a.startTransfer("fxp", srcPath)
+	job.SetFile(dstPath)
+	if size, err := src.ftp.Size(srcPath); err == nil {
+		job.AddTotal(size)
+	}
+	result, err := fxpJob(job, src.ftp.FTPConn, srcPath, dst.ftp.FTPConn, dstPath)
+	job.Finish(err)
+	if err != nil {
+		MyLogger.Info("fxp failed", "src", srcPath, "dst", dstPath, "error", err)
+		return result, fmt.Errorf("fxp failed: %v", err)
+	}
+	MyLogger.Info("fxp finished", "src", srcPath, "dst", dstPath, "source", result.Source, "target", result.Target)
+	return result, nil
+}
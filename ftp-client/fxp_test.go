@@ -0,0 +1,128 @@
+package main
+
+import (
+	"strings"
+	"testing"
+
+	"changeme/internal/ftptest"
+)
+
+// received 返回服务器收到的以 prefix 开头的命令
+func received(srv *ftptest.Server, prefix string) []string {
+	var cmds []string
+	for _, cmd := range srv.Received() {
+		if strings.HasPrefix(cmd, prefix) {
+			cmds = append(cmds, cmd)
+		}
+	}
+	return cmds
+}
+
+func TestFXPCopy(t *testing.T) {
+	src := newTestServer(t)
+	src.WriteFile("/data.bin", []byte("server to server"))
+	dst := newTestServer(t)
+	app := NewApp()
+	srcID, err := app.Connect(src.Addr, "rw", "123")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer app.Disconnect(srcID)
+	dstID, err := app.Connect(dst.Addr, "rw", "123")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer app.Disconnect(dstID)
+
+	result, err := app.FXPCopy(srcID, dstID, "/data.bin", "/copy.bin")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if data, _ := dst.ReadFile("/copy.bin"); string(data) != "server to server" || result.Size != 16 {
+		t.Fatalf("fxp copied %q, result %+v", data, result)
+	}
+	if len(received(src, "PORT ")) != 1 || len(received(dst, "PASV")) != 1 {
+		t.Fatalf("source received %v, target received %v", src.Received(), dst.Received())
+	}
+
+	if _, err := app.FXPCopy(srcID, srcID, "/data.bin", "/again.bin"); err == nil {
+		t.Fatal("fxp within one session succeeded")
+	}
+	if _, err := app.FXPCopy(srcID, "missing", "/data.bin", "/again.bin"); err == nil {
+		t.Fatal("fxp to an unknown session succeeded")
+	}
+}
+
+func TestCopyBetweenFXP(t *testing.T) {
+	src := newTestServer(t)
+	src.WriteFile("/data.bin", []byte("copy me"))
+	dst := newTestServer(t)
+	app := NewApp()
+	srcID, err := app.Connect(src.Addr, "rw", "123")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer app.Disconnect(srcID)
+	dstID, err := app.Connect(dst.Addr, "rw", "123")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer app.Disconnect(dstID)
+
+	// 两端都是 FTP 时通过 FXP 复制
+	if err := app.CopyBetween(srcID, "/data.bin", dstID, "/fxp.bin"); err != nil {
+		t.Fatal(err)
+	}
+	if data, _ := dst.ReadFile("/fxp.bin"); string(data) != "copy me" || len(received(src, "PORT ")) != 1 {
+		t.Fatalf("copied %q, source received %v", data, src.Received())
+	}
+
+	// 服务器不允许 FXP 时经本机复制
+	src.Handle(ftptest.Rule{Command: "PORT", Times: 1, Reply: "500 Illegal PORT command"})
+	if err := app.CopyBetween(srcID, "/data.bin", dstID, "/relay.bin"); err != nil {
+		t.Fatal(err)
+	}
+	if data, _ := dst.ReadFile("/relay.bin"); string(data) != "copy me" {
+		t.Fatalf("relayed %q", data)
+	}
+}
+
+func TestFXPModeZ(t *testing.T) {
+	src := newTestServer(t)
+	src.Features = append(src.Features, "MODE Z")
+	src.WriteFile("/data.bin", []byte("compressed source"))
+	dst := newTestServer(t)
+
+	from := NewFTPClient()
+	if err := from.SetCompression(true, 0); err != nil {
+		t.Fatal(err)
+	}
+	if err := from.Dial(src.Addr); err != nil {
+		t.Fatal(err)
+	}
+	defer from.Close()
+	if err := from.Login("rw", "123"); err != nil {
+		t.Fatal(err)
+	}
+	to := dialTestServer(t, dst)
+	if !from.Compressed() || to.Compressed() {
+		t.Fatalf("compressed: source %v, target %v", from.Compressed(), to.Compressed())
+	}
+
+	// 只有源服务器压缩时，源在传输期间改用流模式，之后恢复 MODE Z
+	if _, err := FXP(from.FTPConn, "/data.bin", to.FTPConn, "/copy.bin"); err != nil {
+		t.Fatal(err)
+	}
+	if data, _ := dst.ReadFile("/copy.bin"); string(data) != "compressed source" {
+		t.Fatalf("fxp copied %q", data)
+	}
+	if !from.Compressed() {
+		t.Fatal("MODE Z was not restored on the source")
+	}
+	if modes := received(src, "MODE"); len(modes) != 3 || modes[1] != "MODE S" || modes[2] != "MODE Z" {
+		t.Fatalf("source received %v", modes)
+	}
+	if len(received(dst, "MODE")) != 0 {
+		t.Fatalf("target received %v", dst.Received())
+	}
+}
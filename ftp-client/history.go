@@ -0,0 +1,391 @@
+package main
+
+import (
+	"context"
+	"encoding/binary"
+	"encoding/csv"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/wailsapp/wails/v2/pkg/runtime"
+	bolt "go.etcd.io/bbolt"
+)
+
+// 传输记录的结果
+const (
+	HistoryOK       = "ok"
+	HistoryFailed   = "failed"
+	HistoryCanceled = "canceled"
+	HistorySkipped  = "skipped" // 目标已存在，按冲突策略跳过
+)
+
+// TransferRecord 一次传输的记录
+type TransferRecord struct {
+	ID         uint64    `json:"id"`
+	Kind       string    `json:"kind"`              // upload / download / copy
+	Server     string    `json:"server"`            // host:port
+	Profile    string    `json:"profile,omitempty"` // 连接的配置名称，直接连接时为空
+	RemotePath string    `json:"remotePath"`
+	LocalPath  string    `json:"localPath,omitempty"`
+	Target     string    `json:"target,omitempty"` // copy 的目标，server:path
+	Size       int64     `json:"size"`             // 文件大小，续传时包括之前的部分；失败时为已传输的字节数
+	Started    time.Time `json:"started"`
+	Duration   float64   `json:"duration"` // 秒
+	Speed      float64   `json:"speed"`    // 平均速度，字节/秒
+	Checksum   string    `json:"checksum,omitempty"`
+	Status     string    `json:"status"` // ok / failed / canceled / skipped
+	Error      string    `json:"error,omitempty"`
+}
+
+// HistoryQuery 查询传输记录的条件，零值表示不限制
+type HistoryQuery struct {
+	From   time.Time `json:"from"`
+	To     time.Time `json:"to"`
+	Server string    `json:"server"` // 匹配 Server 或 Profile 的一部分，不区分大小写
+	Status string    `json:"status"`
+	Limit  int       `json:"limit"`
+}
+
+// match 判断记录是否满足条件
+func (q HistoryQuery) match(r TransferRecord) bool {
+	if !q.From.IsZero() && r.Started.Before(q.From) {
+		return false
+	}
+	if !q.To.IsZero() && !r.Started.Before(q.To) {
+		return false
+	}
+	if q.Status != "" && r.Status != q.Status {
+		return false
+	}
+	if q.Server != "" {
+		s := strings.ToLower(q.Server)
+		if !strings.Contains(strings.ToLower(r.Server), s) && !strings.Contains(strings.ToLower(r.Profile), s) {
+			return false
+		}
+	}
+	return true
+}
+
+var (
+	historyBucket = []byte("transfers")
+	runsBucket    = []byte("schedule-runs") // 定时任务的运行记录
+)
+
+// History 保存在 bbolt 数据库中的传输记录，键为递增的 ID
+type History struct {
+	db *bolt.DB
+}
+
+// OpenHistory 打开或创建记录数据库。数据库被其他进程 (如正在运行的界面) 占用时等待 1 秒后返回错误
+func OpenHistory(path string) (*History, error) {
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return nil, err
+	}
+	db, err := bolt.Open(path, 0600, &bolt.Options{Timeout: time.Second})
+	if err != nil {
+		return nil, fmt.Errorf("打开传输记录 %s 失败: %v", path, err)
+	}
+	err = db.Update(func(tx *bolt.Tx) error {
+		if _, err := tx.CreateBucketIfNotExists(historyBucket); err != nil {
+			return err
+		}
+		_, err := tx.CreateBucketIfNotExists(runsBucket)
+		return err
+	})
+	if err != nil {
+		db.Close()
+		return nil, err
+	}
+	return &History{db: db}, nil
+}
+
+// Close 关闭数据库
+func (h *History) Close() error {
+	return h.db.Close()
+}
+
+func historyKey(id uint64) []byte {
+	key := make([]byte, 8)
+	binary.BigEndian.PutUint64(key, id)
+	return key
+}
+
+// Add 保存一条记录并设置它的 ID
+func (h *History) Add(r *TransferRecord) error {
+	return h.db.Update(func(tx *bolt.Tx) error {
+		b := tx.Bucket(historyBucket)
+		id, err := b.NextSequence()
+		if err != nil {
+			return err
+		}
+		r.ID = id
+		data, err := json.Marshal(r)
+		if err != nil {
+			return err
+		}
+		return b.Put(historyKey(id), data)
+	})
+}
+
+// Get 按 ID 读取一条记录
+func (h *History) Get(id uint64) (TransferRecord, error) {
+	var r TransferRecord
+	err := h.db.View(func(tx *bolt.Tx) error {
+		data := tx.Bucket(historyBucket).Get(historyKey(id))
+		if data == nil {
+			return fmt.Errorf("transfer record %d not found", id)
+		}
+		return json.Unmarshal(data, &r)
+	})
+	return r, err
+}
+
+// Query 返回满足条件的记录，最新的在前
+func (h *History) Query(q HistoryQuery) ([]TransferRecord, error) {
+	records := []TransferRecord{}
+	err := h.db.View(func(tx *bolt.Tx) error {
+		c := tx.Bucket(historyBucket).Cursor()
+		for k, v := c.Last(); k != nil; k, v = c.Prev() {
+			var r TransferRecord
+			if err := json.Unmarshal(v, &r); err != nil {
+				continue
+			}
+			if !q.match(r) {
+				continue
+			}
+			records = append(records, r)
+			if q.Limit > 0 && len(records) >= q.Limit {
+				break
+			}
+		}
+		return nil
+	})
+	return records, err
+}
+
+// AddRun 保存一条定时任务的运行记录并设置它的 ID
+func (h *History) AddRun(r *ScheduleRun) error {
+	return h.db.Update(func(tx *bolt.Tx) error {
+		b := tx.Bucket(runsBucket)
+		id, err := b.NextSequence()
+		if err != nil {
+			return err
+		}
+		r.ID = id
+		data, err := json.Marshal(r)
+		if err != nil {
+			return err
+		}
+		return b.Put(historyKey(id), data)
+	})
+}
+
+// Runs 返回定时任务的运行记录，最新的在前；jobID 为空时返回所有任务的记录，limit 为 0 时不限制
+func (h *History) Runs(jobID string, limit int) ([]ScheduleRun, error) {
+	runs := []ScheduleRun{}
+	err := h.db.View(func(tx *bolt.Tx) error {
+		c := tx.Bucket(runsBucket).Cursor()
+		for k, v := c.Last(); k != nil; k, v = c.Prev() {
+			var r ScheduleRun
+			if err := json.Unmarshal(v, &r); err != nil {
+				continue
+			}
+			if jobID != "" && r.JobID != jobID {
+				continue
+			}
+			runs = append(runs, r)
+			if limit > 0 && len(runs) >= limit {
+				break
+			}
+		}
+		return nil
+	})
+	return runs, err
+}
+
+// csvHeader 导出 CSV 的列
+var csvHeader = []string{"id", "started", "kind", "server", "profile", "remote_path", "local_path", "target",
+	"size", "duration_s", "speed_bps", "checksum", "status", "error"}
+
+// WriteCSV 把记录写成 CSV
+func WriteCSV(f io.Writer, records []TransferRecord) error {
+	w := csv.NewWriter(f)
+	w.Write(csvHeader)
+	for _, r := range records {
+		w.Write([]string{
+			strconv.FormatUint(r.ID, 10),
+			r.Started.Format(time.RFC3339),
+			r.Kind,
+			r.Server,
+			r.Profile,
+			r.RemotePath,
+			r.LocalPath,
+			r.Target,
+			strconv.FormatInt(r.Size, 10),
+			strconv.FormatFloat(r.Duration, 'f', 3, 64),
+			strconv.FormatFloat(r.Speed, 'f', 0, 64),
+			r.Checksum,
+			r.Status,
+			r.Error,
+		})
+	}
+	w.Flush()
+	return w.Error()
+}
+
+// historyPath 返回记录数据库的路径 (configDir/history.db)
+func historyPath() (string, error) {
+	dir, err := configDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, "history.db"), nil
+}
+
+// historyMu 进程内对记录数据库的访问依次进行。数据库只在读写时打开，
+// 避免长时间占用文件锁，使界面和命令行可以同时记录
+var historyMu sync.Mutex
+
+// withHistory 打开默认位置的记录数据库并执行 fn，结束后关闭
+func withHistory(fn func(h *History) error) error {
+	historyMu.Lock()
+	defer historyMu.Unlock()
+	path, err := historyPath()
+	if err != nil {
+		return err
+	}
+	h, err := OpenHistory(path)
+	if err != nil {
+		return err
+	}
+	defer h.Close()
+	return fn(h)
+}
+
+// newTransferRecord 根据结束的任务生成记录；成功时计算本地文件的 sha256
+func newTransferRecord(kind, server string, job *TransferJob, remotePath, localPath string, err error) TransferRecord {
+	progress := job.Snapshot()
+	started := job.progress.started
+	r := TransferRecord{
+		Kind:       kind,
+		Server:     server,
+		RemotePath: remotePath,
+		LocalPath:  localPath,
+		Size:       progress.Transferred,
+		Started:    started,
+		Duration:   time.Since(started).Seconds(),
+		Speed:      progress.AvgSpeed,
+		Status:     HistoryOK,
+	}
+	if errors.Is(err, ErrSkipped) {
+		r.Status = HistorySkipped
+		r.Size = 0
+	} else if err != nil {
+		r.Status = HistoryFailed
+		if errors.Is(err, context.Canceled) {
+			r.Status = HistoryCanceled
+		}
+		r.Error = err.Error()
+	} else if localPath != "" {
+		// 任务的字节数可能包含查询大小时的目录列表，以本地文件为准
+		if info, err := os.Stat(localPath); err == nil {
+			r.Size = info.Size()
+		}
+		if sum, err := fileHash(localPath); err == nil {
+			r.Checksum = "sha256:" + hex.EncodeToString(sum[:])
+		}
+	}
+	return r
+}
+
+// recordTransfer 保存一条记录，数据库不可用时只写日志，不影响传输结果
+func recordTransfer(r TransferRecord) {
+	err := withHistory(func(h *History) error {
+		return h.Add(&r)
+	})
+	if err != nil {
+		MyLogger.Info("failed to record transfer", "remote", r.RemotePath, "error", err)
+	}
+}
+
+// TransferHistory 按日期、服务器和结果查询传输记录，最新的在前
+func (a *App) TransferHistory(q HistoryQuery) ([]TransferRecord, error) {
+	var records []TransferRecord
+	err := withHistory(func(h *History) (err error) {
+		records, err = h.Query(q)
+		return err
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to read history: %v", err)
+	}
+	return records, nil
+}
+
+// ExportHistoryCSV 把满足条件的记录导出为 CSV，path 为空时弹出保存对话框；返回写入的文件路径
+func (a *App) ExportHistoryCSV(q HistoryQuery, path string) (string, error) {
+	if path == "" {
+		var err error
+		path, err = runtime.SaveFileDialog(a.ctx, runtime.SaveDialogOptions{
+			Title:           "Export transfer history",
+			DefaultFilename: "transfers.csv",
+		})
+		if err != nil {
+			return "", fmt.Errorf("failed to open save dialog: %w", err)
+		}
+		if path == "" {
+			return "", nil
+		}
+	}
+	records, err := a.TransferHistory(q)
+	if err != nil {
+		return "", err
+	}
+	f, err := os.Create(path)
+	if err != nil {
+		return "", fmt.Errorf("failed to export history: %v", err)
+	}
+	defer f.Close()
+	if err := WriteCSV(f, records); err != nil {
+		return "", fmt.Errorf("failed to export history: %v", err)
+	}
+	MyLogger.Info("history exported", "path", path, "records", len(records))
+	return path, nil
+}
+
+// RerunTransfer 重新执行一条记录中的上传或下载。sessionID 为空时按记录中的配置新建连接，结束后断开
+func (a *App) RerunTransfer(sessionID string, id uint64) error {
+	var r TransferRecord
+	err := withHistory(func(h *History) (err error) {
+		r, err = h.Get(id)
+		return err
+	})
+	if err != nil {
+		return err
+	}
+	if r.Kind != "upload" && r.Kind != "download" {
+		return fmt.Errorf("%s transfers cannot be re-run", r.Kind)
+	}
+	if sessionID == "" {
+		if r.Profile == "" {
+			return fmt.Errorf("transfer %d was not made with a saved profile, connect first", id)
+		}
+		if sessionID, err = a.ConnectProfile(r.Profile); err != nil {
+			return err
+		}
+		defer a.Disconnect(sessionID)
+	}
+	MyLogger.Info("re-running transfer", "id", id, "kind", r.Kind, "remote", r.RemotePath)
+	if r.Kind == "upload" {
+		return a.Upload(sessionID, r.LocalPath, r.RemotePath, "", "")
+	}
+	return a.Download(sessionID, r.RemotePath, r.LocalPath, -1, "", "")
+}
@@ -0,0 +1,67 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestTransferHistory(t *testing.T) {
+	srv := newTestServer(t)
+	srv.WriteFile("/report.csv", []byte("a,b\n1,2\n"))
+	app := NewApp()
+	id, err := app.Connect(srv.Addr, "rw", "123")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer app.Disconnect(id)
+	dir := t.TempDir()
+	since := time.Now()
+
+	local := filepath.Join(dir, "report.csv")
+	if err := app.Download(id, "/report.csv", local, -1, "", ""); err != nil {
+		t.Fatal(err)
+	}
+	missing := filepath.Join(dir, "later.txt")
+	if err := app.Download(id, "/later.txt", missing, -1, "", ""); err == nil {
+		t.Fatal("download of a missing file succeeded")
+	}
+
+	records, err := app.TransferHistory(HistoryQuery{From: since, Server: srv.Addr})
+	if err != nil || len(records) != 2 {
+		t.Fatalf("history = %+v, %v", records, err)
+	}
+	failed, ok := records[0], records[1]
+	if failed.Status != HistoryFailed || failed.Error == "" || ok.Status != HistoryOK || ok.Size != 8 {
+		t.Fatalf("unexpected records: %+v", records)
+	}
+	if !strings.HasPrefix(ok.Checksum, "sha256:") || ok.LocalPath != local {
+		t.Fatalf("unexpected record: %+v", ok)
+	}
+	if only, _ := app.TransferHistory(HistoryQuery{From: since, Status: HistoryFailed}); len(only) != 1 || only[0].ID != failed.ID {
+		t.Fatalf("status query = %+v", only)
+	}
+
+	csvPath := filepath.Join(dir, "history.csv")
+	if _, err := app.ExportHistoryCSV(HistoryQuery{From: since}, csvPath); err != nil {
+		t.Fatal(err)
+	}
+	data, _ := os.ReadFile(csvPath)
+	if lines := strings.Split(strings.TrimSpace(string(data)), "\n"); len(lines) != 3 || !strings.HasPrefix(lines[0], "id,started,kind") {
+		t.Fatalf("csv = %q", data)
+	}
+
+	// 文件出现后重新执行失败的下载
+	srv.WriteFile("/later.txt", []byte("now here"))
+	if err := app.RerunTransfer(id, failed.ID); err != nil {
+		t.Fatal(err)
+	}
+	if data, _ := os.ReadFile(missing); string(data) != "now here" {
+		t.Fatalf("re-run downloaded %q", data)
+	}
+	if records, _ := app.TransferHistory(HistoryQuery{From: since, Status: HistoryOK}); len(records) != 2 {
+		t.Fatalf("history after re-run = %+v", records)
+	}
+}
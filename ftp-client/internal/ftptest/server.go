@@ -0,0 +1,837 @@
+// Package ftptest 提供在进程内运行的 FTP 服务器，用于端到端测试客户端，不依赖外部进程。
+// 文件保存在内存中；通过 Handle 可以按命令注入错误响应、延迟、多行响应、
+// 错误的 PASV 地址或直接断开控制连接。
+package ftptest
+
+import (
+	"bufio"
+	"bytes"
+	"compress/zlib"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"net"
+	"os"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// dataTimeout 等待客户端建立数据连接的最长时间
+const dataTimeout = 5 * time.Second
+
+// User 可以登录的用户。Password 为空的 anonymous 用户接受任意密码
+type User struct {
+	Name     string
+	Password string
+	ReadOnly bool // 禁止上传、删除、重命名、建目录和修改权限
+}
+
+// Rule 对匹配的命令执行的脚本动作，按 Delay、Disconnect、Reply 的顺序生效
+type Rule struct {
+	Command string // 命令名，例如 "RETR"，为空时匹配所有命令
+	Arg     string // 非空时参数必须完全相同
+
+	// Times 生效次数，用完后规则被删除；0 表示一直生效
+	Times int
+
+	Delay      time.Duration // 处理命令前等待
+	Disconnect bool          // 不回复，直接关闭控制连接
+	// Reply 非空时原样发送 (可以是 MultiLine 构造的多行响应)，命令本身不执行
+	Reply string
+	// PASVAddress 只用于 PASV：正常监听数据端口，但在响应中返回这个地址 (host:port)
+	PASVAddress string
+}
+
+// MultiLine 构造多行响应，例如 MultiLine(211, "Features:", " SIZE", "End")
+func MultiLine(code int, lines ...string) string {
+	if len(lines) == 0 {
+		return strconv.Itoa(code)
+	}
+	var b strings.Builder
+	for i, line := range lines {
+		switch {
+		case i == 0 && len(lines) > 1:
+			fmt.Fprintf(&b, "%d-%s\r\n", code, line)
+		case i == len(lines)-1:
+			fmt.Fprintf(&b, "%d %s", code, line)
+		default:
+			b.WriteString(line + "\r\n")
+		}
+	}
+	return b.String()
+}
+
+// file 虚拟文件系统中的文件或目录
+type file struct {
+	dir     bool
+	data    []byte
+	mode    os.FileMode
+	modTime time.Time
+}
+
+// Server 内存中的 FTP 服务器
+type Server struct {
+	Addr string // 控制连接地址，例如 127.0.0.1:54321
+
+	// Welcome 连接时的欢迎信息，Features 为 FEAT 的内容；需要在客户端连接前设置
+	Welcome  string
+	Features []string
+
+	mu       sync.Mutex
+	users    map[string]User
+	files    map[string]*file
+	rules    []*Rule
+	received []string
+	listener net.Listener
+	conns    map[net.Conn]struct{}
+	wg       sync.WaitGroup
+}
+
+// NewServer 在 127.0.0.1 的随机端口上启动服务器，测试结束时须调用 Close
+func NewServer() *Server {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		panic(fmt.Sprintf("ftptest: failed to listen: %v", err))
+	}
+	s := &Server{
+		Addr:     l.Addr().String(),
+		Welcome:  "ftptest ready",
+		Features: []string{"SIZE", "MDTM", "REST STREAM", "UTF8"},
+		users:    map[string]User{},
+		files:    map[string]*file{"/": {dir: true, mode: os.ModeDir | 0755, modTime: time.Now()}},
+		listener: l,
+		conns:    map[net.Conn]struct{}{},
+	}
+	s.wg.Add(1)
+	go s.serve()
+	return s
+}
+
+// Close 停止监听并断开所有连接
+func (s *Server) Close() {
+	s.listener.Close()
+	s.mu.Lock()
+	for c := range s.conns {
+		c.Close()
+	}
+	s.mu.Unlock()
+	s.wg.Wait()
+}
+
+// AddUser 添加或替换用户
+func (s *Server) AddUser(u User) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.users[u.Name] = u
+}
+
+// Handle 添加一条脚本规则，先添加的规则优先匹配
+func (s *Server) Handle(r Rule) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	r.Command = strings.ToUpper(r.Command)
+	s.rules = append(s.rules, &r)
+}
+
+// Received 返回所有连接收到的命令，按到达顺序
+func (s *Server) Received() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]string(nil), s.received...)
+}
+
+// WriteFile 创建或覆盖文件，父目录不存在时自动创建
+func (s *Server) WriteFile(name string, data []byte) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	name = path.Clean("/" + name)
+	s.mkdirAll(path.Dir(name))
+	s.files[name] = &file{data: append([]byte(nil), data...), mode: 0644, modTime: time.Now()}
+}
+
+// ReadFile 返回文件内容
+func (s *Server) ReadFile(name string) ([]byte, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	f, ok := s.files[path.Clean("/"+name)]
+	if !ok || f.dir {
+		return nil, fs.ErrNotExist
+	}
+	return append([]byte(nil), f.data...), nil
+}
+
+// Mkdir 创建目录及其父目录
+func (s *Server) Mkdir(name string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.mkdirAll(path.Clean("/" + name))
+}
+
+// Exists 判断文件或目录是否存在
+func (s *Server) Exists(name string) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	_, ok := s.files[path.Clean("/"+name)]
+	return ok
+}
+
+// Mode 返回文件的权限，不存在时返回 0
+func (s *Server) Mode(name string) os.FileMode {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if f, ok := s.files[path.Clean("/"+name)]; ok {
+		return f.mode
+	}
+	return 0
+}
+
+// SetModTime 修改文件的修改时间，用于测试 MDTM 和冲突检测
+func (s *Server) SetModTime(name string, t time.Time) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if f, ok := s.files[path.Clean("/"+name)]; ok {
+		f.modTime = t
+	}
+}
+
+// hasFeature 判断 Features 中是否有 name
+func (s *Server) hasFeature(name string) bool {
+	for _, f := range s.Features {
+		if strings.EqualFold(f, name) {
+			return true
+		}
+	}
+	return false
+}
+
+// mkdirAll 创建目录及其父目录，调用者持有 s.mu
+func (s *Server) mkdirAll(dir string) {
+	for p := dir; ; p = path.Dir(p) {
+		if _, ok := s.files[p]; !ok {
+			s.files[p] = &file{dir: true, mode: os.ModeDir | 0755, modTime: time.Now()}
+		}
+		if p == "/" {
+			return
+		}
+	}
+}
+
+// children 返回目录下的直接子项，按名称排序，调用者持有 s.mu
+func (s *Server) children(dir string) []string {
+	var names []string
+	for p := range s.files {
+		if p != "/" && path.Dir(p) == dir {
+			names = append(names, path.Base(p))
+		}
+	}
+	sort.Strings(names)
+	return names
+}
+
+// match 查找第一条匹配的规则并扣除次数
+func (s *Server) match(command, arg string) *Rule {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.received = append(s.received, strings.TrimSpace(command+" "+arg))
+	for i, r := range s.rules {
+		if (r.Command != "" && r.Command != command) || (r.Arg != "" && r.Arg != arg) {
+			continue
+		}
+		if r.Times > 0 {
+			r.Times--
+			if r.Times == 0 {
+				s.rules = append(s.rules[:i], s.rules[i+1:]...)
+			}
+		}
+		return r
+	}
+	return nil
+}
+
+func (s *Server) serve() {
+	defer s.wg.Done()
+	for {
+		conn, err := s.listener.Accept()
+		if err != nil {
+			return
+		}
+		s.mu.Lock()
+		s.conns[conn] = struct{}{}
+		s.mu.Unlock()
+		s.wg.Add(1)
+		go func() {
+			defer s.wg.Done()
+			sess := &session{srv: s, conn: conn, r: bufio.NewReader(conn), cwd: "/"}
+			sess.run()
+			conn.Close()
+			sess.closeData()
+			s.mu.Lock()
+			delete(s.conns, conn)
+			s.mu.Unlock()
+		}()
+	}
+}
+
+// session 一个控制连接的状态
+type session struct {
+	srv        *Server
+	conn       net.Conn
+	r          *bufio.Reader
+	user       string
+	loggedIn   bool
+	readOnly   bool
+	cwd        string
+	rest       int64
+	renameFrom string
+	pasv       net.Listener // PASV 打开的数据端口
+	active     string       // PORT 指定的客户端地址
+	modeZ      bool         // MODE Z，数据连接使用 zlib 压缩
+	ascii      bool         // TYPE A，RETR 把 LF 发送为 CRLF，STOR 把 CRLF 保存为 LF
+}
+
+func (c *session) reply(code int, format string, a ...interface{}) {
+	fmt.Fprintf(c.conn, "%d %s\r\n", code, fmt.Sprintf(format, a...))
+}
+
+func (c *session) run() {
+	c.reply(220, "%s", c.srv.Welcome)
+	for {
+		line, err := c.r.ReadString('\n')
+		if err != nil {
+			return
+		}
+		line = strings.TrimRight(line, "\r\n")
+		command, arg, _ := strings.Cut(line, " ")
+		command = strings.ToUpper(command)
+
+		rule := c.srv.match(command, arg)
+		pasvAddress := ""
+		if rule != nil {
+			if rule.Delay > 0 {
+				time.Sleep(rule.Delay)
+			}
+			if rule.Disconnect {
+				return
+			}
+			if rule.Reply != "" {
+				io.WriteString(c.conn, rule.Reply+"\r\n")
+				continue
+			}
+			pasvAddress = rule.PASVAddress
+		}
+		if command == "QUIT" {
+			c.reply(221, "Goodbye")
+			return
+		}
+		c.handle(command, arg, pasvAddress)
+	}
+}
+
+// resolve 把参数转换为绝对路径
+func (c *session) resolve(arg string) string {
+	if arg == "" {
+		return c.cwd
+	}
+	if strings.HasPrefix(arg, "/") {
+		return path.Clean(arg)
+	}
+	return path.Join(c.cwd, arg)
+}
+
+// lookup 返回文件的副本，不存在时 ok 为 false
+func (c *session) lookup(p string) (file, bool) {
+	c.srv.mu.Lock()
+	defer c.srv.mu.Unlock()
+	f, ok := c.srv.files[p]
+	if !ok {
+		return file{}, false
+	}
+	return *f, true
+}
+
+func (c *session) handle(command, arg, pasvAddress string) {
+	switch command {
+	case "USER":
+		c.user, c.loggedIn = arg, false
+		c.reply(331, "Password required for %s", arg)
+		return
+	case "PASS":
+		c.srv.mu.Lock()
+		u, ok := c.srv.users[c.user]
+		c.srv.mu.Unlock()
+		if !ok || (u.Password != arg && !(u.Name == "anonymous" && u.Password == "")) {
+			c.reply(530, "Login incorrect")
+			return
+		}
+		c.loggedIn, c.readOnly = true, u.ReadOnly
+		c.reply(230, "Login successful")
+		return
+	case "FEAT":
+		lines := append([]string{"Features:"}, c.srv.Features...)
+		for i := 1; i < len(lines); i++ {
+			lines[i] = " " + lines[i]
+		}
+		io.WriteString(c.conn, MultiLine(211, append(lines, "End")...)+"\r\n")
+		return
+	case "SYST":
+		c.reply(215, "UNIX Type: L8")
+		return
+	case "NOOP", "OPTS":
+		c.reply(200, "OK")
+		return
+	case "AUTH":
+		c.reply(502, "TLS not supported")
+		return
+	}
+	if !c.loggedIn {
+		c.reply(530, "Please login with USER and PASS")
+		return
+	}
+
+	switch command {
+	case "PWD", "XPWD":
+		c.reply(257, "%q is the current directory", c.cwd)
+	case "CWD", "CDUP":
+		p := c.resolve(arg)
+		if command == "CDUP" {
+			p = path.Dir(c.cwd)
+		}
+		if f, ok := c.lookup(p); !ok || !f.dir {
+			c.reply(550, "No such directory")
+			return
+		}
+		c.cwd = p
+		c.reply(250, "Directory changed to %s", p)
+	case "TYPE":
+		c.ascii = strings.HasPrefix(strings.ToUpper(arg), "A")
+		c.reply(200, "%s set to %s", command, arg)
+	case "STRU":
+		c.reply(200, "%s set to %s", command, arg)
+	case "MODE":
+		// 只有 Features 中声明了 MODE Z 时才接受 Z
+		switch strings.ToUpper(arg) {
+		case "S":
+			c.modeZ = false
+		case "Z":
+			if !c.srv.hasFeature("MODE Z") {
+				c.reply(504, "Mode not supported")
+				return
+			}
+			c.modeZ = true
+		default:
+			c.reply(504, "Mode not supported")
+			return
+		}
+		c.reply(200, "MODE set to %s", arg)
+	case "PASV":
+		c.closeData()
+		l, err := net.Listen("tcp", "127.0.0.1:0")
+		if err != nil {
+			c.reply(425, "Can't open data connection")
+			return
+		}
+		c.pasv, c.active = l, ""
+		addr := l.Addr().String()
+		if pasvAddress != "" {
+			addr = pasvAddress
+		}
+		host, portStr, _ := net.SplitHostPort(addr)
+		port, _ := strconv.Atoi(portStr)
+		c.reply(227, "Entering Passive Mode (%s,%d,%d)", strings.ReplaceAll(host, ".", ","), port/256, port%256)
+	case "PORT":
+		parts := strings.Split(arg, ",")
+		if len(parts) != 6 {
+			c.reply(501, "Invalid PORT argument")
+			return
+		}
+		p1, _ := strconv.Atoi(parts[4])
+		p2, _ := strconv.Atoi(parts[5])
+		c.closeData()
+		c.active = net.JoinHostPort(strings.Join(parts[:4], "."), strconv.Itoa(p1*256+p2))
+		c.reply(200, "PORT command successful")
+	case "REST":
+		n, err := strconv.ParseInt(arg, 10, 64)
+		if err != nil || n < 0 {
+			c.reply(501, "Invalid REST argument")
+			return
+		}
+		c.rest = n
+		c.reply(350, "Restarting at %d", n)
+	case "LIST", "NLST":
+		c.list(command, arg)
+	case "RETR":
+		c.retr(c.resolve(arg))
+	case "STOR", "APPE":
+		c.stor(c.resolve(arg), command == "APPE")
+	case "SIZE":
+		f, ok := c.lookup(c.resolve(arg))
+		if !ok || f.dir {
+			c.reply(550, "No such file")
+			return
+		}
+		c.reply(213, "%d", len(f.data))
+	case "MDTM":
+		f, ok := c.lookup(c.resolve(arg))
+		if !ok {
+			c.reply(550, "No such file")
+			return
+		}
+		c.reply(213, "%s", f.modTime.UTC().Format("20060102150405"))
+	case "ABOR":
+		c.closeData()
+		c.reply(226, "Abort successful")
+	default:
+		if c.readOnly && isWriteCommand(command, arg) {
+			c.reply(550, "Permission denied")
+			return
+		}
+		c.modify(command, arg)
+	}
+}
+
+// isWriteCommand 判断命令是否会修改文件系统
+func isWriteCommand(command, arg string) bool {
+	switch command {
+	case "DELE", "RMD", "XRMD", "MKD", "XMKD", "RNFR", "RNTO":
+		return true
+	case "SITE":
+		return strings.HasPrefix(strings.ToUpper(arg), "CHMOD")
+	}
+	return false
+}
+
+// modify 处理修改文件系统的命令和 SITE
+func (c *session) modify(command, arg string) {
+	s := c.srv
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	p := c.resolve(arg)
+	switch command {
+	case "DELE":
+		f, ok := s.files[p]
+		if !ok || f.dir {
+			c.reply(550, "No such file")
+			return
+		}
+		delete(s.files, p)
+		c.reply(250, "File deleted")
+	case "RMD", "XRMD":
+		f, ok := s.files[p]
+		if !ok || !f.dir || p == "/" {
+			c.reply(550, "No such directory")
+			return
+		}
+		if len(s.children(p)) > 0 {
+			c.reply(550, "Directory not empty")
+			return
+		}
+		delete(s.files, p)
+		c.reply(250, "Directory removed")
+	case "MKD", "XMKD":
+		if _, ok := s.files[p]; ok {
+			c.reply(550, "File exists")
+			return
+		}
+		if parent, ok := s.files[path.Dir(p)]; !ok || !parent.dir {
+			c.reply(550, "No such directory")
+			return
+		}
+		s.files[p] = &file{dir: true, mode: os.ModeDir | 0755, modTime: time.Now()}
+		c.reply(257, "%q created", p)
+	case "RNFR":
+		if _, ok := s.files[p]; !ok {
+			c.reply(550, "No such file")
+			return
+		}
+		c.renameFrom = p
+		c.reply(350, "Ready for RNTO")
+	case "RNTO":
+		from := c.renameFrom
+		c.renameFrom = ""
+		if from == "" {
+			c.reply(503, "RNFR required first")
+			return
+		}
+		// 目录连同其中的内容一起移动
+		for old, f := range s.files {
+			if old == from || strings.HasPrefix(old, from+"/") {
+				delete(s.files, old)
+				s.files[p+strings.TrimPrefix(old, from)] = f
+			}
+		}
+		c.reply(250, "Rename successful")
+	case "SITE":
+		c.site(arg)
+	default:
+		c.reply(502, "Command not implemented")
+	}
+}
+
+// site 处理 SITE CHMOD 和 SITE HELP，调用者持有 s.mu
+func (c *session) site(arg string) {
+	sub, rest, _ := strings.Cut(arg, " ")
+	switch strings.ToUpper(sub) {
+	case "HELP":
+		io.WriteString(c.conn, MultiLine(214, "The following SITE commands are recognized:", " CHMOD HELP", "Help OK")+"\r\n")
+	case "CHMOD":
+		modeStr, name, _ := strings.Cut(rest, " ")
+		mode, err := strconv.ParseUint(modeStr, 8, 32)
+		if err != nil || mode > 07777 {
+			c.reply(501, "Invalid mode")
+			return
+		}
+		f, ok := c.srv.files[c.resolve(name)]
+		if !ok {
+			c.reply(550, "No such file")
+			return
+		}
+		f.mode = f.mode&os.ModeDir | os.FileMode(mode&0777)
+		if mode&04000 != 0 {
+			f.mode |= os.ModeSetuid
+		}
+		if mode&02000 != 0 {
+			f.mode |= os.ModeSetgid
+		}
+		if mode&01000 != 0 {
+			f.mode |= os.ModeSticky
+		}
+		c.reply(200, "SITE CHMOD command successful")
+	default:
+		c.reply(500, "Unknown SITE command")
+	}
+}
+
+// openData 返回数据连接：PASV 时等待客户端连接，PORT 时主动连接客户端
+func (c *session) openData() (net.Conn, error) {
+	defer func() {
+		c.closeData()
+		c.active = ""
+	}()
+	if c.active != "" {
+		return net.DialTimeout("tcp", c.active, dataTimeout)
+	}
+	if c.pasv == nil {
+		return nil, errors.New("no data connection")
+	}
+	if tl, ok := c.pasv.(*net.TCPListener); ok {
+		tl.SetDeadline(time.Now().Add(dataTimeout))
+	}
+	return c.pasv.Accept()
+}
+
+func (c *session) closeData() {
+	if c.pasv != nil {
+		c.pasv.Close()
+		c.pasv = nil
+	}
+}
+
+// transfer 打开数据连接并执行 fn，按结果回复 226 或 426
+func (c *session) transfer(fn func(conn net.Conn) error) {
+	if c.pasv == nil && c.active == "" {
+		c.reply(425, "Use PASV or PORT first")
+		return
+	}
+	c.reply(150, "Opening data connection")
+	conn, err := c.openData()
+	if err != nil {
+		c.reply(425, "Can't open data connection: %v", err)
+		return
+	}
+	if c.modeZ {
+		conn = &zlibConn{Conn: conn}
+	}
+	err = fn(conn)
+	if closeErr := conn.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		c.reply(426, "Transfer aborted: %v", err)
+		return
+	}
+	c.reply(226, "Transfer complete")
+}
+
+// toCRLF 把 LF 换行转换为 CRLF，已经是 CRLF 的换行不变
+func toCRLF(data []byte) []byte {
+	out := make([]byte, 0, len(data))
+	for i, b := range data {
+		if b == '\n' && (i == 0 || data[i-1] != '\r') {
+			out = append(out, '\r')
+		}
+		out = append(out, b)
+	}
+	return out
+}
+
+// zlibConn MODE Z 的数据连接，读取时解压，写入时压缩，Close 时写出压缩流的结尾
+type zlibConn struct {
+	net.Conn
+	r io.ReadCloser
+	w *zlib.Writer
+}
+
+func (z *zlibConn) Read(p []byte) (int, error) {
+	if z.r == nil {
+		r, err := zlib.NewReader(z.Conn)
+		if err != nil {
+			return 0, err
+		}
+		z.r = r
+	}
+	return z.r.Read(p)
+}
+
+func (z *zlibConn) Write(p []byte) (int, error) {
+	if z.w == nil {
+		z.w = zlib.NewWriter(z.Conn)
+	}
+	return z.w.Write(p)
+}
+
+func (z *zlibConn) Close() error {
+	var err error
+	if z.w != nil {
+		err = z.w.Close()
+	}
+	if z.r != nil {
+		z.r.Close()
+	}
+	z.Conn.Close()
+	return err
+}
+
+// listLine 以 ls -l 的格式输出一项
+func listLine(name string, f file) string {
+	kind := "-"
+	if f.dir {
+		kind = "d"
+	}
+	stamp := f.modTime.Format("Jan _2 15:04")
+	if time.Since(f.modTime) > 180*24*time.Hour {
+		stamp = f.modTime.Format("Jan _2  2006")
+	}
+	return fmt.Sprintf("%s%s 1 owner group %d %s %s", kind, lsPerm(f.mode), len(f.data), stamp, name)
+}
+
+// lsPerm 返回 rwxr-xr-x 形式的权限，包括 setuid/setgid/sticky
+func lsPerm(mode os.FileMode) string {
+	b := []byte(mode.Perm().String()[1:])
+	for i, bit := range []os.FileMode{os.ModeSetuid, os.ModeSetgid, os.ModeSticky} {
+		if mode&bit == 0 {
+			continue
+		}
+		pos := 2 + 3*i
+		ch := "sst"[i]
+		if b[pos] == '-' {
+			ch -= 'a' - 'A'
+		}
+		b[pos] = ch
+	}
+	return string(b)
+}
+
+func (c *session) list(command, arg string) {
+	// 忽略 ls 风格的选项，例如 LIST -a
+	if strings.HasPrefix(arg, "-") {
+		_, arg, _ = strings.Cut(arg, " ")
+	}
+	p := c.resolve(arg)
+	c.srv.mu.Lock()
+	var lines []string
+	if f, ok := c.srv.files[p]; ok && !f.dir {
+		lines = append(lines, listLine(path.Base(p), *f))
+	} else if ok {
+		for _, name := range c.srv.children(p) {
+			if command == "NLST" {
+				lines = append(lines, name)
+			} else {
+				lines = append(lines, listLine(name, *c.srv.files[path.Join(p, name)]))
+			}
+		}
+	} else {
+		c.srv.mu.Unlock()
+		c.reply(550, "No such file or directory")
+		return
+	}
+	c.srv.mu.Unlock()
+
+	c.transfer(func(conn net.Conn) error {
+		for _, line := range lines {
+			if _, err := io.WriteString(conn, line+"\r\n"); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+func (c *session) retr(p string) {
+	offset := c.rest
+	c.rest = 0
+	f, ok := c.lookup(p)
+	if !ok || f.dir {
+		c.reply(550, "No such file")
+		return
+	}
+	if offset > int64(len(f.data)) {
+		offset = int64(len(f.data))
+	}
+	data := f.data[offset:]
+	if c.ascii {
+		data = toCRLF(data)
+	}
+	c.transfer(func(conn net.Conn) error {
+		_, err := conn.Write(data)
+		return err
+	})
+}
+
+func (c *session) stor(p string, appendMode bool) {
+	offset := c.rest
+	c.rest = 0
+	if c.readOnly {
+		c.reply(550, "Permission denied")
+		return
+	}
+	if parent, ok := c.lookup(path.Dir(p)); !ok || !parent.dir {
+		c.reply(550, "No such directory")
+		return
+	}
+	if f, ok := c.lookup(p); ok && f.dir {
+		c.reply(550, "Is a directory")
+		return
+	}
+	c.transfer(func(conn net.Conn) error {
+		data, err := io.ReadAll(conn)
+		if err != nil {
+			return err
+		}
+		if c.ascii {
+			data = bytes.ReplaceAll(data, []byte("\r\n"), []byte("\n"))
+		}
+		s := c.srv
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		f, ok := s.files[p]
+		if !ok {
+			f = &file{mode: 0644}
+			s.files[p] = f
+		}
+		switch {
+		case appendMode:
+			f.data = append(f.data, data...)
+		case offset > 0 && offset <= int64(len(f.data)):
+			f.data = append(f.data[:offset:offset], data...)
+		default:
+			f.data = data
+		}
+		f.modTime = time.Now()
+		return nil
+	})
+}
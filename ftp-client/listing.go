@@ -0,0 +1,208 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	EntryFile = "file"
+	EntryDir  = "dir"
+	EntryLink = "link"
+)
+
+// Entry LIST 输出中的一项
+type Entry struct {
+	Name   string       `json:"name"`
+	Type   string       `json:"type"`
+	Size   int64        `json:"size"`
+	Time   time.Time    `json:"time"`
+	Mode   string       `json:"mode"`             // 原始权限字符串，例如 -rw-r--r--
+	Perms  *Permissions `json:"perms,omitempty"`  // 解析后的权限位，列表中没有权限时 (如 MS-DOS 格式) 为 nil
+	Target string       `json:"target,omitempty"` // 符号链接指向的路径
+}
+
+// IsDir 判断是否为目录
+func (e Entry) IsDir() bool {
+	return e.Type == EntryDir
+}
+
+// ParseListLine 解析一行 LIST 输出，支持 Unix (ls -l) 和 MS-DOS 两种格式
+func ParseListLine(line string, now time.Time) (Entry, error) {
+	if strings.HasPrefix(line, "total ") {
+		return Entry{}, fmt.Errorf("不是文件条目: %s", line)
+	}
+	if entry, err := parseUnixListLine(line, now); err == nil {
+		return entry, nil
+	}
+	return parseDOSListLine(line)
+}
+
+// ParseList 解析 LIST 输出，跳过无法识别的行以及 "." 和 ".."
+func ParseList(lines []string) []Entry {
+	now := time.Now()
+	entries := make([]Entry, 0, len(lines))
+	for _, line := range lines {
+		entry, err := ParseListLine(line, now)
+		if err != nil || entry.Name == "." || entry.Name == ".." {
+			continue
+		}
+		entries = append(entries, entry)
+	}
+	return entries
+}
+
+// -rw-r--r--   1 owner group  1234 Dec 06 17:29 name
+func parseUnixListLine(line string, now time.Time) (Entry, error) {
+	fields := strings.Fields(line)
+	if len(fields) < 9 || len(fields[0]) < 10 {
+		return Entry{}, fmt.Errorf("无效的LIST行: %s", line)
+	}
+
+	var entry Entry
+	entry.Mode = fields[0]
+	if perms, err := ParsePermissions(fields[0]); err == nil {
+		entry.Perms = &perms
+	}
+	switch fields[0][0] {
+	case 'd':
+		entry.Type = EntryDir
+	case 'l':
+		entry.Type = EntryLink
+	case '-':
+		entry.Type = EntryFile
+	default:
+		return Entry{}, fmt.Errorf("无效的LIST行: %s", line)
+	}
+
+	size, err := strconv.ParseInt(fields[4], 10, 64)
+	if err != nil {
+		return Entry{}, fmt.Errorf("无效的文件大小: %s", line)
+	}
+	entry.Size = size
+	entry.Time = parseUnixListTime(fields[5], fields[6], fields[7], now)
+
+	// 文件名可能包含空格，按前 8 个字段之后的原始文本截取
+	name := line
+	for i := 0; i < 8; i++ {
+		name = strings.TrimLeft(name, " \t")
+		name = name[len(fields[i]):]
+	}
+	name = strings.TrimLeft(name, " \t")
+	if entry.Type == EntryLink {
+		if idx := strings.Index(name, " -> "); idx != -1 {
+			entry.Target = name[idx+4:]
+			name = name[:idx]
+		}
+	}
+	entry.Name = name
+	return entry, nil
+}
+
+// parseUnixListTime 解析 "Dec 06 17:29" 或 "Dec 06 2023"，没有年份时取最近的一个过去日期
+func parseUnixListTime(month, day, yearOrTime string, now time.Time) time.Time {
+	if strings.Contains(yearOrTime, ":") {
+		t, err := time.Parse("Jan 2 15:04 2006", fmt.Sprintf("%s %s %s %d", month, day, yearOrTime, now.Year()))
+		if err != nil {
+			return time.Time{}
+		}
+		if t.After(now.AddDate(0, 0, 1)) {
+			t = t.AddDate(-1, 0, 0)
+		}
+		return t
+	}
+	t, err := time.Parse("Jan 2 2006", fmt.Sprintf("%s %s %s", month, day, yearOrTime))
+	if err != nil {
+		return time.Time{}
+	}
+	return t
+}
+
+// 12-06-24  05:29PM  <DIR>  name
+func parseDOSListLine(line string) (Entry, error) {
+	fields := strings.Fields(line)
+	if len(fields) < 4 {
+		return Entry{}, fmt.Errorf("无效的LIST行: %s", line)
+	}
+	t, err := time.Parse("01-02-06 03:04PM", fields[0]+" "+fields[1])
+	if err != nil {
+		return Entry{}, fmt.Errorf("无效的LIST行: %s", line)
+	}
+
+	entry := Entry{Time: t}
+	if fields[2] == "<DIR>" {
+		entry.Type = EntryDir
+	} else {
+		size, err := strconv.ParseInt(fields[2], 10, 64)
+		if err != nil {
+			return Entry{}, fmt.Errorf("无效的文件大小: %s", line)
+		}
+		entry.Type = EntryFile
+		entry.Size = size
+	}
+
+	name := line
+	for i := 0; i < 3; i++ {
+		name = strings.TrimLeft(name, " \t")
+		name = name[len(fields[i]):]
+	}
+	entry.Name = strings.TrimLeft(name, " \t")
+	return entry, nil
+}
+
+// List 获取并解析指定目录下的文件列表
+func (ftp *FTPConn) List(path string) ([]Entry, error) {
+	lines, err := ftp.ListFiles(path)
+	if err != nil {
+		return nil, err
+	}
+	return ParseList(lines), nil
+}
+
+// entryFromFileInfo 把 os.FileInfo (SFTP 或本地文件) 转换为与 LIST 解析结果相同的 Entry
+func entryFromFileInfo(info os.FileInfo) Entry {
+	e := Entry{
+		Name: info.Name(),
+		Type: EntryFile,
+		Size: info.Size(),
+		Time: info.ModTime(),
+		Mode: lsMode(info.Mode()),
+	}
+	perms := permissionsFromMode(info.Mode())
+	e.Perms = &perms
+	switch {
+	case info.IsDir():
+		e.Type = EntryDir
+	case info.Mode()&os.ModeSymlink != 0:
+		e.Type = EntryLink
+	}
+	return e
+}
+
+// lsMode 以 ls -l 的形式显示权限，例如 drwxr-xr-x 或 -rwsr-xr-x
+func lsMode(mode os.FileMode) string {
+	kind := byte('-')
+	switch {
+	case mode.IsDir():
+		kind = 'd'
+	case mode&os.ModeSymlink != 0:
+		kind = 'l'
+	}
+	b := []byte(string(kind) + mode.Perm().String()[1:])
+	// setuid/setgid/sticky 显示在对应的执行位上，没有执行权限时为大写
+	for i, bit := range []os.FileMode{os.ModeSetuid, os.ModeSetgid, os.ModeSticky} {
+		if mode&bit == 0 {
+			continue
+		}
+		pos := 3 + 3*i
+		c := byte("sst"[i])
+		if b[pos] == '-' {
+			c -= 'a' - 'A'
+		}
+		b[pos] = c
+	}
+	return string(b)
+}
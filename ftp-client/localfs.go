@@ -0,0 +1,131 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"sort"
+)
+
+// localEntry 把本地文件信息转换为与远程列表相同的 Entry，便于前端双栏显示
+func localEntry(dir string, info os.FileInfo) Entry {
+	e := entryFromFileInfo(info)
+	if e.Type == EntryLink {
+		e.Target, _ = os.Readlink(filepath.Join(dir, info.Name()))
+	}
+	return e
+}
+
+// LocalHome 返回本地栏的初始目录 (用户主目录)
+func (a *App) LocalHome() (string, error) {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return "", fmt.Errorf("failed to get home directory: %v", err)
+	}
+	return home, nil
+}
+
+// LocalList 列出本地目录，目录排在文件之前，各自按名称排序
+func (a *App) LocalList(dir string) ([]Entry, error) {
+	items, err := os.ReadDir(dir)
+	if err != nil {
+		MyLogger.Info("failed to list local directory: ", err)
+		return nil, fmt.Errorf("failed to list local directory: %v", err)
+	}
+	entries := make([]Entry, 0, len(items))
+	for _, item := range items {
+		info, err := item.Info()
+		if err != nil {
+			// 读取目录期间被删除的文件
+			continue
+		}
+		entries = append(entries, localEntry(dir, info))
+	}
+	sort.SliceStable(entries, func(i, j int) bool {
+		if entries[i].IsDir() != entries[j].IsDir() {
+			return entries[i].IsDir()
+		}
+		return entries[i].Name < entries[j].Name
+	})
+	return entries, nil
+}
+
+// LocalStat 返回本地文件或目录的信息
+func (a *App) LocalStat(path string) (Entry, error) {
+	info, err := os.Lstat(path)
+	if err != nil {
+		return Entry{}, fmt.Errorf("failed to stat %s: %v", path, err)
+	}
+	return localEntry(filepath.Dir(path), info), nil
+}
+
+// LocalMkdir 创建本地目录
+func (a *App) LocalMkdir(path string) error {
+	if err := os.Mkdir(path, 0755); err != nil {
+		MyLogger.Info("failed to create local folder: ", err)
+		return fmt.Errorf("failed to create folder: %v", err)
+	}
+	return nil
+}
+
+// LocalRename 重命名或移动本地文件，目标已存在时拒绝覆盖
+func (a *App) LocalRename(from, to string) error {
+	if _, err := os.Lstat(to); err == nil {
+		return fmt.Errorf("failed to rename: %s already exists", to)
+	}
+	if err := os.Rename(from, to); err != nil {
+		MyLogger.Info("failed to rename local file: ", err)
+		return fmt.Errorf("failed to rename: %v", err)
+	}
+	return nil
+}
+
+// LocalTrash 把本地文件或目录移到系统回收站，可以从回收站恢复
+func (a *App) LocalTrash(path string) error {
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		return err
+	}
+	if _, err := os.Lstat(abs); err != nil {
+		return fmt.Errorf("failed to delete: %v", err)
+	}
+	if err := moveToTrash(abs); err != nil {
+		MyLogger.Info("failed to move to trash: ", err)
+		return fmt.Errorf("failed to move to trash: %v", err)
+	}
+	MyLogger.Info("moved to trash", "path", abs)
+	return nil
+}
+
+// LocalOpen 用系统默认程序打开本地文件或目录
+func (a *App) LocalOpen(path string) error {
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		return err
+	}
+	if err := openWithSystem(abs); err != nil {
+		MyLogger.Info("failed to open: ", err)
+		return fmt.Errorf("failed to open %s: %v", path, err)
+	}
+	return nil
+}
+
+// openWithSystem 调用系统的文件关联打开 path，不等待程序退出
+func openWithSystem(path string) error {
+	var cmd *exec.Cmd
+	switch runtime.GOOS {
+	case "darwin":
+		cmd = exec.Command("open", path)
+	case "windows":
+		cmd = exec.Command("rundll32", "url.dll,FileProtocolHandler", path)
+	default:
+		cmd = exec.Command("xdg-open", path)
+	}
+	if err := cmd.Start(); err != nil {
+		return err
+	}
+	go cmd.Wait()
+	return nil
+}
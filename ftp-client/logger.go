@@ -7,20 +7,31 @@ import (
 	"os"
 )
 
-
 type MySLog struct {
 	slog *slog.Logger
+	file *os.File
+}
+
+// nopLogger 不输出任何内容，在 main 或 runCLI 创建日志之前使用
+func nopLogger() *MySLog {
+	return &MySLog{slog: slog.New(slog.NewJSONHandler(io.Discard, nil))}
 }
 
+func NewMySlog(setLevel string, filePath string) (*MySLog, error) {
+	return NewMySlogWriter(setLevel, filePath, os.Stdout)
+}
 
-func NewMySlog(setLevel string, filePath string) *MySLog {
+// NewMySlogWriter 与 NewMySlog 相同，但控制台输出写到 console，为 nil 时只写文件
+func NewMySlogWriter(setLevel string, filePath string, console io.Writer) (*MySLog, error) {
 	f, err := os.OpenFile(filePath, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0644)
 	if err != nil {
-		fmt.Println("Failed to create logfile " + filePath)
-		panic(err)
+		return nil, fmt.Errorf("failed to create logfile %s: %w", filePath, err)
 	}
-	writer := io.MultiWriter(f, os.Stdout) // 文件 + 控制台输出
-	level := new(slog.LevelVar)            // 设置日志等级
+	var writer io.Writer = f
+	if console != nil {
+		writer = io.MultiWriter(f, console) // 文件 + 控制台输出
+	}
+	level := new(slog.LevelVar) // 设置日志等级
 	switch setLevel {
 	case "info":
 		level.Set(slog.LevelInfo)
@@ -32,8 +43,16 @@ func NewMySlog(setLevel string, filePath string) *MySLog {
 		level.Set(slog.LevelError)
 	}
 	handle := slog.NewJSONHandler(writer, &slog.HandlerOptions{Level: level})
-	log := slog.New(handle)
-	return &MySLog{slog: log}
+	log := slog.New(newRedactHandler(handle)) // 写出前隐藏密码等凭据
+	return &MySLog{slog: log, file: f}, nil
+}
+
+// Close 关闭日志文件
+func (s *MySLog) Close() error {
+	if s.file == nil {
+		return nil
+	}
+	return s.file.Close()
 }
 
 func (s *MySLog) Debug(args ...interface{}) {
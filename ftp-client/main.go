@@ -2,6 +2,8 @@ package main
 
 import (
 	"embed"
+	"fmt"
+	"os"
 
 	"github.com/wailsapp/wails/v2"
 	"github.com/wailsapp/wails/v2/pkg/options"
@@ -14,18 +16,40 @@ import (
 //go:embed all:frontend/dist
 var assets embed.FS
 
-var MyLogger *MySLog
+// MyLogger 程序日志，由 main (窗口模式) 或 runCLI (命令行模式) 创建
+var MyLogger = nopLogger()
 
-func init() {
-	MyLogger = NewMySlog("info", "log.log")
-}
+// MyTracer 协议跟踪日志，默认关闭，可通过 App.SetProtocolTrace 在运行时打开；命令行模式下为 nil
+var MyTracer *ProtocolTracer
+
+// MyConsole 最近的控制连接交互，供前端协议控制台分页查看
+var MyConsole = NewProtocolConsole(2000)
 
 func main() {
+	// 带子命令启动时以命令行模式运行，不创建窗口
+	if len(os.Args) > 1 && isCLICommand(os.Args[1]) {
+		os.Exit(runCLI(os.Args[1:]))
+	}
+
+	logger, err := NewMySlog("info", "log.log")
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "error:", err)
+		os.Exit(1)
+	}
+	defer logger.Close()
+	MyLogger = logger
+	tracer, err := NewProtocolTracer("protocol.log", false)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "error:", err)
+		os.Exit(1)
+	}
+	defer tracer.Close()
+	MyTracer = tracer
+
 	// Create an instance of the app structure
 	app := NewApp()
-	ftpClient := NewFTPClient()
 	// Create application with options
-	err := wails.Run(&options.App{
+	err = wails.Run(&options.App{
 		Title:  "ftp-client",
 		Width:  1024,
 		Height: 768,
@@ -34,10 +58,10 @@ func main() {
 		},
 		BackgroundColour: &options.RGBA{R: 27, G: 38, B: 54, A: 1},
 		OnStartup:        app.startup,
+		OnShutdown:       app.shutdown,
 		AlwaysOnTop:      false,
 		Bind: []interface{}{
 			app,
-			ftpClient,
 		},
 		Windows: &windows.Options{
 			WebviewIsTransparent:              false,
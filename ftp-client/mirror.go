@@ -0,0 +1,141 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+)
+
+// MirrorStats 目录镜像的统计结果
+type MirrorStats struct {
+	Files   int   `json:"files"`   // 传输的文件数
+	Bytes   int64 `json:"bytes"`   // 传输的字节数
+	Skipped int   `json:"skipped"` // 大小相同而跳过的文件数
+	Dirs    int   `json:"dirs"`    // 处理的目录数
+}
+
+// MirrorDown 把远程目录递归下载到本地目录，大小相同的文件会被跳过
+func MirrorDown(rfs RemoteFS, remoteDir, localDir string) (MirrorStats, error) {
+	var stats MirrorStats
+	err := mirrorDown(rfs, remoteDir, localDir, &stats)
+	return stats, err
+}
+
+func mirrorDown(rfs RemoteFS, remoteDir, localDir string, stats *MirrorStats) error {
+	if err := os.MkdirAll(localDir, 0755); err != nil {
+		return fmt.Errorf("创建本地目录失败: %w", err)
+	}
+	stats.Dirs++
+
+	entries, err := rfs.List(remoteDir)
+	if err != nil {
+		return err
+	}
+	for _, e := range entries {
+		remote := path.Join(remoteDir, e.Name)
+		local := filepath.Join(localDir, e.Name)
+		switch e.Type {
+		case EntryDir:
+			if err := mirrorDown(rfs, remote, local, stats); err != nil {
+				return err
+			}
+		case EntryFile:
+			if info, err := os.Stat(local); err == nil && info.Size() == e.Size {
+				stats.Skipped++
+				continue
+			}
+			if err := DownloadFile(context.Background(), rfs, remote, local, 0, e.Size); err != nil {
+				return fmt.Errorf("下载 %s 失败: %w", remote, err)
+			}
+			stats.Files++
+			stats.Bytes += e.Size
+		}
+	}
+	return nil
+}
+
+// MirrorUp 把本地目录递归上传到远程目录，远程已存在且大小相同的文件会被跳过
+func MirrorUp(rfs RemoteFS, localDir, remoteDir string) (MirrorStats, error) {
+	var stats MirrorStats
+	err := mirrorUp(rfs, localDir, remoteDir, &stats)
+	return stats, err
+}
+
+func mirrorUp(rfs RemoteFS, localDir, remoteDir string, stats *MirrorStats) error {
+	items, err := os.ReadDir(localDir)
+	if err != nil {
+		return fmt.Errorf("读取本地目录失败: %w", err)
+	}
+
+	// 目录可能已存在，创建失败时以列表的结果为准
+	rfs.Mkdir(remoteDir)
+	entries, err := rfs.List(remoteDir)
+	if err != nil {
+		return err
+	}
+	stats.Dirs++
+	remoteSizes := make(map[string]int64, len(entries))
+	for _, e := range entries {
+		if e.Type == EntryFile {
+			remoteSizes[e.Name] = e.Size
+		}
+	}
+
+	for _, item := range items {
+		local := filepath.Join(localDir, item.Name())
+		remote := path.Join(remoteDir, item.Name())
+		if item.IsDir() {
+			if err := mirrorUp(rfs, local, remote, stats); err != nil {
+				return err
+			}
+			continue
+		}
+		if !item.Type().IsRegular() {
+			continue
+		}
+		info, err := item.Info()
+		if err != nil {
+			return fmt.Errorf("读取本地文件信息失败: %w", err)
+		}
+		if size, ok := remoteSizes[item.Name()]; ok && size == info.Size() {
+			stats.Skipped++
+			continue
+		}
+		if err := UploadFile(context.Background(), rfs, local, remote); err != nil {
+			return fmt.Errorf("上传 %s 失败: %w", local, err)
+		}
+		stats.Files++
+		stats.Bytes += info.Size()
+	}
+	return nil
+}
+
+// RemoveAll 删除文件，或递归删除目录及其内容
+func RemoveAll(rfs RemoteFS, target string) error {
+	e, err := rfs.Stat(target)
+	if err != nil {
+		return err
+	}
+	if !e.IsDir() {
+		return rfs.Remove(target)
+	}
+
+	entries, err := rfs.List(target)
+	if err != nil {
+		return err
+	}
+	for _, e := range entries {
+		child := path.Join(target, e.Name)
+		if e.IsDir() {
+			err = RemoveAll(rfs, child)
+		} else {
+			err = rfs.Remove(child)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return rfs.Remove(target)
+}
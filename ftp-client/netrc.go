@@ -0,0 +1,270 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+)
+
+// 环境变量中的凭据，优先于 ~/.netrc
+const (
+	EnvFTPUser     = "FTP_USER"
+	EnvFTPPassword = "FTP_PASSWORD"
+	EnvNetrc       = "NETRC" // 自定义 netrc 文件路径
+)
+
+// NetrcMachine netrc 中的一个 machine 或 default 条目
+type NetrcMachine struct {
+	Name     string
+	Login    string
+	Password string
+	Default  bool
+}
+
+// Netrc 解析后的 netrc 文件
+type Netrc struct {
+	Machines []NetrcMachine
+	Macros   map[string]string // macdef 名称 -> 宏内容
+}
+
+// netrcTokenizer 按空白拆分 netrc，支持双引号和反斜杠转义
+type netrcTokenizer struct {
+	r *bufio.Reader
+}
+
+func (t *netrcTokenizer) next() (string, error) {
+	// 跳过空白
+	var c rune
+	var err error
+	for {
+		c, _, err = t.r.ReadRune()
+		if err != nil {
+			return "", err
+		}
+		if c == '#' {
+			// 注释到行尾
+			if _, err := t.r.ReadString('\n'); err != nil {
+				return "", err
+			}
+			continue
+		}
+		if !strings.ContainsRune(" \t\r\n", c) {
+			break
+		}
+	}
+
+	var sb strings.Builder
+	quoted := c == '"'
+	if !quoted {
+		t.r.UnreadRune()
+	}
+	for {
+		c, _, err = t.r.ReadRune()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return "", err
+		}
+		if quoted && c == '"' {
+			break
+		}
+		if !quoted && strings.ContainsRune(" \t\r\n", c) {
+			// 保留分隔符，macdef 需要根据换行找到宏内容的开始
+			t.r.UnreadRune()
+			break
+		}
+		if c == '\\' {
+			if c, _, err = t.r.ReadRune(); err != nil {
+				break
+			}
+		}
+		sb.WriteRune(c)
+	}
+	return sb.String(), nil
+}
+
+// macro 读取 macdef 的内容：从下一行开始，直到空行为止
+func (t *netrcTokenizer) macro() (string, error) {
+	// 丢弃 macdef 名称所在行的剩余部分
+	if _, err := t.r.ReadString('\n'); err != nil {
+		return "", nil
+	}
+	var lines []string
+	for {
+		line, err := t.r.ReadString('\n')
+		line = strings.TrimRight(line, "\r\n")
+		if line == "" {
+			return strings.Join(lines, "\n"), nil
+		}
+		lines = append(lines, line)
+		if err != nil {
+			return strings.Join(lines, "\n"), nil
+		}
+	}
+}
+
+// ParseNetrc 解析 netrc 内容 (machine/default/login/password/macdef，account 被忽略)
+func ParseNetrc(r io.Reader) (*Netrc, error) {
+	n := &Netrc{Macros: map[string]string{}}
+	t := &netrcTokenizer{r: bufio.NewReader(r)}
+	var current *NetrcMachine
+
+	for {
+		token, err := t.next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("读取netrc失败: %v", err)
+		}
+
+		switch token {
+		case "machine", "default":
+			n.Machines = append(n.Machines, NetrcMachine{Default: token == "default"})
+			current = &n.Machines[len(n.Machines)-1]
+			if token == "machine" {
+				if current.Name, err = t.next(); err != nil {
+					return nil, fmt.Errorf("netrc: machine 缺少主机名")
+				}
+			}
+		case "login", "password", "account":
+			value, err := t.next()
+			if err != nil {
+				return nil, fmt.Errorf("netrc: %s 缺少取值", token)
+			}
+			if current == nil {
+				return nil, fmt.Errorf("netrc: %s 出现在 machine 之前", token)
+			}
+			// 不支持 ACCT，account 的取值被忽略
+			switch token {
+			case "login":
+				current.Login = value
+			case "password":
+				current.Password = value
+			}
+		case "macdef":
+			name, err := t.next()
+			if err != nil {
+				return nil, fmt.Errorf("netrc: macdef 缺少名称")
+			}
+			body, _ := t.macro()
+			n.Macros[name] = body
+		default:
+			return nil, fmt.Errorf("netrc: 无法识别的关键字 %q", token)
+		}
+	}
+	return n, nil
+}
+
+// Find 查找主机对应的条目，login 非空时还需要用户名一致；找不到时返回 default 条目
+func (n *Netrc) Find(host, login string) *NetrcMachine {
+	var fallback *NetrcMachine
+	for i := range n.Machines {
+		m := &n.Machines[i]
+		if login != "" && m.Login != "" && m.Login != login {
+			continue
+		}
+		if m.Default {
+			if fallback == nil {
+				fallback = m
+			}
+			continue
+		}
+		if strings.EqualFold(m.Name, host) {
+			return m
+		}
+	}
+	return fallback
+}
+
+// netrcPath 返回 netrc 文件路径：$NETRC，否则为 ~/.netrc (Windows 下为 ~/_netrc)
+func netrcPath() string {
+	if p := os.Getenv(EnvNetrc); p != "" {
+		return p
+	}
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return ""
+	}
+	if runtime.GOOS == "windows" {
+		return filepath.Join(home, "_netrc")
+	}
+	return filepath.Join(home, ".netrc")
+}
+
+// LoadNetrc 读取并解析 netrc 文件。与其他 FTP 客户端一样，
+// 文件中含有密码时要求只有所有者可读写，否则拒绝使用
+func LoadNetrc(path string) (*Netrc, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	n, err := ParseNetrc(f)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", path, err)
+	}
+
+	hasPassword := false
+	for _, m := range n.Machines {
+		if m.Password != "" {
+			hasPassword = true
+		}
+	}
+	if hasPassword {
+		info, err := f.Stat()
+		if err != nil {
+			return nil, err
+		}
+		if err := checkNetrcPermissions(info); err != nil {
+			return nil, fmt.Errorf("%s: %v", path, err)
+		}
+	}
+	return n, nil
+}
+
+// ResolveCredentials 在没有提供密码时依次从环境变量 (FTP_USER/FTP_PASSWORD) 和 netrc 中查找凭据
+func ResolveCredentials(host, user, password string) (string, string, error) {
+	if password != "" {
+		return user, password, nil
+	}
+
+	envUser := os.Getenv(EnvFTPUser)
+	if envPassword := os.Getenv(EnvFTPPassword); envPassword != "" {
+		if user == "" || envUser == "" || envUser == user {
+			if user == "" {
+				user = envUser
+			}
+			return user, envPassword, nil
+		}
+	}
+	if user == "" {
+		user = envUser
+	}
+
+	path := netrcPath()
+	if path == "" {
+		return user, password, nil
+	}
+	n, err := LoadNetrc(path)
+	if os.IsNotExist(err) {
+		return user, password, nil
+	}
+	if err != nil {
+		return user, password, err
+	}
+	if m := n.Find(host, user); m != nil {
+		if user == "" {
+			user = m.Login
+		}
+		MyLogger.Info("using credentials from netrc", "machine", m.Name, "user", user)
+		return user, m.Password, nil
+	}
+	return user, password, nil
+}
@@ -0,0 +1,181 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"runtime"
+	"strings"
+	"testing"
+)
+
+func TestParseNetrc(t *testing.T) {
+	tests := []struct {
+		name     string
+		input    string
+		machines []NetrcMachine
+		macros   map[string]string
+		err      bool
+	}{
+		{
+			name:  "machine and default",
+			input: "machine ftp.example.com login alice password secret\ndefault login anonymous password guest@\n",
+			machines: []NetrcMachine{
+				{Name: "ftp.example.com", Login: "alice", Password: "secret"},
+				{Login: "anonymous", Password: "guest@", Default: true},
+			},
+		},
+		{
+			name:     "tokens across lines and comments",
+			input:    "# servers\nmachine a.example.com\n  login bob # the admin\n  password pw account acct\n",
+			machines: []NetrcMachine{{Name: "a.example.com", Login: "bob", Password: "pw"}},
+		},
+		{
+			name:     "quoted tokens",
+			input:    `machine h login "my user" password "p a\"ss\\word"`,
+			machines: []NetrcMachine{{Name: "h", Login: "my user", Password: `p a"ss\word`}},
+		},
+		{
+			name:     "escaped space",
+			input:    `machine h login a\ b password x`,
+			machines: []NetrcMachine{{Name: "h", Login: "a b", Password: "x"}},
+		},
+		{
+			name:  "macdef body is skipped until an empty line",
+			input: "macdef init\ncd /pub\nmachine evil login x password y\n\nmachine h login a password b\n",
+			machines: []NetrcMachine{
+				{Name: "h", Login: "a", Password: "b"},
+			},
+			macros: map[string]string{"init": "cd /pub\nmachine evil login x password y"},
+		},
+		{
+			name:   "macdef at the end of the file",
+			input:  "machine h login a\nmacdef upload\nput x",
+			macros: map[string]string{"upload": "put x"},
+			machines: []NetrcMachine{
+				{Name: "h", Login: "a"},
+			},
+		},
+		{name: "unknown keyword", input: "machine h user a", err: true},
+		{name: "login before machine", input: "login a password b", err: true},
+		{name: "machine without a name", input: "machine", err: true},
+		{name: "password without a value", input: "machine h password", err: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			n, err := ParseNetrc(strings.NewReader(tt.input))
+			if tt.err {
+				if err == nil {
+					t.Fatalf("parsed %+v, want an error", n.Machines)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(n.Machines, tt.machines) {
+				t.Errorf("machines = %+v, want %+v", n.Machines, tt.machines)
+			}
+			if tt.macros == nil {
+				tt.macros = map[string]string{}
+			}
+			if !reflect.DeepEqual(n.Macros, tt.macros) {
+				t.Errorf("macros = %q, want %q", n.Macros, tt.macros)
+			}
+		})
+	}
+}
+
+func TestNetrcFind(t *testing.T) {
+	n, err := ParseNetrc(strings.NewReader(`
+machine ftp.example.com login alice password a
+machine ftp.example.com login bob password b
+default login anonymous password guest@
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		host, login string
+		want        string // 找到的条目的密码，空表示找不到
+	}{
+		{"ftp.example.com", "", "a"},
+		{"FTP.Example.com", "bob", "b"},
+		{"ftp.example.com", "carol", ""},
+		{"other.example.com", "", "guest@"},
+		{"other.example.com", "anonymous", "guest@"},
+	}
+	for _, tt := range tests {
+		got := ""
+		if m := n.Find(tt.host, tt.login); m != nil {
+			got = m.Password
+		}
+		if got != tt.want {
+			t.Errorf("Find(%q, %q) password = %q, want %q", tt.host, tt.login, got, tt.want)
+		}
+	}
+}
+
+func TestLoadNetrcPermissions(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("netrc permissions are not checked on Windows")
+	}
+	dir := t.TempDir()
+	tests := []struct {
+		name    string
+		content string
+		mode    os.FileMode
+		err     bool
+	}{
+		{"private with password", "machine h login a password b", 0600, false},
+		{"readable with password", "machine h login a password b", 0644, true},
+		{"group readable with password", "machine h login a password b", 0640, true},
+		{"readable without password", "machine h login a", 0644, false},
+	}
+	for i, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := filepath.Join(dir, "netrc"+string(rune('a'+i)))
+			if err := os.WriteFile(p, []byte(tt.content), tt.mode); err != nil {
+				t.Fatal(err)
+			}
+			os.Chmod(p, tt.mode)
+			_, err := LoadNetrc(p)
+			if (err != nil) != tt.err {
+				t.Fatalf("LoadNetrc() error = %v, want error %v", err, tt.err)
+			}
+		})
+	}
+}
+
+func TestResolveCredentials(t *testing.T) {
+	p := filepath.Join(t.TempDir(), "netrc")
+	os.WriteFile(p, []byte("machine ftp.example.com login alice password secret\n"), 0600)
+	t.Setenv(EnvNetrc, p)
+	t.Setenv(EnvFTPUser, "")
+	t.Setenv(EnvFTPPassword, "")
+
+	tests := []struct {
+		host, user, password string
+		wantUser, wantPass   string
+	}{
+		{"ftp.example.com", "bob", "given", "bob", "given"},
+		{"ftp.example.com", "", "", "alice", "secret"},
+		{"ftp.example.com", "alice", "", "alice", "secret"},
+		{"ftp.example.com", "bob", "", "bob", ""},
+		{"other.example.com", "", "", "", ""},
+	}
+	for _, tt := range tests {
+		user, password, err := ResolveCredentials(tt.host, tt.user, tt.password)
+		if err != nil || user != tt.wantUser || password != tt.wantPass {
+			t.Errorf("ResolveCredentials(%q, %q, %q) = %q, %q, %v, want %q, %q",
+				tt.host, tt.user, tt.password, user, password, err, tt.wantUser, tt.wantPass)
+		}
+	}
+
+	// 环境变量优先于 netrc
+	t.Setenv(EnvFTPUser, "env")
+	t.Setenv(EnvFTPPassword, "envpass")
+	if user, password, _ := ResolveCredentials("ftp.example.com", "", ""); user != "env" || password != "envpass" {
+		t.Errorf("environment credentials = %q, %q", user, password)
+	}
+}
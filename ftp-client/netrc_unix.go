@@ -0,0 +1,20 @@
+//go:build !windows
+
+package main
+
+import (
+	"fmt"
+	"os"
+	"syscall"
+)
+
+// checkNetrcPermissions 要求 netrc 属于当前用户且不能被组和其他用户访问
+func checkNetrcPermissions(info os.FileInfo) error {
+	if stat, ok := info.Sys().(*syscall.Stat_t); ok && int(stat.Uid) != os.Getuid() {
+		return fmt.Errorf("netrc 文件不属于当前用户")
+	}
+	if info.Mode().Perm()&0077 != 0 {
+		return fmt.Errorf("netrc 文件可被其他用户读取，请执行 chmod 600 或删除其中的密码")
+	}
+	return nil
+}
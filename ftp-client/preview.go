@@ -0,0 +1,138 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"path"
+	"strings"
+)
+
+// 预览读取的默认和最大字节数
+const (
+	defaultPreviewBytes = 1 << 20
+	maxPreviewBytes     = 16 << 20
+)
+
+// FilePreview 远程文件开头 (或 Offset 处) 的内容，只保存在内存中
+type FilePreview struct {
+	Path      string `json:"path"`
+	MIME      string `json:"mime"`
+	Language  string `json:"language,omitempty"` // 文本文件的语言，供前端语法高亮
+	Offset    int64  `json:"offset"`
+	Data      []byte `json:"data"`      // JSON 中为 base64
+	Truncated bool   `json:"truncated"` // 文件在 Offset+len(Data) 之后还有内容
+}
+
+// previewLanguages 按扩展名识别的源代码和配置文件
+var previewLanguages = map[string]string{
+	".go":   "go",
+	".py":   "python",
+	".js":   "javascript",
+	".ts":   "typescript",
+	".vue":  "html",
+	".html": "html",
+	".htm":  "html",
+	".xml":  "xml",
+	".css":  "css",
+	".json": "json",
+	".yaml": "yaml",
+	".yml":  "yaml",
+	".toml": "ini",
+	".ini":  "ini",
+	".conf": "ini",
+	".cfg":  "ini",
+	".sh":   "shell",
+	".bash": "shell",
+	".c":    "c",
+	".h":    "c",
+	".cpp":  "cpp",
+	".java": "java",
+	".rs":   "rust",
+	".sql":  "sql",
+	".md":   "markdown",
+	".log":  "log",
+}
+
+// sniffMIME 按内容判断类型，内容无法区分时 (如纯文本、XML) 参考扩展名
+func sniffMIME(name string, data []byte) string {
+	sniffed := http.DetectContentType(data)
+	byExt := mime.TypeByExtension(strings.ToLower(path.Ext(name)))
+	if byExt == "" {
+		return sniffed
+	}
+	switch strings.SplitN(sniffed, ";", 2)[0] {
+	case "application/octet-stream", "text/plain", "text/xml":
+		return byExt
+	}
+	return sniffed
+}
+
+// PreviewFile 从 offset 处读取最多 limit 字节 (limit <= 0 时为默认值)。
+// FTP 使用 REST + RETR，读够后直接关闭数据连接，不会下载整个文件
+func PreviewFile(rfs RemoteFS, p string, offset, limit int64) (FilePreview, error) {
+	if limit <= 0 {
+		limit = defaultPreviewBytes
+	}
+	if limit > maxPreviewBytes {
+		limit = maxPreviewBytes
+	}
+	r, err := rfs.Open(p, offset)
+	if err != nil {
+		return FilePreview{}, err
+	}
+	// 多读一个字节来判断是否还有剩余内容
+	data, err := io.ReadAll(io.LimitReader(r, limit+1))
+	closeErr := r.Close()
+	if err != nil {
+		return FilePreview{}, fmt.Errorf("读取文件失败: %v", err)
+	}
+	truncated := int64(len(data)) > limit
+	if truncated {
+		data = data[:limit]
+		// 提前关闭数据连接时服务器通常回复 426，这是预期的
+		if closeErr != nil {
+			MyLogger.Info("preview: transfer aborted", "path", p, "reply", closeErr)
+		}
+	} else if closeErr != nil {
+		return FilePreview{}, closeErr
+	}
+
+	preview := FilePreview{
+		Path:      p,
+		Offset:    offset,
+		Data:      data,
+		Truncated: truncated,
+	}
+	if offset == 0 {
+		preview.MIME = sniffMIME(p, data)
+	} else {
+		// 文件中间的内容无法判断类型，只按扩展名
+		preview.MIME = mime.TypeByExtension(strings.ToLower(path.Ext(p)))
+	}
+	if preview.MIME == "" {
+		preview.MIME = "application/octet-stream"
+	}
+	if strings.HasPrefix(preview.MIME, "text/") || previewLanguages[strings.ToLower(path.Ext(p))] != "" {
+		preview.Language = previewLanguages[strings.ToLower(path.Ext(p))]
+		if preview.Language == "" {
+			preview.Language = "plaintext"
+		}
+	}
+	return preview, nil
+}
+
+// Preview 读取远程文件的前 limit 字节用于预览，offset 大于 0 时从该位置继续读取 (加载更多)
+func (a *App) Preview(sessionID, remotePath string, offset, limit int64) (FilePreview, error) {
+	var preview FilePreview
+	err := withSession(sessionID, func(s *Session) (err error) {
+		preview, err = PreviewFile(s.fs, remotePath, offset, limit)
+		return err
+	})
+	if err != nil {
+		MyLogger.Info("failed to preview: ", err)
+		return FilePreview{}, fmt.Errorf("failed to preview %s: %v", remotePath, err)
+	}
+	return preview, nil
+}
@@ -0,0 +1,271 @@
+package main
+
+import (
+	"crypto/tls"
+	"encoding/json"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+)
+
+// 连接协议
+const (
+	ProtocolFTP  = "ftp"
+	ProtocolSFTP = "sftp"
+)
+
+// Profile 保存的服务器连接配置
+type Profile struct {
+	Name     string      `json:"name"`
+	Protocol string      `json:"protocol"` // ftp (默认) 或 sftp
+	Address  string      `json:"address"`  // host:port
+	Username string      `json:"username"`
+	Password string      `json:"password,omitempty"` // 为空时从 FTP_USER/FTP_PASSWORD 或 netrc 读取；SFTP 私钥加密时作为口令
+	KeyFile  string      `json:"keyFile,omitempty"`  // SFTP 私钥路径
+	TLS      bool        `json:"tls"`                // 使用 AUTH TLS (显式 FTPS)
+	Insecure bool        `json:"insecure"`           // 跳过证书或主机密钥校验
+	Proxy    ProxyConfig `json:"proxy"`
+	Charset  string      `json:"charset,omitempty"`  // FTP 服务器不支持 UTF8 时文件名的字符集，为空表示 UTF-8
+	Compress bool        `json:"compress,omitempty"` // 服务器支持时使用 MODE Z 压缩数据连接
+	// CompressLevel MODE Z 的压缩级别 1-9，0 表示默认
+	CompressLevel int `json:"compressLevel,omitempty"`
+	// KnownHosts SFTP 主机密钥文件，为空时使用 configDir/known_hosts 并参考 ~/.ssh/known_hosts
+	KnownHosts string `json:"knownHosts,omitempty"`
+}
+
+// profilesMu 保护配置文件的读写
+var profilesMu sync.Mutex
+
+// configDir 返回保存连接配置、传输记录和定时任务的目录 (用户配置目录/ftp-client)，测试中替换为临时目录
+var configDir = func() (string, error) {
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, "ftp-client"), nil
+}
+
+// profilesPath 返回配置文件路径 (configDir/profiles.json)
+func profilesPath() (string, error) {
+	dir, err := configDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, "profiles.json"), nil
+}
+
+// LoadProfiles 读取保存的连接配置，文件不存在时返回空列表
+func LoadProfiles() ([]Profile, error) {
+	profilesMu.Lock()
+	defer profilesMu.Unlock()
+	return loadProfiles()
+}
+
+func loadProfiles() ([]Profile, error) {
+	path, err := profilesPath()
+	if err != nil {
+		return nil, err
+	}
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return []Profile{}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var profiles []Profile
+	if err := json.Unmarshal(data, &profiles); err != nil {
+		return nil, fmt.Errorf("%s: %v", path, err)
+	}
+	return profiles, nil
+}
+
+// saveProfiles 写入配置文件；文件中可能有密码，只允许所有者读写
+func saveProfiles(profiles []Profile) error {
+	path, err := profilesPath()
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return err
+	}
+	sort.Slice(profiles, func(i, j int) bool { return profiles[i].Name < profiles[j].Name })
+	data, err := json.MarshalIndent(profiles, "", "  ")
+	if err != nil {
+		return err
+	}
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0600); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
+
+// FindProfile 按名称查找连接配置
+func FindProfile(name string) (Profile, error) {
+	profiles, err := LoadProfiles()
+	if err != nil {
+		return Profile{}, err
+	}
+	for _, p := range profiles {
+		if p.Name == name {
+			return p, nil
+		}
+	}
+	return Profile{}, fmt.Errorf("profile %q not found", name)
+}
+
+// Connect 按 FTP 配置连接并登录，代理同时用于控制连接和数据连接
+func (p Profile) Connect(client *FTPConn) error {
+	if p.Protocol == ProtocolSFTP {
+		return fmt.Errorf("profile %q 是 SFTP 连接", p.Name)
+	}
+	dialer, err := p.Proxy.Dialer()
+	if err != nil {
+		return err
+	}
+	host, _, err := net.SplitHostPort(p.Address)
+	if err != nil {
+		host = p.Address
+	}
+	username, password, err := ResolveCredentials(host, p.Username, p.Password)
+	if err != nil {
+		return fmt.Errorf("读取凭据失败: %v", err)
+	}
+
+	if err := client.SetCharset(p.Charset); err != nil {
+		return err
+	}
+	if err := client.SetCompression(p.Compress, p.CompressLevel); err != nil {
+		return err
+	}
+	client.SetDialer(dialer)
+	if err := client.Dial(p.Address); err != nil {
+		return err
+	}
+	if p.TLS {
+		config := &tls.Config{ServerName: host, InsecureSkipVerify: p.Insecure}
+		if err := client.AuthTLS(config); err != nil {
+			client.Quit()
+			return err
+		}
+	}
+	if err := client.Login(username, password); err != nil {
+		client.Quit()
+		return fmt.Errorf("登录失败: %v", err)
+	}
+	return nil
+}
+
+// Open 按配置建立一个新的连接，FTP 和 SFTP 均可
+func (p Profile) Open() (RemoteFS, error) {
+	if p.Protocol == ProtocolSFTP {
+		return DialSFTP(p)
+	}
+	client := NewFTPClient()
+	if err := p.Connect(client.FTPConn); err != nil {
+		return nil, err
+	}
+	return client, nil
+}
+
+// Profiles 返回保存的连接配置
+func (a *App) Profiles() ([]Profile, error) {
+	profiles, err := LoadProfiles()
+	if err != nil {
+		MyLogger.Info("failed to load profiles: ", err)
+		return nil, fmt.Errorf("failed to load profiles: %v", err)
+	}
+	return profiles, nil
+}
+
+// SaveProfile 新增或按名称更新连接配置
+func (a *App) SaveProfile(profile Profile) error {
+	if profile.Name == "" || profile.Address == "" {
+		return fmt.Errorf("profile name and address are required")
+	}
+	switch profile.Protocol {
+	case "", ProtocolFTP, ProtocolSFTP:
+	default:
+		return fmt.Errorf("unsupported protocol %q", profile.Protocol)
+	}
+	if _, err := profile.Proxy.Dialer(); err != nil {
+		return err
+	}
+	if _, _, err := lookupCharset(profile.Charset); err != nil {
+		return err
+	}
+	if profile.CompressLevel < 0 || profile.CompressLevel > 9 {
+		return fmt.Errorf("compression level must be between 0 and 9")
+	}
+	profilesMu.Lock()
+	defer profilesMu.Unlock()
+	profiles, err := loadProfiles()
+	if err != nil {
+		return fmt.Errorf("failed to load profiles: %v", err)
+	}
+	replaced := false
+	for i := range profiles {
+		if profiles[i].Name == profile.Name {
+			profiles[i] = profile
+			replaced = true
+		}
+	}
+	if !replaced {
+		profiles = append(profiles, profile)
+	}
+	if err := saveProfiles(profiles); err != nil {
+		MyLogger.Info("failed to save profile: ", err)
+		return fmt.Errorf("failed to save profile: %v", err)
+	}
+	return nil
+}
+
+// DeleteProfile 删除连接配置
+func (a *App) DeleteProfile(name string) error {
+	profilesMu.Lock()
+	defer profilesMu.Unlock()
+	profiles, err := loadProfiles()
+	if err != nil {
+		return fmt.Errorf("failed to load profiles: %v", err)
+	}
+	kept := profiles[:0]
+	for _, p := range profiles {
+		if p.Name != name {
+			kept = append(kept, p)
+		}
+	}
+	if len(kept) == len(profiles) {
+		return fmt.Errorf("profile %q not found", name)
+	}
+	return saveProfiles(kept)
+}
+
+// ConnectProfile 使用保存的配置连接服务器并返回新会话的 ID，SFTP 配置通过 SSH 连接
+func (a *App) ConnectProfile(name string) (string, error) {
+	profile, err := FindProfile(name)
+	if err != nil {
+		return "", err
+	}
+	var s *Session
+	if profile.Protocol == ProtocolSFTP {
+		sftpFS, err := DialSFTP(profile)
+		if err != nil {
+			MyLogger.Info("failed to connect", "profile", name, "error", err)
+			return "", fmt.Errorf("failed to connect: %v", err)
+		}
+		s = addSession(sftpFS, nil, profile)
+	} else {
+		client := NewFTPClient()
+		if err := profile.Connect(client.FTPConn); err != nil {
+			MyLogger.Info("failed to connect", "profile", name, "error", err)
+			return "", fmt.Errorf("failed to connect: %v", err)
+		}
+		s = addSession(client, client, profile)
+	}
+	MyLogger.Info("connected", "session", s.ID, "profile", name, "protocol", profile.Protocol, "address", profile.Address, "proxy", profile.Proxy.Type)
+	return s.ID, nil
+}
@@ -0,0 +1,203 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"net"
+	"sync"
+	"time"
+)
+
+// progressInterval 两次进度事件之间的最短间隔
+const progressInterval = 250 * time.Millisecond
+
+// TransferProgress transfer-progress 事件的内容
+type TransferProgress struct {
+	JobID       string  `json:"jobId"`
+	Kind        string  `json:"kind"`
+	Name        string  `json:"name"` // 任务名称，通常为远程路径
+	File        string  `json:"file"` // 当前正在传输的文件 (递归操作中会变化)
+	Transferred int64   `json:"transferred"`
+	Total       int64   `json:"total"`    // 0 表示未知
+	Speed       float64 `json:"speed"`    // 瞬时速度，字节/秒
+	AvgSpeed    float64 `json:"avgSpeed"` // 平均速度，字节/秒
+	ETA         float64 `json:"eta"`      // 预计剩余秒数，-1 表示未知
+	Done        bool    `json:"done"`
+	Error       string  `json:"error,omitempty"`
+}
+
+// progressTracker 统计任务的传输字节数和速度，并按固定间隔上报
+type progressTracker struct {
+	mu          sync.Mutex
+	report      func(TransferProgress)
+	file        string
+	transferred int64
+	total       int64
+	resumed     int64 // 断点续传时已存在的字节数，不计入速度
+	started     time.Time
+	lastEmit    time.Time
+	lastBytes   int64
+	speed       float64
+}
+
+func newProgressTracker(report func(TransferProgress)) *progressTracker {
+	now := time.Now()
+	return &progressTracker{report: report, started: now, lastEmit: now}
+}
+
+// AddTotal 增加任务的总字节数，递归操作每发现一批文件调用一次
+func (job *TransferJob) AddTotal(n int64) {
+	if job == nil {
+		return
+	}
+	job.progress.mu.Lock()
+	job.progress.total += n
+	job.progress.mu.Unlock()
+}
+
+// SetFile 设置当前正在传输的文件
+func (job *TransferJob) SetFile(name string) {
+	if job == nil {
+		return
+	}
+	job.progress.mu.Lock()
+	job.progress.file = name
+	job.progress.mu.Unlock()
+}
+
+// Resume 记录断点续传时已传输的字节数
+func (job *TransferJob) Resume(offset int64) {
+	if job == nil {
+		return
+	}
+	p := job.progress
+	p.mu.Lock()
+	p.transferred += offset
+	p.resumed += offset
+	p.lastBytes += offset
+	p.mu.Unlock()
+}
+
+// Add 记录新传输的字节，距上次上报超过 progressInterval 时上报一次
+func (job *TransferJob) Add(n int) {
+	if job == nil || n <= 0 {
+		return
+	}
+	p := job.progress
+	p.mu.Lock()
+	p.transferred += int64(n)
+	now := time.Now()
+	if now.Sub(p.lastEmit) < progressInterval {
+		p.mu.Unlock()
+		return
+	}
+	// 瞬时速度取指数移动平均，避免数值跳动
+	instant := float64(p.transferred-p.lastBytes) / now.Sub(p.lastEmit).Seconds()
+	if p.speed == 0 {
+		p.speed = instant
+	} else {
+		p.speed = 0.3*instant + 0.7*p.speed
+	}
+	p.lastEmit = now
+	p.lastBytes = p.transferred
+	snapshot := job.snapshotLocked(now)
+	p.mu.Unlock()
+
+	if p.report != nil {
+		p.report(snapshot)
+	}
+}
+
+// snapshotLocked 生成当前进度，调用方需持有 progress.mu
+func (job *TransferJob) snapshotLocked(now time.Time) TransferProgress {
+	p := job.progress
+	progress := TransferProgress{
+		JobID:       job.ID,
+		Kind:        job.Kind,
+		Name:        job.Name,
+		File:        p.file,
+		Transferred: p.transferred,
+		Total:       p.total,
+		Speed:       p.speed,
+		ETA:         -1,
+	}
+	if elapsed := now.Sub(p.started).Seconds(); elapsed > 0 {
+		progress.AvgSpeed = float64(p.transferred-p.resumed) / elapsed
+	}
+	if p.total > 0 && progress.AvgSpeed > 0 {
+		remaining := p.total - p.transferred
+		if remaining < 0 {
+			remaining = 0
+		}
+		// 用瞬时速度和平均速度的均值估算，兼顾限速调整和长期趋势
+		speed := progress.AvgSpeed
+		if p.speed > 0 {
+			speed = (p.speed + progress.AvgSpeed) / 2
+		}
+		progress.ETA = float64(remaining) / speed
+	}
+	return progress
+}
+
+// Snapshot 返回任务当前的进度
+func (job *TransferJob) Snapshot() TransferProgress {
+	job.progress.mu.Lock()
+	defer job.progress.mu.Unlock()
+	return job.snapshotLocked(time.Now())
+}
+
+// progressConn 统计数据连接上读写的字节数
+type progressConn struct {
+	net.Conn
+	job *TransferJob
+}
+
+func (c *progressConn) Read(p []byte) (int, error) {
+	n, err := c.Conn.Read(p)
+	c.job.Add(n)
+	return n, err
+}
+
+func (c *progressConn) Write(p []byte) (int, error) {
+	n, err := c.Conn.Write(p)
+	c.job.Add(n)
+	return n, err
+}
+
+// newProgressBar 返回在终端上显示单行进度条的上报函数
+func newProgressBar(w io.Writer) func(TransferProgress) {
+	return func(p TransferProgress) {
+		name := p.File
+		if name == "" {
+			name = p.Name
+		}
+		if p.Done {
+			fmt.Fprint(w, "\r\033[K")
+			return
+		}
+		line := fmt.Sprintf("%s  %s  %s/s", name, formatBytes(p.Transferred), formatBytes(int64(p.Speed)))
+		if p.Total > 0 {
+			line = fmt.Sprintf("%s  %3d%%  %s/%s  %s/s", name, p.Transferred*100/p.Total,
+				formatBytes(p.Transferred), formatBytes(p.Total), formatBytes(int64(p.Speed)))
+		}
+		if p.ETA >= 0 {
+			eta := time.Duration(p.ETA) * time.Second
+			line += fmt.Sprintf("  ETA %02d:%02d", int(eta.Minutes()), int(eta.Seconds())%60)
+		}
+		fmt.Fprint(w, "\r\033[K"+line)
+	}
+}
+
+// formatBytes 以 B/KB/MB/GB 显示字节数
+func formatBytes(n int64) string {
+	switch {
+	case n < 1024:
+		return fmt.Sprintf("%d B", n)
+	case n < 1024*1024:
+		return fmt.Sprintf("%.1f KB", float64(n)/1024)
+	case n < 1024*1024*1024:
+		return fmt.Sprintf("%.1f MB", float64(n)/(1024*1024))
+	default:
+		return fmt.Sprintf("%.2f GB", float64(n)/(1024*1024*1024))
+	}
+}
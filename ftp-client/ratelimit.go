@@ -0,0 +1,212 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"math"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// GlobalLimiter 所有连接、所有传输共享的总带宽限制，0 表示不限速
+var GlobalLimiter = NewRateLimiter(0)
+
+// RateLimiter 令牌桶限速器 (字节/秒)，速率可以在传输过程中随时调整
+type RateLimiter struct {
+	mu     sync.Mutex
+	rate   int64 // 每秒字节数，<= 0 表示不限速
+	tokens float64
+	last   time.Time
+}
+
+// NewRateLimiter 创建限速器，bytesPerSec <= 0 表示不限速
+func NewRateLimiter(bytesPerSec int64) *RateLimiter {
+	l := &RateLimiter{}
+	l.SetRate(bytesPerSec)
+	return l
+}
+
+// SetRate 调整速率，正在进行的传输在下一次读写时生效
+func (l *RateLimiter) SetRate(bytesPerSec int64) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if bytesPerSec < 0 {
+		bytesPerSec = 0
+	}
+	l.rate = bytesPerSec
+	l.last = time.Now()
+	if l.tokens > float64(l.burst()) {
+		l.tokens = float64(l.burst())
+	}
+}
+
+// Rate 返回当前速率，0 表示不限速
+func (l *RateLimiter) Rate() int64 {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.rate
+}
+
+// burst 桶容量：约 200ms 的流量，也是单次读写的最大字节数
+func (l *RateLimiter) burst() int {
+	b := l.rate / 5
+	if b < 1024 {
+		b = 1024
+	}
+	return int(b)
+}
+
+// chunk 返回单次读写允许的最大字节数，不限速时返回 n
+func (l *RateLimiter) chunk(n int) int {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.rate <= 0 {
+		return n
+	}
+	if b := l.burst(); n > b {
+		return b
+	}
+	return n
+}
+
+// WaitN 阻塞直到可以传输 n 个字节；等待期间速率被修改会立即按新速率计算
+func (l *RateLimiter) WaitN(n int) {
+	for {
+		l.mu.Lock()
+		if l.rate <= 0 {
+			l.mu.Unlock()
+			return
+		}
+		now := time.Now()
+		l.tokens += now.Sub(l.last).Seconds() * float64(l.rate)
+		l.last = now
+		burst := float64(l.burst())
+		if l.tokens > burst {
+			l.tokens = burst
+		}
+		// 速率在读写过程中被调低时，n 可能超过新的桶容量
+		need := float64(n)
+		if need > burst {
+			need = burst
+		}
+		if l.tokens >= need {
+			l.tokens -= need
+			l.mu.Unlock()
+			return
+		}
+		wait := time.Duration((need - l.tokens) / float64(l.rate) * float64(time.Second))
+		l.mu.Unlock()
+
+		// 分段等待，以便速率调整尽快生效
+		if wait > 100*time.Millisecond {
+			wait = 100 * time.Millisecond
+		}
+		time.Sleep(wait)
+	}
+}
+
+// throttle 同时生效的一组限速器
+type throttle []*RateLimiter
+
+// newThrottle 忽略 nil 限速器
+func newThrottle(limiters ...*RateLimiter) throttle {
+	active := make(throttle, 0, len(limiters))
+	for _, l := range limiters {
+		if l != nil {
+			active = append(active, l)
+		}
+	}
+	return active
+}
+
+func (t throttle) chunk(n int) int {
+	for _, l := range t {
+		n = l.chunk(n)
+	}
+	return n
+}
+
+func (t throttle) wait(n int) {
+	for _, l := range t {
+		l.WaitN(n)
+	}
+}
+
+// read 按限速从 r 读取，单次最多读取一个桶容量
+func (t throttle) read(r io.Reader, p []byte) (int, error) {
+	p = p[:t.chunk(len(p))]
+	n, err := r.Read(p)
+	if n > 0 {
+		t.wait(n)
+	}
+	return n, err
+}
+
+// write 按限速分段写入 w
+func (t throttle) write(w io.Writer, p []byte) (int, error) {
+	written := 0
+	for written < len(p) {
+		n := t.chunk(len(p) - written)
+		t.wait(n)
+		m, err := w.Write(p[written : written+n])
+		written += m
+		if err != nil {
+			return written, err
+		}
+	}
+	return written, nil
+}
+
+// throttledConn 按一组限速器限制数据连接的读写速度
+type throttledConn struct {
+	net.Conn
+	throttle throttle
+}
+
+// newThrottledConn 包装数据连接，nil 限速器会被忽略
+func newThrottledConn(conn net.Conn, limiters ...*RateLimiter) net.Conn {
+	t := newThrottle(limiters...)
+	if len(t) == 0 {
+		return conn
+	}
+	return &throttledConn{Conn: conn, throttle: t}
+}
+
+func (c *throttledConn) Read(p []byte) (int, error) {
+	return c.throttle.read(c.Conn, p)
+}
+
+func (c *throttledConn) Write(p []byte) (int, error) {
+	return c.throttle.write(c.Conn, p)
+}
+
+// ParseByteRate 解析 "512K"、"2M"、"1048576" 这样的速率，单位为字节/秒
+func ParseByteRate(rate string) (int64, error) {
+	s := strings.TrimSpace(strings.ToUpper(rate))
+	s = strings.TrimSuffix(strings.TrimSuffix(s, "/S"), "B")
+	multiplier := int64(1)
+	switch {
+	case strings.HasSuffix(s, "K"):
+		multiplier = 1024
+	case strings.HasSuffix(s, "M"):
+		multiplier = 1024 * 1024
+	case strings.HasSuffix(s, "G"):
+		multiplier = 1024 * 1024 * 1024
+	}
+	if multiplier != 1 {
+		s = s[:len(s)-1]
+	}
+	value, err := strconv.ParseFloat(s, 64)
+	if err != nil || value < 0 || math.IsInf(value, 0) || math.IsNaN(value) {
+		return 0, fmt.Errorf("无效的速率: %q", rate)
+	}
+	// float64(math.MaxInt64) 等于 2^63，超出 int64 的速率转换后没有意义
+	bytes := value * float64(multiplier)
+	if bytes >= math.MaxInt64 {
+		return 0, fmt.Errorf("速率过大: %q", rate)
+	}
+	return int64(bytes), nil
+}
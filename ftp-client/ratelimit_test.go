@@ -0,0 +1,132 @@
+package main
+
+import (
+	"bytes"
+	"io"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParseByteRate(t *testing.T) {
+	tests := []struct {
+		s    string
+		want int64
+	}{
+		{"1048576", 1048576},
+		{"0", 0},
+		{"512K", 512 << 10},
+		{"512k", 512 << 10},
+		{" 64K ", 64 << 10},
+		{"2M", 2 << 20},
+		{"1.5M", 3 << 19},
+		{"1G", 1 << 30},
+		{"100KB", 100 << 10},
+		{"100KB/s", 100 << 10},
+		{"100kb/s", 100 << 10},
+		{"300B/s", 300},
+	}
+	for _, tt := range tests {
+		got, err := ParseByteRate(tt.s)
+		if err != nil || got != tt.want {
+			t.Errorf("ParseByteRate(%q) = %d, %v, want %d", tt.s, got, err, tt.want)
+		}
+	}
+	for _, s := range []string{"", "K", "fast", "-1K", "1T", "1KK", "inf", "+Inf", "NaN", "infK", "1e400", "1e30", "9223372036854775807", "9E9G"} {
+		if _, err := ParseByteRate(s); err == nil {
+			t.Errorf("ParseByteRate(%q) succeeded", s)
+		} else if !strings.Contains(err.Error(), s) {
+			t.Errorf("ParseByteRate(%q) error %q does not quote the input", s, err)
+		}
+	}
+}
+
+func TestRateLimiterBurst(t *testing.T) {
+	tests := []struct {
+		rate  int64
+		n     int
+		chunk int
+	}{
+		{0, 1 << 20, 1 << 20},
+		{-1, 1 << 20, 1 << 20},
+		{1024, 64 << 10, 1024},
+		{100 << 10, 64 << 10, 20 << 10},
+		{100 << 10, 512, 512},
+	}
+	for _, tt := range tests {
+		l := NewRateLimiter(tt.rate)
+		if got := l.chunk(tt.n); got != tt.chunk {
+			t.Errorf("rate %d: chunk(%d) = %d, want %d", tt.rate, tt.n, got, tt.chunk)
+		}
+	}
+	if l := NewRateLimiter(-5); l.Rate() != 0 {
+		t.Errorf("negative rate = %d, want 0", l.Rate())
+	}
+}
+
+func TestRateLimiterRefill(t *testing.T) {
+	elapsed := func(fn func()) time.Duration {
+		start := time.Now()
+		fn()
+		return time.Since(start)
+	}
+
+	// 10 KB/s，桶容量 2 KB (200ms)；新建时桶是空的
+	l := NewRateLimiter(10 << 10)
+	if d := elapsed(func() { l.WaitN(2 << 10) }); d < 150*time.Millisecond || d > time.Second {
+		t.Fatalf("first burst took %v, want about 200ms", d)
+	}
+	// 空闲期间桶被填满，但不会超过容量
+	time.Sleep(500 * time.Millisecond)
+	if d := elapsed(func() { l.WaitN(2 << 10) }); d > 50*time.Millisecond {
+		t.Fatalf("refilled burst took %v", d)
+	}
+	if d := elapsed(func() { l.WaitN(2 << 10) }); d < 150*time.Millisecond {
+		t.Fatalf("burst after an idle period took %v, the bucket held more than its capacity", d)
+	}
+	// 超过桶容量的请求只等待一个桶容量
+	if d := elapsed(func() { l.WaitN(1 << 20) }); d > time.Second {
+		t.Fatalf("oversized wait took %v", d)
+	}
+	// 调为不限速后立即返回
+	l.SetRate(0)
+	if d := elapsed(func() { l.WaitN(1 << 30) }); d > 50*time.Millisecond {
+		t.Fatalf("unlimited wait took %v", d)
+	}
+}
+
+func TestThrottle(t *testing.T) {
+	l := NewRateLimiter(10 << 10)
+	th := newThrottle(nil, l, nil)
+	if len(th) != 1 {
+		t.Fatalf("throttle kept %d limiters", len(th))
+	}
+
+	// 单次读取不超过桶容量
+	p := make([]byte, 64<<10)
+	n, err := th.read(bytes.NewReader(make([]byte, 64<<10)), p)
+	if err != nil || n != 2<<10 {
+		t.Fatalf("read = %d, %v, want %d", n, err, 2<<10)
+	}
+
+	// 6 KB 分段写入，约 600ms
+	var buf bytes.Buffer
+	start := time.Now()
+	if n, err := th.write(&buf, make([]byte, 6<<10)); err != nil || n != 6<<10 {
+		t.Fatalf("write = %d, %v", n, err)
+	}
+	if d := time.Since(start); d < 400*time.Millisecond || d > 3*time.Second {
+		t.Fatalf("6 KB at 10 KB/s took %v", d)
+	}
+	if buf.Len() != 6<<10 {
+		t.Fatalf("wrote %d bytes", buf.Len())
+	}
+
+	// 没有限速器时直接读写
+	if n, err := newThrottle().read(strings.NewReader("abc"), p); err != nil || n != 3 {
+		t.Fatalf("unthrottled read = %d, %v", n, err)
+	}
+	if _, err := newThrottle().read(strings.NewReader(""), p); err != io.EOF {
+		t.Fatalf("unthrottled read at EOF = %v", err)
+	}
+}
@@ -0,0 +1,256 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"io/fs"
+	"net"
+	"os"
+	"path"
+	"strings"
+)
+
+// RemoteFS 远程文件系统，App、镜像等功能通过它访问 FTP 或 SFTP 服务器
+type RemoteFS interface {
+	List(path string) ([]Entry, error)
+	// Stat 返回单个文件或目录的信息，不存在时错误满足 errors.Is(err, fs.ErrNotExist)
+	Stat(path string) (Entry, error)
+	// Open 从 offset 处开始读取文件，读完后必须 Close
+	Open(path string, offset int64) (io.ReadCloser, error)
+	// Create 创建或覆盖文件，写完后必须 Close，Close 返回错误表示上传失败
+	Create(path string) (io.WriteCloser, error)
+	// Append 在文件末尾追加写入，文件不存在时创建
+	Append(path string) (io.WriteCloser, error)
+	Mkdir(path string) error
+	// Remove 删除文件或空目录
+	Remove(path string) error
+	Rename(from, to string) error
+	Chmod(path string, mode os.FileMode) error
+	// RunJob 在 job 下执行 fn，期间的数据传输计入 job 的限速和进度
+	RunJob(job *TransferJob, fn func() error) error
+	// Job 返回当前的传输任务，没有时为 nil
+	Job() *TransferJob
+	// Close 断开连接
+	Close() error
+}
+
+// 确保 FTP 连接实现了 RemoteFS
+var _ RemoteFS = (*FTPConn)(nil)
+
+// Stat 在父目录的列表中查找 path，FTP 没有通用的单文件查询命令
+func (ftp *FTPConn) Stat(p string) (Entry, error) {
+	p = path.Clean(p)
+	if p == "/" || p == "." {
+		return Entry{Name: p, Type: EntryDir}, nil
+	}
+	entries, err := ftp.List(path.Dir(p))
+	if err != nil {
+		return Entry{}, err
+	}
+	name := path.Base(p)
+	for _, e := range entries {
+		if e.Name == name {
+			return e, nil
+		}
+	}
+	return Entry{}, fmt.Errorf("%s: %w", p, fs.ErrNotExist)
+}
+
+// ftpStream 数据连接上的读写流，Close 时读取传输完成的响应
+type ftpStream struct {
+	ftp    *FTPConn
+	conn   net.Conn
+	r      io.Reader
+	w      io.Writer
+	closed bool
+}
+
+func (s *ftpStream) Read(p []byte) (int, error)  { return s.r.Read(p) }
+func (s *ftpStream) Write(p []byte) (int, error) { return s.w.Write(p) }
+
+func (s *ftpStream) Close() error {
+	if s.closed {
+		return nil
+	}
+	s.closed = true
+	return s.ftp.closeDataConn()
+}
+
+// abort 关闭数据连接，之后仍需 Close 读取服务器的响应
+func (s *ftpStream) abort() { s.conn.Close() }
+
+// openStream 按当前任务中 name 的传输类型开始传输并返回数据流，ASCII 模式下转换换行
+func (ftp *FTPConn) openStream(command, name string, offset int64) (*ftpStream, error) {
+	ascii := ftp.job.TypeFor(name) == TransferASCII && offset == 0
+	if ascii {
+		if err := ftp.SetAsciiMode(); err != nil {
+			return nil, err
+		}
+	} else if err := ftp.SetBinaryMode(); err != nil {
+		return nil, err
+	}
+	if err := ftp.startTransferAt(command, offset); err != nil {
+		return nil, err
+	}
+	if strings.HasPrefix(command, "STOR ") || strings.HasPrefix(command, "APPE ") {
+		markUpload(ftp.dataConn)
+	}
+	s := &ftpStream{ftp: ftp, conn: ftp.dataConn, r: ftp.dataConn, w: ftp.dataConn}
+	if ascii {
+		s.r = newASCIIReader(s.r)
+		s.w = newASCIIWriter(s.w)
+	}
+	return s, nil
+}
+
+// Open 使用 REST + RETR 从 offset 处读取文件，断点续传时总是使用二进制模式
+func (ftp *FTPConn) Open(p string, offset int64) (io.ReadCloser, error) {
+	return ftp.openStream("RETR "+p, p, offset)
+}
+
+// Create 使用 STOR 上传文件
+func (ftp *FTPConn) Create(p string) (io.WriteCloser, error) {
+	return ftp.openStream("STOR "+p, p, 0)
+}
+
+// Append 使用 APPE 追加上传
+func (ftp *FTPConn) Append(p string) (io.WriteCloser, error) {
+	return ftp.openStream("APPE "+p, p, 0)
+}
+
+// Mkdir 创建目录
+func (ftp *FTPConn) Mkdir(p string) error {
+	return ftp.MakeDir(p)
+}
+
+// Remove 删除文件，失败时按目录删除
+func (ftp *FTPConn) Remove(p string) error {
+	err := ftp.Dele(p, false)
+	if err == nil {
+		return nil
+	}
+	if ftp.Dele(p, true) == nil {
+		return nil
+	}
+	return err
+}
+
+// Job 返回当前的传输任务
+func (ftp *FTPConn) Job() *TransferJob {
+	return ftp.job
+}
+
+// abortable 可以从其他 goroutine 中断的数据流，中断后阻塞的读写立即返回错误
+type abortable interface {
+	abort()
+}
+
+// abortOnCancel ctx 取消时中断数据流 s，返回的函数解除关联
+func abortOnCancel(ctx context.Context, s any) (stop func() bool) {
+	if a, ok := s.(abortable); ok {
+		return context.AfterFunc(ctx, a.abort)
+	}
+	return func() bool { return false }
+}
+
+// DownloadFile 把远程文件下载到本地；offset 大于 0 时从该位置续传并追加到本地文件。
+// size 为远程文件大小，用于进度统计，小于 0 表示未知，此时通过 Stat 查询
+func DownloadFile(ctx context.Context, rfs RemoteFS, remotePath, localPath string, offset, size int64) error {
+	job := rfs.Job()
+	if job != nil && size < 0 {
+		if e, err := rfs.Stat(remotePath); err == nil {
+			size = e.Size
+		}
+	}
+	if size > 0 {
+		job.AddTotal(size)
+	}
+	// ASCII 模式下本地文件的大小与服务器上的不同，无法续传，重新下载
+	if offset > 0 && job.TypeFor(remotePath) == TransferASCII {
+		offset = 0
+	}
+	job.SetFile(remotePath)
+	job.Resume(offset)
+
+	if err := ctx.Err(); err != nil {
+		return fmt.Errorf("下载已取消: %w", err)
+	}
+	// 服务器开始发送后才打开本地文件，下载失败时不会清空已有的文件
+	r, err := rfs.Open(remotePath, offset)
+	if err != nil {
+		return err
+	}
+	flag := os.O_CREATE | os.O_WRONLY | os.O_TRUNC
+	if offset > 0 {
+		flag = os.O_CREATE | os.O_WRONLY | os.O_APPEND
+	}
+	file, err := os.OpenFile(localPath, flag, 0644)
+	if err != nil {
+		r.Close()
+		return fmt.Errorf("创建本地文件失败: %w", err)
+	}
+	defer file.Close()
+	// 取消时关闭数据连接，使阻塞的读取立即返回
+	stop := abortOnCancel(ctx, r)
+	_, copyErr := io.Copy(file, r)
+	stop()
+	closeErr := r.Close()
+	if err := ctx.Err(); err != nil {
+		return fmt.Errorf("下载已取消: %w", err)
+	}
+	if copyErr != nil {
+		return fmt.Errorf("文件下载失败: %v", copyErr)
+	}
+	return closeErr
+}
+
+// UploadFile 把本地文件上传到远程路径，已存在的远程文件会被覆盖；ctx 取消时中断上传
+func UploadFile(ctx context.Context, rfs RemoteFS, localPath, remotePath string) error {
+	return uploadFile(ctx, rfs, localPath, remotePath, 0)
+}
+
+// uploadFile offset 大于 0 时从本地文件的该位置起追加到远程文件 (APPE)；ASCII 模式下重新上传
+func uploadFile(ctx context.Context, rfs RemoteFS, localPath, remotePath string, offset int64) error {
+	if err := ctx.Err(); err != nil {
+		return fmt.Errorf("上传已取消: %w", err)
+	}
+	file, err := os.Open(localPath)
+	if err != nil {
+		return fmt.Errorf("打开本地文件失败: %w", err)
+	}
+	defer file.Close()
+	job := rfs.Job()
+	if info, err := file.Stat(); err == nil {
+		job.AddTotal(info.Size())
+	}
+	if offset > 0 && job.TypeFor(remotePath) == TransferASCII {
+		offset = 0
+	}
+	job.SetFile(remotePath)
+
+	var w io.WriteCloser
+	if offset > 0 {
+		if _, err := file.Seek(offset, io.SeekStart); err != nil {
+			return fmt.Errorf("设置本地文件偏移量失败: %w", err)
+		}
+		job.Resume(offset)
+		w, err = rfs.Append(remotePath)
+	} else {
+		w, err = rfs.Create(remotePath)
+	}
+	if err != nil {
+		return err
+	}
+	stop := abortOnCancel(ctx, w)
+	_, copyErr := io.Copy(w, file)
+	stop()
+	closeErr := w.Close()
+	if err := ctx.Err(); err != nil {
+		return fmt.Errorf("上传已取消: %w", err)
+	}
+	if copyErr != nil {
+		return fmt.Errorf("文件上传失败: %v", copyErr)
+	}
+	return closeErr
+}
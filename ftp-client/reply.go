@@ -0,0 +1,55 @@
+package main
+
+import (
+	"strconv"
+	"strings"
+)
+
+// Reply 解析后的服务器响应，多行响应 (如 FEAT/HELP/STAT) 的每一行保存在 Lines 中
+type Reply struct {
+	Code    int      `json:"code"`
+	Message string   `json:"message"`
+	Lines   []string `json:"lines"`
+}
+
+// ParseReply 把 readResponse 返回的原始文本解析为 Reply
+func ParseReply(response string) Reply {
+	lines := strings.Split(response, "\n")
+	reply := Reply{Lines: lines}
+	code, err := strconv.Atoi(lines[0][:min(len(lines[0]), 3)])
+	if err != nil || len(lines[0]) < 3 {
+		// 不是以响应码开头的文本原样作为消息
+		reply.Message = strings.TrimSpace(response)
+		return reply
+	}
+	reply.Code = code
+
+	messages := make([]string, 0, len(lines))
+	for i, line := range lines {
+		// 去掉首行和末行的 "xyz-" / "xyz " 前缀，中间行原样保留
+		if (i == 0 || i == len(lines)-1) && len(line) >= 4 && strings.HasPrefix(line, lines[0][:3]) {
+			line = line[4:]
+		} else if len(line) == 3 && line == lines[0][:3] {
+			line = ""
+		}
+		messages = append(messages, strings.TrimSpace(line))
+	}
+	reply.Message = strings.Join(messages, "\n")
+	return reply
+}
+
+// Positive 判断响应是否为 1xx/2xx/3xx
+func (r Reply) Positive() bool {
+	return r.Code >= 100 && r.Code < 400
+}
+
+// isMultiLineStart 判断是否为多行响应的首行，例如 "211-Features:"
+func isMultiLineStart(line string) (string, bool) {
+	if len(line) < 4 || line[3] != '-' {
+		return "", false
+	}
+	if _, err := strconv.Atoi(line[:3]); err != nil {
+		return "", false
+	}
+	return line[:3], true
+}
@@ -0,0 +1,114 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParseReply(t *testing.T) {
+	tests := []struct {
+		name     string
+		response string
+		code     int
+		message  string
+		lines    []string
+	}{
+		{
+			name:     "single line",
+			response: "200 Command okay.",
+			code:     200,
+			message:  "Command okay.",
+			lines:    []string{"200 Command okay."},
+		},
+		{
+			name:     "multi-line FEAT",
+			response: "211-Features:\n MDTM\n SIZE\n UTF8\n211 End",
+			code:     211,
+			message:  "Features:\nMDTM\nSIZE\nUTF8\nEnd",
+			lines:    []string{"211-Features:", " MDTM", " SIZE", " UTF8", "211 End"},
+		},
+		{
+			name:     "middle lines that look like replies are kept",
+			response: "214-Help:\n214-USER PASS\n 200 is not a code here\n214 Done",
+			code:     214,
+			message:  "Help:\n214-USER PASS\n200 is not a code here\nDone",
+			lines:    []string{"214-Help:", "214-USER PASS", " 200 is not a code here", "214 Done"},
+		},
+		{
+			name:     "code without text",
+			response: "226",
+			code:     226,
+			message:  "",
+			lines:    []string{"226"},
+		},
+		{
+			name:     "last line without text",
+			response: "250-Listing\n250",
+			code:     250,
+			message:  "Listing\n",
+			lines:    []string{"250-Listing", "250"},
+		},
+		{
+			name:     "not a reply",
+			response: "hello",
+			code:     0,
+			message:  "hello",
+			lines:    []string{"hello"},
+		},
+		{
+			name:     "too short",
+			response: "2",
+			message:  "2",
+			lines:    []string{"2"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := ParseReply(tt.response)
+			if r.Code != tt.code || r.Message != tt.message || !reflect.DeepEqual(r.Lines, tt.lines) {
+				t.Fatalf("ParseReply(%q) = %+v, want code %d message %q lines %q",
+					tt.response, r, tt.code, tt.message, tt.lines)
+			}
+		})
+	}
+}
+
+func TestReplyPositive(t *testing.T) {
+	tests := []struct {
+		code int
+		want bool
+	}{
+		{0, false},
+		{150, true},
+		{226, true},
+		{350, true},
+		{421, false},
+		{550, false},
+	}
+	for _, tt := range tests {
+		if got := (Reply{Code: tt.code}).Positive(); got != tt.want {
+			t.Errorf("Reply{Code: %d}.Positive() = %v, want %v", tt.code, got, tt.want)
+		}
+	}
+}
+
+func TestIsMultiLineStart(t *testing.T) {
+	tests := []struct {
+		line string
+		code string
+		ok   bool
+	}{
+		{"211-Features:", "211", true},
+		{"211-", "211", true},
+		{"211 End", "", false},
+		{"211", "", false},
+		{" 211-x", "", false},
+		{"2a1-x", "", false},
+	}
+	for _, tt := range tests {
+		code, ok := isMultiLineStart(tt.line)
+		if code != tt.code || ok != tt.ok {
+			t.Errorf("isMultiLineStart(%q) = %q, %v, want %q, %v", tt.line, code, ok, tt.code, tt.ok)
+		}
+	}
+}
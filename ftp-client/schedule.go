@@ -0,0 +1,626 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/robfig/cron/v3"
+)
+
+// 定时任务的类型
+const (
+	ScheduleDownload = "download"
+	ScheduleUpload   = "upload"
+	ScheduleSync     = "sync" // 镜像目录，默认从服务器同步到本地
+)
+
+// 错过的运行 (程序没有运行或电脑休眠) 的补运行策略
+const (
+	CatchUpSkip = "skip" // 不补运行，等待下一次计划时间
+	CatchUpOnce = "once" // 无论错过几次都只补运行一次 (默认)
+	CatchUpAll  = "all"  // 每次错过的运行都补上，最多 maxCatchUp 次
+)
+
+// maxCatchUp 补运行的最多次数
+const maxCatchUp = 100
+
+// maxNextTimes NextScheduleTimes 最多返回的计划时间数
+const maxNextTimes = 100
+
+// missedAfter 计划时间过去多久之后才算错过，检查稍有延迟时仍按正常运行处理
+const missedAfter = time.Minute
+
+// ScheduledJob 保存的定时任务，按 cron 表达式使用保存的连接配置上传、下载或同步
+type ScheduledJob struct {
+	ID         string `json:"id"`
+	Name       string `json:"name"`
+	Cron       string `json:"cron"` // 5 个字段的 cron 表达式，也可以是 @daily、@hourly、@every 1h 等
+	Kind       string `json:"kind"` // download / upload / sync
+	Profile    string `json:"profile"`
+	RemotePath string `json:"remotePath"`
+	// LocalPath 本地文件或目录，可以包含 {date} 和 {time}，运行时替换为当时的日期 (2006-01-02) 和时间 (150405)
+	LocalPath string `json:"localPath"`
+	Reverse   bool   `json:"reverse,omitempty"`  // sync 时从本地同步到服务器
+	Type      string `json:"type,omitempty"`     // 传输类型，为空时使用默认类型
+	Conflict  string `json:"conflict,omitempty"` // 目标已存在时的处理方式，为空时覆盖；后台运行无法询问，不能为 ask
+	CatchUp   string `json:"catchUp"`
+	Enabled   bool   `json:"enabled"`
+	// LastScheduled 已经处理过的最后一个计划时间，之后的计划时间还没有运行
+	LastScheduled time.Time `json:"lastScheduled"`
+}
+
+// ScheduleRun 定时任务的一次运行
+type ScheduleRun struct {
+	ID        uint64    `json:"id"`
+	JobID     string    `json:"jobId"`
+	JobName   string    `json:"jobName"`
+	Scheduled time.Time `json:"scheduled"` // 计划时间，手动运行时为开始时间
+	Started   time.Time `json:"started"`
+	Duration  float64   `json:"duration"`          // 秒
+	CatchUp   bool      `json:"catchUp,omitempty"` // 错过之后的补运行
+	Manual    bool      `json:"manual,omitempty"`
+	Files     int       `json:"files"`
+	Bytes     int64     `json:"bytes"`
+	Status    string    `json:"status"` // ok / failed
+	Error     string    `json:"error,omitempty"`
+}
+
+// parseCron 解析 cron 表达式
+func parseCron(expr string) (cron.Schedule, error) {
+	sched, err := cron.ParseStandard(strings.TrimSpace(expr))
+	if err != nil {
+		return nil, fmt.Errorf("cron 表达式 %q 无效: %v", expr, err)
+	}
+	return sched, nil
+}
+
+// validate 检查任务的设置并补全默认值
+func (job *ScheduledJob) validate() error {
+	if _, err := parseCron(job.Cron); err != nil {
+		return err
+	}
+	switch job.Kind {
+	case ScheduleDownload, ScheduleUpload, ScheduleSync:
+	default:
+		return fmt.Errorf("不支持的任务类型: %s (可用: download, upload, sync)", job.Kind)
+	}
+	switch job.CatchUp {
+	case "":
+		job.CatchUp = CatchUpOnce
+	case CatchUpSkip, CatchUpOnce, CatchUpAll:
+	default:
+		return fmt.Errorf("不支持的补运行策略: %s (可用: skip, once, all)", job.CatchUp)
+	}
+	if job.RemotePath == "" || job.LocalPath == "" {
+		return fmt.Errorf("远程路径和本地路径不能为空")
+	}
+	if job.Type != "" {
+		if _, err := ParseTransferType(job.Type); err != nil {
+			return err
+		}
+	}
+	if policy, err := ParseConflictPolicy(job.Conflict); err != nil {
+		return err
+	} else if policy == ConflictAsk {
+		return fmt.Errorf("定时任务不能使用 ask 冲突策略")
+	}
+	if _, err := FindProfile(job.Profile); err != nil {
+		return err
+	}
+	if job.Name == "" {
+		job.Name = job.Kind + " " + job.RemotePath
+	}
+	return nil
+}
+
+// dueTimes 返回 last 之后、now 之前 (含) 的计划时间中需要运行的时间，按补运行策略处理错过的运行；
+// 同时返回处理到的最后一个计划时间，没有到期的计划时间时为 last。
+// last 为零值 (例如手工编辑的任务) 时从 now 开始计划
+func dueTimes(sched cron.Schedule, policy string, last, now time.Time) (runs []ScheduleRun, handled time.Time) {
+	if last.IsZero() {
+		return nil, now
+	}
+	// 很久以前的 last 只从最多能补运行的那部分计划时间开始计算，
+	// 窗口取 now 之后 maxCatchUp+1 个计划时间的跨度
+	end := now
+	for i := 0; i <= maxCatchUp; i++ {
+		next := sched.Next(end)
+		if next.IsZero() {
+			break
+		}
+		end = next
+	}
+	if earliest := now.Add(-end.Sub(now)); last.Before(earliest) {
+		last = earliest
+	}
+
+	var times []time.Time
+	for t := sched.Next(last); !t.IsZero() && !t.After(now); t = sched.Next(t) {
+		times = append(times, t)
+		// 只保留可能补运行的部分
+		if len(times) > 2*maxCatchUp {
+			times = times[len(times)-maxCatchUp-1:]
+		}
+	}
+	if len(times) == 0 {
+		return nil, last
+	}
+	handled = times[len(times)-1]
+
+	// 最后一个计划时间刚刚到期是正常的运行，其余都是错过的
+	missed := times
+	var current []time.Time
+	if now.Sub(handled) < missedAfter {
+		missed, current = times[:len(times)-1], times[len(times)-1:]
+	}
+	switch policy {
+	case CatchUpSkip:
+		missed = nil
+	case CatchUpAll:
+		if len(missed) > maxCatchUp {
+			missed = missed[len(missed)-maxCatchUp:]
+		}
+	default:
+		// 本次正常的运行已经包含了错过的内容
+		if len(current) > 0 {
+			missed = nil
+		} else if len(missed) > 1 {
+			missed = missed[len(missed)-1:]
+		}
+	}
+	for _, t := range missed {
+		runs = append(runs, ScheduleRun{Scheduled: t, CatchUp: true})
+	}
+	for _, t := range current {
+		runs = append(runs, ScheduleRun{Scheduled: t})
+	}
+	return runs, handled
+}
+
+// expandLocalPath 替换本地路径中的 {date} 和 {time}
+func expandLocalPath(p string, t time.Time) string {
+	return strings.NewReplacer("{date}", t.Format("2006-01-02"), "{time}", t.Format("150405")).Replace(p)
+}
+
+// schedulesMu 保护定时任务文件的读写
+var schedulesMu sync.Mutex
+
+// schedulesPath 返回定时任务文件的路径 (configDir/schedules.json)
+func schedulesPath() (string, error) {
+	dir, err := configDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, "schedules.json"), nil
+}
+
+func loadSchedules() ([]ScheduledJob, error) {
+	path, err := schedulesPath()
+	if err != nil {
+		return nil, err
+	}
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return []ScheduledJob{}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var jobs []ScheduledJob
+	if err := json.Unmarshal(data, &jobs); err != nil {
+		return nil, fmt.Errorf("%s: %v", path, err)
+	}
+	return jobs, nil
+}
+
+func saveSchedules(jobs []ScheduledJob) error {
+	path, err := schedulesPath()
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return err
+	}
+	data, err := json.MarshalIndent(jobs, "", "  ")
+	if err != nil {
+		return err
+	}
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0600); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
+
+// findSchedule 按 ID 查找定时任务
+func findSchedule(id string) (ScheduledJob, error) {
+	schedulesMu.Lock()
+	jobs, err := loadSchedules()
+	schedulesMu.Unlock()
+	if err != nil {
+		return ScheduledJob{}, err
+	}
+	for _, job := range jobs {
+		if job.ID == id {
+			return job, nil
+		}
+	}
+	return ScheduledJob{}, fmt.Errorf("scheduled job %q not found", id)
+}
+
+// Scheduler 在程序运行期间按计划时间执行定时任务，同一个任务不会同时运行多次
+type Scheduler struct {
+	app *App
+	now func() time.Time
+
+	mu      sync.Mutex
+	running map[string]bool
+
+	ctx    context.Context
+	cancel context.CancelFunc
+	wake   chan struct{}
+	done   chan struct{}
+	wg     sync.WaitGroup // 正在运行的任务
+}
+
+// NewScheduler 创建调度器，调用 Start 后开始运行
+func NewScheduler(a *App) *Scheduler {
+	ctx, cancel := context.WithCancel(context.Background())
+	return &Scheduler{
+		app:     a,
+		now:     time.Now,
+		running: map[string]bool{},
+		ctx:     ctx,
+		cancel:  cancel,
+		wake:    make(chan struct{}, 1),
+		done:    make(chan struct{}),
+	}
+}
+
+// Start 在后台开始检查到期的任务，启动时先按补运行策略处理错过的运行
+func (s *Scheduler) Start() {
+	go s.loop()
+}
+
+// Stop 停止检查并取消正在进行的下载；正在运行的其他任务在后台继续直到程序退出
+func (s *Scheduler) Stop() {
+	s.cancel()
+	<-s.done
+}
+
+// Wake 任务被修改后立即重新检查
+func (s *Scheduler) Wake() {
+	select {
+	case s.wake <- struct{}{}:
+	default:
+	}
+}
+
+func (s *Scheduler) loop() {
+	defer close(s.done)
+	for {
+		next := s.check()
+		// 最多等待一分钟，电脑休眠或系统时间改变后也能及时发现到期的任务
+		wait := time.Minute
+		if d := next.Sub(s.now()); !next.IsZero() && d < wait {
+			wait = d
+		}
+		if wait < time.Second {
+			wait = time.Second
+		}
+		timer := time.NewTimer(wait)
+		select {
+		case <-s.ctx.Done():
+			timer.Stop()
+			return
+		case <-s.wake:
+		case <-timer.C:
+		}
+		timer.Stop()
+	}
+}
+
+// check 启动到期的任务并返回最近的下一个计划时间，没有启用的任务时为零值
+func (s *Scheduler) check() time.Time {
+	schedulesMu.Lock()
+	defer schedulesMu.Unlock()
+	jobs, err := loadSchedules()
+	if err != nil {
+		MyLogger.Info("failed to load scheduled jobs", "error", err)
+		return time.Time{}
+	}
+	now := s.now()
+	var next time.Time
+	changed := false
+	for i := range jobs {
+		job := &jobs[i]
+		if !job.Enabled {
+			continue
+		}
+		sched, err := parseCron(job.Cron)
+		if err != nil {
+			continue
+		}
+		runs, handled := dueTimes(sched, job.CatchUp, job.LastScheduled, now)
+		if !handled.Equal(job.LastScheduled) {
+			job.LastScheduled = handled
+			changed = true
+		}
+		if len(runs) > 0 {
+			if s.begin(job.ID) {
+				s.wg.Add(1)
+				go func(job ScheduledJob) {
+					defer s.wg.Done()
+					defer s.end(job.ID)
+					for _, run := range runs {
+						if s.ctx.Err() != nil {
+							return
+						}
+						s.app.runSchedule(s.ctx, job, run)
+					}
+				}(*job)
+			} else {
+				MyLogger.Info("scheduled job still running, skipped", "job", job.Name, "scheduled", handled)
+			}
+		}
+		if t := sched.Next(now); !t.IsZero() && (next.IsZero() || t.Before(next)) {
+			next = t
+		}
+	}
+	if changed {
+		if err := saveSchedules(jobs); err != nil {
+			MyLogger.Info("failed to save scheduled jobs", "error", err)
+		}
+	}
+	return next
+}
+
+// begin 标记任务开始运行，任务已经在运行时返回 false
+func (s *Scheduler) begin(id string) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.running[id] {
+		return false
+	}
+	s.running[id] = true
+	return true
+}
+
+func (s *Scheduler) end(id string) {
+	s.mu.Lock()
+	delete(s.running, id)
+	s.mu.Unlock()
+}
+
+// runSchedule 执行一次定时任务，保存运行记录并通知前端；失败时发送 "schedule-failed" 事件
+func (a *App) runSchedule(ctx context.Context, job ScheduledJob, run ScheduleRun) ScheduleRun {
+	run.JobID = job.ID
+	run.JobName = job.Name
+	run.Started = time.Now()
+	if run.Scheduled.IsZero() {
+		run.Scheduled = run.Started
+	}
+	stats, err := a.executeSchedule(ctx, job, run.Started)
+	run.Duration = time.Since(run.Started).Seconds()
+	run.Files = stats.Files
+	run.Bytes = stats.Bytes
+	run.Status = HistoryOK
+	if err != nil {
+		run.Status = HistoryFailed
+		run.Error = err.Error()
+	}
+
+	if err := withHistory(func(h *History) error { return h.AddRun(&run) }); err != nil {
+		MyLogger.Info("failed to record scheduled run", "job", job.Name, "error", err)
+	}
+	a.emit("schedule-run", run)
+	if err != nil {
+		MyLogger.Info("scheduled job failed", "job", job.Name, "scheduled", run.Scheduled, "error", err)
+		a.emit("schedule-failed", run)
+	} else {
+		MyLogger.Info("scheduled job finished", "job", job.Name, "files", run.Files, "bytes", run.Bytes)
+	}
+	return run
+}
+
+// executeSchedule 按任务的配置新建连接并执行传输，结束后断开
+func (a *App) executeSchedule(ctx context.Context, job ScheduledJob, started time.Time) (MirrorStats, error) {
+	var stats MirrorStats
+	profile, err := FindProfile(job.Profile)
+	if err != nil {
+		return stats, err
+	}
+	rfs, err := profile.Open()
+	if err != nil {
+		return stats, fmt.Errorf("failed to connect: %v", err)
+	}
+	defer rfs.Close()
+
+	local := expandLocalPath(job.LocalPath, started)
+	remote := job.RemotePath
+	kind := job.Kind
+	if kind == ScheduleSync {
+		kind = "mirror"
+	}
+	tj := a.startTransfer(kind, remote)
+	if job.Type != "" {
+		tj.Type, _ = ParseTransferType(job.Type)
+	}
+	tj.Conflict, _ = ParseConflictPolicy(job.Conflict)
+	err = rfs.RunJob(tj, func() (err error) {
+		switch job.Kind {
+		case ScheduleDownload:
+			// 本地路径是目录时保存为目录中的同名文件
+			if info, err := os.Stat(local); err == nil && info.IsDir() {
+				local = filepath.Join(local, path.Base(remote))
+			}
+			if err := os.MkdirAll(filepath.Dir(local), 0755); err != nil {
+				return fmt.Errorf("创建本地目录失败: %w", err)
+			}
+			saved, err := GetFile(ctx, rfs, remote, local)
+			if saved != "" {
+				local = saved
+			}
+			return err
+		case ScheduleUpload:
+			if strings.HasSuffix(remote, "/") {
+				remote += filepath.Base(local)
+			}
+			saved, err := PutFile(ctx, rfs, local, remote)
+			if saved != "" {
+				remote = saved
+			}
+			return err
+		default:
+			if job.Reverse {
+				stats, err = MirrorUp(rfs, local, remote)
+			} else {
+				stats, err = MirrorDown(rfs, remote, local)
+			}
+			return err
+		}
+	})
+	tj.Finish(err)
+
+	if job.Kind != ScheduleSync {
+		r := newTransferRecord(job.Kind, profile.Address, tj, remote, local, err)
+		r.Profile = profile.Name
+		recordTransfer(r)
+		if errors.Is(err, ErrSkipped) {
+			stats.Skipped = 1
+			err = nil
+		} else if err == nil {
+			stats.Files = 1
+			stats.Bytes = r.Size
+		}
+	}
+	return stats, err
+}
+
+// Schedules 返回所有定时任务
+func (a *App) Schedules() ([]ScheduledJob, error) {
+	schedulesMu.Lock()
+	defer schedulesMu.Unlock()
+	return loadSchedules()
+}
+
+// SaveSchedule 新建 (ID 为空) 或修改定时任务并返回保存后的任务。
+// 新任务从保存时开始计划，之前的计划时间不补运行
+func (a *App) SaveSchedule(job ScheduledJob) (ScheduledJob, error) {
+	if err := job.validate(); err != nil {
+		return job, err
+	}
+	schedulesMu.Lock()
+	defer schedulesMu.Unlock()
+	jobs, err := loadSchedules()
+	if err != nil {
+		return job, err
+	}
+	found := false
+	for i := range jobs {
+		if jobs[i].ID == job.ID && job.ID != "" {
+			job.LastScheduled = jobs[i].LastScheduled
+			// 重新启用的任务不补运行停用期间的计划时间
+			if !jobs[i].Enabled || jobs[i].Cron != job.Cron {
+				job.LastScheduled = time.Now()
+			}
+			jobs[i] = job
+			found = true
+		}
+	}
+	if !found {
+		if job.ID != "" {
+			return job, fmt.Errorf("scheduled job %q not found", job.ID)
+		}
+		job.ID = newSessionID()
+		job.LastScheduled = time.Now()
+		jobs = append(jobs, job)
+	}
+	if err := saveSchedules(jobs); err != nil {
+		return job, fmt.Errorf("failed to save scheduled job: %v", err)
+	}
+	MyLogger.Info("scheduled job saved", "job", job.Name, "cron", job.Cron, "enabled", job.Enabled)
+	if a.scheduler != nil {
+		a.scheduler.Wake()
+	}
+	return job, nil
+}
+
+// DeleteSchedule 删除定时任务，运行记录保留
+func (a *App) DeleteSchedule(id string) error {
+	schedulesMu.Lock()
+	defer schedulesMu.Unlock()
+	jobs, err := loadSchedules()
+	if err != nil {
+		return err
+	}
+	kept := jobs[:0]
+	for _, job := range jobs {
+		if job.ID != id {
+			kept = append(kept, job)
+		}
+	}
+	if len(kept) == len(jobs) {
+		return fmt.Errorf("scheduled job %q not found", id)
+	}
+	return saveSchedules(kept)
+}
+
+// RunScheduleNow 立即运行一次定时任务并等待结束，不影响之后的计划
+func (a *App) RunScheduleNow(id string) (ScheduleRun, error) {
+	job, err := findSchedule(id)
+	if err != nil {
+		return ScheduleRun{}, err
+	}
+	ctx := context.Background()
+	if s := a.scheduler; s != nil {
+		if !s.begin(id) {
+			return ScheduleRun{}, fmt.Errorf("scheduled job %q is already running", job.Name)
+		}
+		defer s.end(id)
+		ctx = s.ctx
+	}
+	run := a.runSchedule(ctx, job, ScheduleRun{Manual: true})
+	if run.Status != HistoryOK {
+		return run, errors.New(run.Error)
+	}
+	return run, nil
+}
+
+// ScheduleRuns 返回定时任务的运行记录，最新的在前；id 为空时返回所有任务的记录
+func (a *App) ScheduleRuns(id string, limit int) ([]ScheduleRun, error) {
+	var runs []ScheduleRun
+	err := withHistory(func(h *History) (err error) {
+		runs, err = h.Runs(id, limit)
+		return err
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to read schedule runs: %v", err)
+	}
+	return runs, nil
+}
+
+// NextScheduleTimes 返回 cron 表达式接下来的 n 个 (最多 maxNextTimes 个) 计划时间，供界面预览和检查表达式
+func (a *App) NextScheduleTimes(expr string, n int) ([]time.Time, error) {
+	sched, err := parseCron(expr)
+	if err != nil {
+		return nil, err
+	}
+	n = min(n, maxNextTimes)
+	times := []time.Time{}
+	for t := time.Now(); len(times) < n; {
+		if t = sched.Next(t); t.IsZero() {
+			break
+		}
+		times = append(times, t)
+	}
+	return times, nil
+}
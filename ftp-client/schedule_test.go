@@ -0,0 +1,118 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestSchedule(t *testing.T) {
+	sched, err := parseCron("0 2 * * *")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := parseCron("61 * * * *"); err == nil {
+		t.Fatal("invalid cron expression accepted")
+	}
+	last := time.Date(2024, 5, 1, 2, 0, 0, 0, time.Local)
+	late := time.Date(2024, 5, 4, 10, 0, 0, 0, time.Local)
+	for policy, want := range map[string]int{CatchUpSkip: 0, CatchUpOnce: 1, CatchUpAll: 3} {
+		runs, handled := dueTimes(sched, policy, last, late)
+		if len(runs) != want || !handled.Equal(time.Date(2024, 5, 4, 2, 0, 0, 0, time.Local)) {
+			t.Fatalf("%s: runs = %+v, handled = %v", policy, runs, handled)
+		}
+		for _, r := range runs {
+			if !r.CatchUp {
+				t.Fatalf("%s: %+v is not a catch-up run", policy, r)
+			}
+		}
+	}
+	// 按时检查时只有一次正常的运行
+	if runs, _ := dueTimes(sched, CatchUpAll, last, last.Add(24*time.Hour+10*time.Second)); len(runs) != 1 || runs[0].CatchUp {
+		t.Fatalf("on-time runs = %+v", runs)
+	}
+
+	// 没有记录上次计划时间的任务从现在开始计划
+	if runs, handled := dueTimes(sched, CatchUpAll, time.Time{}, late); len(runs) != 0 || !handled.Equal(late) {
+		t.Fatalf("zero last: runs = %+v, handled = %v", runs, handled)
+	}
+	// 很久以前的上次计划时间只计算能补运行的部分
+	every, _ := parseCron("@every 1s")
+	start := time.Now()
+	if runs, handled := dueTimes(every, CatchUpAll, late.AddDate(-10, 0, 0), late); len(runs) != maxCatchUp+1 || !handled.Equal(late) || time.Since(start) > time.Second {
+		t.Fatalf("ten years of @every 1s: %d runs, handled = %v, took %v", len(runs), handled, time.Since(start))
+	}
+	if runs, _ := dueTimes(every, CatchUpOnce, late.AddDate(-10, 0, 0), late); len(runs) != 1 {
+		t.Fatalf("catch up once: %d runs", len(runs))
+	}
+	if times, err := NewApp().NextScheduleTimes("@every 1s", 1<<30); err != nil || len(times) != maxNextTimes {
+		t.Fatalf("NextScheduleTimes returned %d times, %v", len(times), err)
+	}
+
+	srv := newTestServer(t)
+	srv.WriteFile("/app.log", []byte("line 1\nline 2\n"))
+	app := NewApp()
+	if err := app.SaveProfile(Profile{Name: "nightly", Address: srv.Addr, Username: "rw", Password: "123"}); err != nil {
+		t.Fatal(err)
+	}
+	defer app.DeleteProfile("nightly")
+	dir := t.TempDir()
+
+	if _, err := app.SaveSchedule(ScheduledJob{Cron: "0 3 * * *", Kind: ScheduleDownload, Profile: "missing", RemotePath: "/app.log", LocalPath: dir}); err == nil {
+		t.Fatal("job with an unknown profile accepted")
+	}
+	job, err := app.SaveSchedule(ScheduledJob{
+		Cron: "0 3 * * *", Kind: ScheduleDownload, Profile: "nightly",
+		RemotePath: "/app.log", LocalPath: filepath.Join(dir, "app-{date}.log"), Enabled: true,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer app.DeleteSchedule(job.ID)
+	if job.ID == "" || job.CatchUp != CatchUpOnce || job.LastScheduled.IsZero() {
+		t.Fatalf("saved job = %+v", job)
+	}
+
+	run, err := app.RunScheduleNow(job.ID)
+	if err != nil || !run.Manual || run.Files != 1 || run.Bytes != 14 {
+		t.Fatalf("run = %+v, %v", run, err)
+	}
+	local := filepath.Join(dir, "app-"+time.Now().Format("2006-01-02")+".log")
+	if data, _ := os.ReadFile(local); string(data) != "line 1\nline 2\n" {
+		t.Fatalf("downloaded %q", data)
+	}
+
+	// 程序两天没有运行，启动后只补运行一次
+	s := NewScheduler(app)
+	s.now = func() time.Time { return time.Now().Add(48 * time.Hour) }
+	app.scheduler = s
+	if next := s.check(); next.IsZero() {
+		t.Fatal("no next run")
+	}
+	s.wg.Wait()
+	runs, err := app.ScheduleRuns(job.ID, 0)
+	if err != nil || len(runs) != 2 || !runs[0].CatchUp || runs[0].Status != HistoryOK {
+		t.Fatalf("runs = %+v, %v", runs, err)
+	}
+	if jobs, _ := app.Schedules(); len(jobs) != 1 || !jobs[0].LastScheduled.After(time.Now().Add(24*time.Hour)) {
+		t.Fatalf("jobs after check = %+v", jobs)
+	}
+	s.check()
+	s.wg.Wait()
+	if runs, _ := app.ScheduleRuns(job.ID, 0); len(runs) != 2 {
+		t.Fatalf("job ran again: %+v", runs)
+	}
+
+	// 失败的运行会被记录
+	job.RemotePath = "/gone.log"
+	if job, err = app.SaveSchedule(job); err != nil {
+		t.Fatal(err)
+	}
+	if run, err := app.RunScheduleNow(job.ID); err == nil || run.Status != HistoryFailed || run.Error == "" {
+		t.Fatalf("run = %+v, %v", run, err)
+	}
+	if runs, _ := app.ScheduleRuns(job.ID, 1); len(runs) != 1 || runs[0].Status != HistoryFailed {
+		t.Fatalf("latest run = %+v", runs)
+	}
+}
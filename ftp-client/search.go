@@ -0,0 +1,325 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"path"
+	"regexp"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// 搜索的默认和最大并发连接数
+const (
+	defaultSearchConcurrency = 2
+	maxSearchConcurrency     = 8
+)
+
+// SearchOptions 远程搜索的条件
+type SearchOptions struct {
+	Root        string    `json:"root"`        // 开始搜索的目录
+	Pattern     string    `json:"pattern"`     // 文件名的通配符 (默认) 或正则表达式，为空时匹配所有
+	Regex       bool      `json:"regex"`       // Pattern 为正则表达式
+	IgnoreCase  bool      `json:"ignoreCase"`  // 忽略大小写
+	Type        string    `json:"type"`        // file、dir 或空 (都匹配)
+	MaxDepth    int       `json:"maxDepth"`    // 最大深度，Root 下的条目深度为 1，0 表示不限
+	MinSize     int64     `json:"minSize"`     // 最小大小 (字节)
+	MaxSize     int64     `json:"maxSize"`     // 最大大小 (字节)，0 表示不限
+	After       time.Time `json:"after"`       // 修改时间不早于，零值表示不限
+	Before      time.Time `json:"before"`      // 修改时间早于，零值表示不限
+	Concurrency int       `json:"concurrency"` // 同时列目录的连接数
+	MaxResults  int       `json:"maxResults"`  // 达到后停止搜索，0 表示不限
+}
+
+// SearchMatch search-result 事件的内容
+type SearchMatch struct {
+	SearchID string `json:"searchId"`
+	Path     string `json:"path"`
+	Entry    Entry  `json:"entry"`
+}
+
+// SearchStats 搜索结束时的统计，也是 search-finished 事件的内容
+type SearchStats struct {
+	SearchID string `json:"searchId"`
+	Matches  int    `json:"matches"`
+	Dirs     int    `json:"dirs"`   // 列出的目录数
+	Errors   int    `json:"errors"` // 无法列出的子目录数
+	Canceled bool   `json:"canceled"`
+	Error    string `json:"error,omitempty"`
+}
+
+// searchMatcher 由 SearchOptions 编译得到的匹配条件
+type searchMatcher struct {
+	opts  SearchOptions
+	regex *regexp.Regexp
+}
+
+func newSearchMatcher(opts SearchOptions) (*searchMatcher, error) {
+	m := &searchMatcher{opts: opts}
+	switch opts.Type {
+	case "", EntryFile, EntryDir:
+	default:
+		return nil, fmt.Errorf("无效的类型: %s", opts.Type)
+	}
+	if opts.Regex {
+		expr := opts.Pattern
+		if opts.IgnoreCase {
+			expr = "(?i)" + expr
+		}
+		re, err := regexp.Compile(expr)
+		if err != nil {
+			return nil, fmt.Errorf("无效的正则表达式: %v", err)
+		}
+		m.regex = re
+	} else if _, err := path.Match(opts.Pattern, ""); err != nil {
+		return nil, fmt.Errorf("无效的通配符: %s", opts.Pattern)
+	}
+	return m, nil
+}
+
+func (m *searchMatcher) match(e Entry) bool {
+	opts := m.opts
+	if opts.Type != "" && e.Type != opts.Type {
+		return false
+	}
+	if !e.IsDir() {
+		if e.Size < opts.MinSize || (opts.MaxSize > 0 && e.Size > opts.MaxSize) {
+			return false
+		}
+	}
+	if !opts.After.IsZero() && e.Time.Before(opts.After) {
+		return false
+	}
+	if !opts.Before.IsZero() && !e.Time.Before(opts.Before) {
+		return false
+	}
+	switch {
+	case opts.Pattern == "":
+		return true
+	case m.regex != nil:
+		return m.regex.MatchString(e.Name)
+	case opts.IgnoreCase:
+		ok, _ := path.Match(strings.ToLower(opts.Pattern), strings.ToLower(e.Name))
+		return ok
+	default:
+		ok, _ := path.Match(opts.Pattern, e.Name)
+		return ok
+	}
+}
+
+// searchDir 待列出的目录
+type searchDir struct {
+	path  string
+	depth int
+}
+
+// Search 从 opts.Root 开始递归搜索，每个连接由一个 worker 使用，匹配项通过 onMatch 逐个返回
+// (onMatch 不会被并发调用)。符号链接不会被跟随；子目录无法列出时计入 Errors 并继续。
+// ctx 取消时尽快返回，stats.Canceled 为 true
+func Search(ctx context.Context, conns []RemoteFS, opts SearchOptions, onMatch func(SearchMatch)) (SearchStats, error) {
+	var stats SearchStats
+	matcher, err := newSearchMatcher(opts)
+	if err != nil {
+		return stats, err
+	}
+	if len(conns) == 0 {
+		return stats, fmt.Errorf("not connected")
+	}
+	root := opts.Root
+	if root == "" {
+		root = "."
+	}
+	// 根目录无法列出时直接报错，而不是返回空结果
+	rootEntries, err := conns[0].List(root)
+	if err != nil {
+		return stats, err
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	var (
+		mu      sync.Mutex
+		cond    = sync.NewCond(&mu)
+		queue   []searchDir
+		active  int
+		matchMu sync.Mutex
+		dirs    atomic.Int64
+		errs    atomic.Int64
+	)
+	stop := context.AfterFunc(ctx, func() {
+		mu.Lock()
+		cond.Broadcast()
+		mu.Unlock()
+	})
+	defer stop()
+
+	// visit 处理一个目录的列表，返回需要继续遍历的子目录
+	visit := func(dir searchDir, entries []Entry) []searchDir {
+		dirs.Add(1)
+		var next []searchDir
+		for _, e := range entries {
+			if e.Name == "." || e.Name == ".." {
+				continue
+			}
+			p := path.Join(dir.path, e.Name)
+			if matcher.match(e) {
+				matchMu.Lock()
+				if ctx.Err() == nil {
+					stats.Matches++
+					onMatch(SearchMatch{Path: p, Entry: e})
+					if opts.MaxResults > 0 && stats.Matches >= opts.MaxResults {
+						cancel()
+					}
+				}
+				matchMu.Unlock()
+			}
+			if e.IsDir() && (opts.MaxDepth == 0 || dir.depth+1 < opts.MaxDepth) {
+				next = append(next, searchDir{path: p, depth: dir.depth + 1})
+			}
+		}
+		return next
+	}
+	queue = visit(searchDir{path: root, depth: 0}, rootEntries)
+
+	var wg sync.WaitGroup
+	for _, conn := range conns {
+		wg.Add(1)
+		go func(rfs RemoteFS) {
+			defer wg.Done()
+			for {
+				mu.Lock()
+				for len(queue) == 0 && active > 0 && ctx.Err() == nil {
+					cond.Wait()
+				}
+				if len(queue) == 0 || ctx.Err() != nil {
+					cond.Broadcast()
+					mu.Unlock()
+					return
+				}
+				// 后进先出，先深入一个分支，待处理的目录不会过多
+				dir := queue[len(queue)-1]
+				queue = queue[:len(queue)-1]
+				active++
+				mu.Unlock()
+
+				entries, err := rfs.List(dir.path)
+				var next []searchDir
+				if err != nil {
+					errs.Add(1)
+					MyLogger.Info("search: failed to list", "path", dir.path, "error", err)
+				} else {
+					next = visit(dir, entries)
+				}
+
+				mu.Lock()
+				queue = append(queue, next...)
+				active--
+				cond.Broadcast()
+				mu.Unlock()
+			}
+		}(conn)
+	}
+	wg.Wait()
+
+	stats.Dirs = int(dirs.Load())
+	stats.Errors = int(errs.Load())
+	// 达到 MaxResults 而停止不算取消
+	stats.Canceled = ctx.Err() != nil && (opts.MaxResults == 0 || stats.Matches < opts.MaxResults)
+	return stats, nil
+}
+
+// searchRegistry 正在进行的搜索
+type searchRegistry struct {
+	mu      sync.Mutex
+	cancels map[string]context.CancelFunc
+	nextID  atomic.Uint64
+}
+
+var searches = &searchRegistry{cancels: map[string]context.CancelFunc{}}
+
+// Search 在后台开始搜索并立即返回搜索 ID。搜索使用新建的连接，不影响当前会话；
+// 匹配项以 "search-result" 事件推送，结束时发送 "search-finished"
+func (a *App) Search(sessionID string, opts SearchOptions) (string, error) {
+	session, err := lookupSession(sessionID)
+	if err != nil {
+		return "", err
+	}
+	if _, err := newSearchMatcher(opts); err != nil {
+		return "", err
+	}
+	n := opts.Concurrency
+	if n <= 0 {
+		n = defaultSearchConcurrency
+	}
+	if n > maxSearchConcurrency {
+		n = maxSearchConcurrency
+	}
+
+	id := fmt.Sprintf("search-%d", searches.nextID.Add(1))
+	ctx, cancel := context.WithCancel(context.Background())
+	searches.mu.Lock()
+	searches.cancels[id] = cancel
+	searches.mu.Unlock()
+
+	profile := session.profile
+	go func() {
+		defer func() {
+			cancel()
+			searches.mu.Lock()
+			delete(searches.cancels, id)
+			searches.mu.Unlock()
+		}()
+
+		var conns []RemoteFS
+		defer func() {
+			for _, c := range conns {
+				c.Close()
+			}
+		}()
+		var err error
+		for i := 0; i < n && ctx.Err() == nil; i++ {
+			c, openErr := profile.Open()
+			if openErr != nil {
+				// 服务器限制了连接数时用已经建立的连接继续
+				if len(conns) == 0 {
+					err = openErr
+				}
+				break
+			}
+			conns = append(conns, c)
+		}
+
+		var stats SearchStats
+		switch {
+		case ctx.Err() != nil:
+			stats.Canceled = true
+		case err == nil:
+			stats, err = Search(ctx, conns, opts, func(m SearchMatch) {
+				m.SearchID = id
+				a.emit("search-result", m)
+			})
+		}
+		stats.SearchID = id
+		if err != nil {
+			stats.Error = err.Error()
+			MyLogger.Info("search failed", "root", opts.Root, "error", err)
+		}
+		a.emit("search-finished", stats)
+	}()
+	return id, nil
+}
+
+// CancelSearch 取消正在进行的搜索
+func (a *App) CancelSearch(id string) error {
+	searches.mu.Lock()
+	cancel, ok := searches.cancels[id]
+	searches.mu.Unlock()
+	if !ok {
+		return fmt.Errorf("search %s not found", id)
+	}
+	cancel()
+	return nil
+}
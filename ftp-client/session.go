@@ -0,0 +1,252 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"sync"
+	"time"
+)
+
+// Session 一个已连接的服务器，前端的每个标签页对应一个会话。
+// 控制连接不能并发使用，同一会话上的操作通过 mu 依次执行
+type Session struct {
+	ID        string
+	fs        RemoteFS
+	ftp       *FTPClient // FTP 连接时非空，SFTP 连接为 nil
+	profile   Profile    // 连接的配置，搜索、编辑等功能用它建立额外的连接
+	connected time.Time
+
+	mu sync.Mutex
+
+	cancelMu sync.Mutex
+	cancel   context.CancelFunc // 取消正在进行的下载或上传
+}
+
+// SessionInfo 会话的信息，供前端显示标签页
+type SessionInfo struct {
+	ID        string    `json:"id"`
+	Name      string    `json:"name"` // 配置名称，直接连接时为空
+	Protocol  string    `json:"protocol"`
+	Address   string    `json:"address"`
+	Username  string    `json:"username"`
+	Connected time.Time `json:"connected"`
+}
+
+// Info 返回会话的信息
+func (s *Session) Info() SessionInfo {
+	protocol := s.profile.Protocol
+	if protocol == "" {
+		protocol = ProtocolFTP
+	}
+	return SessionInfo{
+		ID:        s.ID,
+		Name:      s.profile.Name,
+		Protocol:  protocol,
+		Address:   s.profile.Address,
+		Username:  s.profile.Username,
+		Connected: s.connected,
+	}
+}
+
+// setCancel 记录正在进行的下载或上传的取消函数，nil 表示没有
+func (s *Session) setCancel(cancel context.CancelFunc) {
+	s.cancelMu.Lock()
+	s.cancel = cancel
+	s.cancelMu.Unlock()
+}
+
+// record 把会话中结束的传输保存到传输记录
+func (s *Session) record(kind string, job *TransferJob, remotePath, localPath string, err error) {
+	r := newTransferRecord(kind, s.profile.Address, job, remotePath, localPath, err)
+	r.Profile = s.profile.Name
+	recordTransfer(r)
+}
+
+// sessionRegistry 已连接的会话
+type sessionRegistry struct {
+	mu       sync.Mutex
+	sessions map[string]*Session
+}
+
+var sessions = &sessionRegistry{sessions: map[string]*Session{}}
+
+// addSession 登记一个已连接的会话并返回它；FTP 会话沿用连接的会话标识，与协议控制台一致
+func addSession(fs RemoteFS, ftp *FTPClient, profile Profile) *Session {
+	id := newSessionID()
+	if ftp != nil {
+		id = ftp.SessionID()
+	}
+	s := &Session{ID: id, fs: fs, ftp: ftp, profile: profile, connected: time.Now()}
+	sessions.mu.Lock()
+	sessions.sessions[id] = s
+	sessions.mu.Unlock()
+	return s
+}
+
+// lookupSession 按 ID 查找会话
+func lookupSession(id string) (*Session, error) {
+	sessions.mu.Lock()
+	defer sessions.mu.Unlock()
+	s, ok := sessions.sessions[id]
+	if !ok {
+		return nil, fmt.Errorf("not connected")
+	}
+	return s, nil
+}
+
+// removeSession 把会话从登记表中移除，返回被移除的会话
+func removeSession(id string) (*Session, bool) {
+	sessions.mu.Lock()
+	defer sessions.mu.Unlock()
+	s, ok := sessions.sessions[id]
+	delete(sessions.sessions, id)
+	return s, ok
+}
+
+// withSession 查找会话并在它的锁内执行 fn
+func withSession(id string, fn func(s *Session) error) error {
+	s, err := lookupSession(id)
+	if err != nil {
+		return err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return fn(s)
+}
+
+// Sessions 返回所有已连接的会话，按连接时间排序
+func (a *App) Sessions() []SessionInfo {
+	sessions.mu.Lock()
+	list := make([]SessionInfo, 0, len(sessions.sessions))
+	for _, s := range sessions.sessions {
+		list = append(list, s.Info())
+	}
+	sessions.mu.Unlock()
+	sort.Slice(list, func(i, j int) bool { return list[i].Connected.Before(list[j].Connected) })
+	return list
+}
+
+// Disconnect 断开一个会话
+func (a *App) Disconnect(sessionID string) error {
+	s, ok := removeSession(sessionID)
+	if !ok {
+		return nil
+	}
+	s.cancelMu.Lock()
+	if s.cancel != nil {
+		s.cancel()
+	}
+	s.cancelMu.Unlock()
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	MyLogger.Info("disconnected", "session", s.ID, "address", s.profile.Address)
+	return s.fs.Close()
+}
+
+// disconnectAll 断开所有会话，程序退出时调用
+func (a *App) disconnectAll() {
+	for _, info := range a.Sessions() {
+		a.Disconnect(info.ID)
+	}
+}
+
+// CopyBetween 把一个会话中的文件复制到另一个会话。两端都是 FTP 时优先使用 FXP，
+// 否则数据经过本机中转。两端是同一个会话时为源文件另建一个连接
+func (a *App) CopyBetween(srcSession, srcPath, dstSession, dstPath string) error {
+	src, err := lookupSession(srcSession)
+	if err != nil {
+		return err
+	}
+	dst, err := lookupSession(dstSession)
+	if err != nil {
+		return err
+	}
+
+	srcFS := src.fs
+	if src == dst {
+		extra, err := src.profile.Open()
+		if err != nil {
+			return fmt.Errorf("failed to connect: %v", err)
+		}
+		defer extra.Close()
+		srcFS = extra
+		dst.mu.Lock()
+		defer dst.mu.Unlock()
+	} else {
+		defer lockSessions(src, dst)()
+	}
+
+	job := a.startTransfer("copy", srcPath)
+	job.SetFile(dstPath)
+	if e, err := srcFS.Stat(srcPath); err == nil {
+		job.AddTotal(e.Size)
+	}
+	err = dst.fs.RunJob(job, func() error {
+		return copyBetween(job, srcFS, srcPath, dst.fs, dstPath)
+	})
+	job.Finish(err)
+	r := newTransferRecord("copy", src.profile.Address, job, srcPath, "", err)
+	r.Profile = src.profile.Name
+	r.Target = dst.profile.Address + ":" + dstPath
+	recordTransfer(r)
+	if err != nil {
+		MyLogger.Info("copy failed", "src", srcPath, "dst", dstPath, "error", err)
+		return fmt.Errorf("failed to copy: %v", err)
+	}
+	MyLogger.Info("copied", "src", src.ID+":"+srcPath, "dst", dst.ID+":"+dstPath)
+	return nil
+}
+
+// lockSessions 锁定两个不同的会话，返回解锁函数。按 ID 顺序加锁，两个方向同时复制时不会死锁
+func lockSessions(a, b *Session) (unlock func()) {
+	if b.ID < a.ID {
+		a, b = b, a
+	}
+	a.mu.Lock()
+	b.mu.Lock()
+	return func() {
+		b.mu.Unlock()
+		a.mu.Unlock()
+	}
+}
+
+// copyBetween 两端都是未加密的 FTP 连接时用 FXP 在服务器之间直接传输，
+// 服务器不允许 FXP 时经本机复制
+func copyBetween(job *TransferJob, src RemoteFS, srcPath string, dst RemoteFS, dstPath string) error {
+	srcFTP, srcOK := src.(*FTPClient)
+	dstFTP, dstOK := dst.(*FTPClient)
+	if srcOK && dstOK && srcFTP.tlsConfig == nil && dstFTP.tlsConfig == nil {
+		_, err := fxpJob(job, srcFTP.FTPConn, srcPath, dstFTP.FTPConn, dstPath)
+		if !errors.Is(err, ErrFXPRefused) {
+			return err
+		}
+		MyLogger.Info("fxp refused, copying through this machine", "src", srcPath, "dst", dstPath, "error", err)
+	}
+	return copyRemote(src, srcPath, dst, dstPath)
+}
+
+// copyRemote 从 src 读取文件并写入 dst，进度由 dst 的传输任务统计
+func copyRemote(src RemoteFS, srcPath string, dst RemoteFS, dstPath string) error {
+	r, err := src.Open(srcPath, 0)
+	if err != nil {
+		return err
+	}
+	w, err := dst.Create(dstPath)
+	if err != nil {
+		r.Close()
+		return err
+	}
+	_, copyErr := io.Copy(w, r)
+	closeErr := w.Close()
+	readErr := r.Close()
+	if copyErr != nil {
+		return copyErr
+	}
+	if closeErr != nil {
+		return closeErr
+	}
+	return readErr
+}
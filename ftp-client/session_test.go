@@ -0,0 +1,112 @@
+package main
+
+import (
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"changeme/internal/ftptest"
+)
+
+func TestAppSession(t *testing.T) {
+	srv := newTestServer(t)
+	srv.WriteFile("/notes.txt", []byte("line one\nline two\n"))
+	other := newTestServer(t)
+	app := NewApp()
+	id, err := app.Connect(srv.Addr, "rw", "123")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer app.Disconnect(id)
+	otherID, err := app.Connect(other.Addr, "rw", "123")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if id == otherID || len(app.Sessions()) != 2 {
+		t.Fatalf("sessions = %+v", app.Sessions())
+	}
+
+	entries, err := app.List(id, "/")
+	if err != nil || len(entries) != 1 {
+		t.Fatalf("List = %+v, %v", entries, err)
+	}
+	preview, err := app.Preview(id, "/notes.txt", 0, 4)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(preview.Data) != "line" || !preview.Truncated || !strings.HasPrefix(preview.MIME, "text/plain") {
+		t.Fatalf("unexpected preview: %+v", preview)
+	}
+	if err := app.CreateFolder(id, "/new"); err != nil {
+		t.Fatal(err)
+	}
+	if !srv.Exists("/new") || other.Exists("/new") {
+		t.Fatal("folder was not created in the right session")
+	}
+
+	// 在两个会话之间以及同一个会话内复制
+	if err := app.CopyBetween(id, "/notes.txt", otherID, "/copy.txt"); err != nil {
+		t.Fatal(err)
+	}
+	if data, _ := other.ReadFile("/copy.txt"); string(data) != "line one\nline two\n" {
+		t.Fatalf("copied %q", data)
+	}
+	if err := app.CopyBetween(id, "/notes.txt", id, "/new/notes.txt"); err != nil {
+		t.Fatal(err)
+	}
+	if !srv.Exists("/new/notes.txt") {
+		t.Fatal("copy within the session failed")
+	}
+
+	if err := app.Disconnect(otherID); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := app.List(otherID, "/"); err == nil {
+		t.Fatal("List succeeded on a closed session")
+	}
+	if len(app.Sessions()) != 1 {
+		t.Fatalf("sessions = %+v", app.Sessions())
+	}
+}
+
+func TestTransferCancel(t *testing.T) {
+	srv := newTestServer(t)
+	srv.WriteFile("/a.txt", []byte("data"))
+	// RETR 处理前等待，传输进行中可以取消
+	srv.Handle(ftptest.Rule{Command: "RETR", Times: 1, Delay: 200 * time.Millisecond})
+	app := NewApp()
+	id, err := app.Connect(srv.Addr, "rw", "123")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer app.Disconnect(id)
+	s, _ := lookupSession(id)
+	running := func() bool {
+		s.cancelMu.Lock()
+		defer s.cancelMu.Unlock()
+		return s.cancel != nil
+	}
+
+	dir := t.TempDir()
+	done := make(chan error, 1)
+	go func() { done <- app.Download(id, "/a.txt", filepath.Join(dir, "a.txt"), -1, "overwrite", "") }()
+	for deadline := time.Now().Add(time.Second); !running(); time.Sleep(5 * time.Millisecond) {
+		if time.Now().After(deadline) {
+			t.Fatal("download did not register its cancel function")
+		}
+	}
+	if err := <-done; err != nil {
+		t.Fatal(err)
+	}
+	// 传输结束后 StopDownload 不会取消之后的传输
+	if running() {
+		t.Fatal("cancel function left after the download")
+	}
+	if err := app.Upload(id, filepath.Join(dir, "a.txt"), "/b.txt", "overwrite", ""); err != nil {
+		t.Fatal(err)
+	}
+	if running() {
+		t.Fatal("cancel function left after the upload")
+	}
+}
@@ -0,0 +1,329 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/pkg/sftp"
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/agent"
+	"golang.org/x/crypto/ssh/knownhosts"
+)
+
+// sshHandshakeTimeout SSH 握手的最长时间
+const sshHandshakeTimeout = 30 * time.Second
+
+// SFTPFS 通过 SSH 的 SFTP 子系统访问远程文件
+type SFTPFS struct {
+	conn   *ssh.Client
+	client *sftp.Client
+	agent  net.Conn // 到 ssh-agent 的连接，没有时为 nil
+	job    *TransferJob
+}
+
+// 确保 SFTP 连接实现了 RemoteFS
+var _ RemoteFS = (*SFTPFS)(nil)
+
+// DialSFTP 按配置连接 SFTP 服务器。认证方式依次为私钥 (KeyFile，加密时用 Password 解密)、
+// ssh-agent 和密码；代理设置同样生效
+func DialSFTP(p Profile) (*SFTPFS, error) {
+	address := p.Address
+	host, _, err := net.SplitHostPort(address)
+	if err != nil {
+		host = address
+		address = net.JoinHostPort(address, "22")
+	}
+	username, password, err := ResolveCredentials(host, p.Username, p.Password)
+	if err != nil {
+		return nil, fmt.Errorf("读取凭据失败: %v", err)
+	}
+
+	hostKey, err := sshHostKeyCallback(p.Insecure, p.KnownHosts)
+	if err != nil {
+		return nil, err
+	}
+	auth, agentConn, err := sshAuthMethods(p.KeyFile, password)
+	if err != nil {
+		return nil, err
+	}
+	fail := func(err error) (*SFTPFS, error) {
+		if agentConn != nil {
+			agentConn.Close()
+		}
+		return nil, err
+	}
+	config := &ssh.ClientConfig{
+		User:            username,
+		Auth:            auth,
+		HostKeyCallback: hostKey,
+		Timeout:         sshHandshakeTimeout,
+	}
+
+	dialer, err := p.Proxy.Dialer()
+	if err != nil {
+		return fail(err)
+	}
+	conn, err := dialer.Dial("tcp", address)
+	if err != nil {
+		return fail(fmt.Errorf("连接到SFTP服务器失败: %v", err))
+	}
+	conn.SetDeadline(time.Now().Add(sshHandshakeTimeout))
+	sshConn, chans, reqs, err := ssh.NewClientConn(conn, address, config)
+	if err != nil {
+		conn.Close()
+		return fail(fmt.Errorf("SSH握手失败: %v", err))
+	}
+	conn.SetDeadline(time.Time{})
+
+	sshClient := ssh.NewClient(sshConn, chans, reqs)
+	client, err := sftp.NewClient(sshClient)
+	if err != nil {
+		sshClient.Close()
+		return fail(fmt.Errorf("启动SFTP子系统失败: %v", err))
+	}
+	return &SFTPFS{conn: sshClient, client: client, agent: agentConn}, nil
+}
+
+// sshAuthMethods 返回可用的认证方式；使用 ssh-agent 时同时返回到 agent 的连接，由调用方关闭
+func sshAuthMethods(keyFile, password string) ([]ssh.AuthMethod, net.Conn, error) {
+	var methods []ssh.AuthMethod
+	if keyFile != "" {
+		key, err := os.ReadFile(keyFile)
+		if err != nil {
+			return nil, nil, fmt.Errorf("读取私钥失败: %w", err)
+		}
+		signer, err := ssh.ParsePrivateKey(key)
+		var missing *ssh.PassphraseMissingError
+		if errors.As(err, &missing) {
+			signer, err = ssh.ParsePrivateKeyWithPassphrase(key, []byte(password))
+		}
+		if err != nil {
+			return nil, nil, fmt.Errorf("解析私钥失败: %v", err)
+		}
+		methods = append(methods, ssh.PublicKeys(signer))
+	}
+	var agentConn net.Conn
+	if sock := os.Getenv("SSH_AUTH_SOCK"); sock != "" {
+		if conn, err := net.Dial("unix", sock); err == nil {
+			agentConn = conn
+			methods = append(methods, ssh.PublicKeysCallback(agent.NewClient(conn).Signers))
+		}
+	}
+	if password != "" {
+		methods = append(methods, ssh.Password(password),
+			ssh.KeyboardInteractive(func(user, instruction string, questions []string, echos []bool) ([]string, error) {
+				answers := make([]string, len(questions))
+				for i := range answers {
+					answers[i] = password
+				}
+				return answers, nil
+			}))
+	}
+	return methods, agentConn, nil
+}
+
+// knownHostsFiles 返回记录新主机密钥的文件和校验时读取的文件。custom 为空时新主机记录在
+// configDir/known_hosts，同时参考 ~/.ssh/known_hosts 但不修改它
+func knownHostsFiles(custom string) (string, []string, error) {
+	if custom != "" {
+		return custom, []string{custom}, nil
+	}
+	dir, err := configDir()
+	if err != nil {
+		return "", nil, err
+	}
+	path := filepath.Join(dir, "known_hosts")
+	files := []string{path}
+	if home, err := os.UserHomeDir(); err == nil {
+		files = append(files, filepath.Join(home, ".ssh", "known_hosts"))
+	}
+	return path, files, nil
+}
+
+// sshHostKeyCallback 按 known_hosts 校验主机密钥。与 ssh 的 accept-new 相同，
+// 第一次连接的主机会被记录下来，已记录的主机密钥变化时拒绝连接
+func sshHostKeyCallback(insecure bool, knownHosts string) (ssh.HostKeyCallback, error) {
+	if insecure {
+		return ssh.InsecureIgnoreHostKey(), nil
+	}
+	path, files, err := knownHostsFiles(knownHosts)
+	if err != nil {
+		return nil, err
+	}
+	return func(hostname string, remote net.Addr, key ssh.PublicKey) error {
+		var existing []string
+		for _, f := range files {
+			if _, err := os.Stat(f); err == nil {
+				existing = append(existing, f)
+			}
+		}
+		if len(existing) > 0 {
+			check, err := knownhosts.New(existing...)
+			if err != nil {
+				return fmt.Errorf("读取 known_hosts 失败: %v", err)
+			}
+			err = check(hostname, remote, key)
+			var keyErr *knownhosts.KeyError
+			if !errors.As(err, &keyErr) {
+				return err
+			}
+			if len(keyErr.Want) > 0 {
+				return fmt.Errorf("%s 的主机密钥与 known_hosts 中记录的不一致，可能存在中间人攻击", hostname)
+			}
+		}
+
+		if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+			return err
+		}
+		f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0600)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		MyLogger.Info("adding host key to known_hosts", "host", hostname, "fingerprint", ssh.FingerprintSHA256(key))
+		_, err = fmt.Fprintln(f, knownhosts.Line([]string{knownhosts.Normalize(hostname)}, key))
+		return err
+	}, nil
+}
+
+func (s *SFTPFS) List(p string) ([]Entry, error) {
+	infos, err := s.client.ReadDir(p)
+	if err != nil {
+		return nil, fmt.Errorf("列出目录失败: %w", err)
+	}
+	entries := make([]Entry, 0, len(infos))
+	for _, info := range infos {
+		e := entryFromFileInfo(info)
+		if e.Type == EntryLink {
+			e.Target, _ = s.client.ReadLink(s.client.Join(p, e.Name))
+		}
+		entries = append(entries, e)
+	}
+	return entries, nil
+}
+
+func (s *SFTPFS) Stat(p string) (Entry, error) {
+	info, err := s.client.Stat(p)
+	if err != nil {
+		return Entry{}, fmt.Errorf("%s: %w", p, err)
+	}
+	return entryFromFileInfo(info), nil
+}
+
+// sftpStream 按任务限速并统计进度的 SFTP 文件读写流。
+// 不嵌入 *sftp.File，以免 io.Copy 通过 ReadFrom/WriteTo 绕过限速
+type sftpStream struct {
+	file     *sftp.File
+	throttle throttle
+	job      *TransferJob
+}
+
+func (s *sftpStream) Read(p []byte) (int, error) {
+	n, err := s.throttle.read(s.file, p)
+	s.job.Add(n)
+	return n, err
+}
+
+func (s *sftpStream) Write(p []byte) (int, error) {
+	n, err := s.throttle.write(s.file, p)
+	s.job.Add(n)
+	return n, err
+}
+
+func (s *sftpStream) Close() error {
+	return s.file.Close()
+}
+
+// abort 关闭远程文件句柄，正在等待的读写随之返回错误
+func (s *sftpStream) abort() { s.file.Close() }
+
+func (s *SFTPFS) stream(file *sftp.File) *sftpStream {
+	var limiter *RateLimiter
+	if s.job != nil {
+		limiter = s.job.Limiter
+	}
+	return &sftpStream{file: file, throttle: newThrottle(GlobalLimiter, limiter), job: s.job}
+}
+
+func (s *SFTPFS) Open(p string, offset int64) (io.ReadCloser, error) {
+	file, err := s.client.Open(p)
+	if err != nil {
+		return nil, fmt.Errorf("打开远程文件失败: %w", err)
+	}
+	if offset > 0 {
+		if _, err := file.Seek(offset, io.SeekStart); err != nil {
+			file.Close()
+			return nil, err
+		}
+	}
+	return s.stream(file), nil
+}
+
+func (s *SFTPFS) Create(p string) (io.WriteCloser, error) {
+	file, err := s.client.Create(p)
+	if err != nil {
+		return nil, fmt.Errorf("创建远程文件失败: %w", err)
+	}
+	return s.stream(file), nil
+}
+
+func (s *SFTPFS) Append(p string) (io.WriteCloser, error) {
+	file, err := s.client.OpenFile(p, os.O_WRONLY|os.O_CREATE|os.O_APPEND)
+	if err != nil {
+		return nil, fmt.Errorf("打开远程文件失败: %w", err)
+	}
+	return s.stream(file), nil
+}
+
+func (s *SFTPFS) Mkdir(p string) error {
+	if err := s.client.Mkdir(p); err != nil {
+		return fmt.Errorf("创建文件夹失败: %w", err)
+	}
+	return nil
+}
+
+func (s *SFTPFS) Remove(p string) error {
+	if err := s.client.Remove(p); err != nil {
+		return fmt.Errorf("删除失败: %w", err)
+	}
+	return nil
+}
+
+func (s *SFTPFS) Rename(from, to string) error {
+	if err := s.client.Rename(from, to); err != nil {
+		return fmt.Errorf("重命名失败: %w", err)
+	}
+	return nil
+}
+
+func (s *SFTPFS) Chmod(p string, mode os.FileMode) error {
+	if err := s.client.Chmod(p, mode); err != nil {
+		return fmt.Errorf("修改权限失败: %w", err)
+	}
+	return nil
+}
+
+// RunJob 在 job 下执行 fn，期间打开的文件按 job 和全局限速
+func (s *SFTPFS) RunJob(job *TransferJob, fn func() error) error {
+	prev := s.job
+	s.job = job
+	defer func() { s.job = prev }()
+	return fn()
+}
+
+func (s *SFTPFS) Job() *TransferJob {
+	return s.job
+}
+
+func (s *SFTPFS) Close() error {
+	s.client.Close()
+	if s.agent != nil {
+		s.agent.Close()
+	}
+	return s.conn.Close()
+}
@@ -0,0 +1,61 @@
+package main
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"golang.org/x/crypto/ssh"
+)
+
+func TestSSHHostKeyCallback(t *testing.T) {
+	newKey := func() ssh.PublicKey {
+		pub, _, err := ed25519.GenerateKey(rand.Reader)
+		if err != nil {
+			t.Fatal(err)
+		}
+		key, err := ssh.NewPublicKey(pub)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return key
+	}
+	remote := &net.TCPAddr{IP: net.IPv4(127, 0, 0, 1), Port: 22}
+	key, other := newKey(), newKey()
+
+	// 默认把新主机记录在 configDir/known_hosts，之后同一主机换了密钥时拒绝连接
+	check, err := sshHostKeyCallback(false, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := check("sftp.example.com:22", remote, key); err != nil {
+		t.Fatalf("new host: %v", err)
+	}
+	dir, _ := configDir()
+	if data, _ := os.ReadFile(filepath.Join(dir, "known_hosts")); !strings.Contains(string(data), "sftp.example.com") {
+		t.Fatalf("known_hosts = %q", data)
+	}
+	if err := check("sftp.example.com:22", remote, key); err != nil {
+		t.Fatalf("known host: %v", err)
+	}
+	if err := check("sftp.example.com:22", remote, other); err == nil {
+		t.Fatal("changed host key accepted")
+	}
+
+	// 配置了 KnownHosts 时只使用这个文件
+	custom := filepath.Join(t.TempDir(), "hosts")
+	check, err = sshHostKeyCallback(false, custom)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := check("sftp.example.com:22", remote, other); err != nil {
+		t.Fatalf("custom file: %v", err)
+	}
+	if data, _ := os.ReadFile(custom); !strings.Contains(string(data), "sftp.example.com") {
+		t.Fatalf("custom known_hosts = %q", data)
+	}
+}
@@ -0,0 +1,270 @@
+package main
+
+import (
+	"crypto/rand"
+	"fmt"
+	"math/big"
+	"net"
+	"os"
+	"path/filepath"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"ftp-server/server"
+	"github.com/wailsapp/wails/v2/pkg/runtime"
+)
+
+// ShareOptions 共享文件夹的设置
+type ShareOptions struct {
+	Dir      string `json:"dir"`
+	Port     int    `json:"port"` // 0 表示由系统选择
+	ReadOnly bool   `json:"readOnly"`
+}
+
+// ShareInfo 正在共享的文件夹和对方登录用的信息
+type ShareInfo struct {
+	Dir       string    `json:"dir"`
+	Port      int       `json:"port"`
+	Addresses []string  `json:"addresses"` // 本机的局域网地址 ip:port
+	User      string    `json:"user"`
+	Password  string    `json:"password"`
+	ReadOnly  bool      `json:"readOnly"`
+	Started   time.Time `json:"started"`
+}
+
+// Share 在本机启动的 FTP 服务器，把一个文件夹共享给别人下载或上传。
+// 用户名和密码每次共享时重新生成，停止后失效
+type Share struct {
+	srv  *server.Server
+	info ShareInfo
+	done chan struct{}
+}
+
+// 生成密码用的字符，去掉了容易看错的 0/O、1/l/I
+const shareAlphabet = "abcdefghijkmnpqrstuvwxyzABCDEFGHJKLMNPQRSTUVWXYZ23456789"
+
+// randomString 用 crypto/rand 生成 n 个字符
+func randomString(n int) (string, error) {
+	b := make([]byte, n)
+	max := big.NewInt(int64(len(shareAlphabet)))
+	for i := range b {
+		v, err := rand.Int(rand.Reader, max)
+		if err != nil {
+			return "", err
+		}
+		b[i] = shareAlphabet[v.Int64()]
+	}
+	return string(b), nil
+}
+
+// localAddresses 返回本机非回环的 IPv4 地址，对方用这些地址连接
+func localAddresses(port int) []string {
+	var addrs []string
+	ifaceAddrs, err := net.InterfaceAddrs()
+	if err != nil {
+		return nil
+	}
+	for _, a := range ifaceAddrs {
+		ipnet, ok := a.(*net.IPNet)
+		if !ok || ipnet.IP.IsLoopback() || ipnet.IP.To4() == nil {
+			continue
+		}
+		addrs = append(addrs, net.JoinHostPort(ipnet.IP.String(), strconv.Itoa(port)))
+	}
+	return addrs
+}
+
+// StartShare 在 opts.Port 上启动 FTP 服务器共享 opts.Dir，onEvent 接收连接和传输事件
+func StartShare(opts ShareOptions, onEvent func(server.Event)) (*Share, error) {
+	dir, err := filepath.Abs(opts.Dir)
+	if err != nil {
+		return nil, err
+	}
+	if info, err := os.Stat(dir); err != nil || !info.IsDir() {
+		return nil, fmt.Errorf("共享的文件夹不存在: %s", opts.Dir)
+	}
+	user, err := randomString(6)
+	if err != nil {
+		return nil, err
+	}
+	password, err := randomString(12)
+	if err != nil {
+		return nil, err
+	}
+	user = "share-" + user
+
+	perm := "elradfmw"
+	if opts.ReadOnly {
+		perm = "elr"
+	}
+	srv, err := server.New(server.Config{
+		Users:         []server.User{{Name: user, Password: password, Home: dir, Perm: perm}},
+		Banner:        "Shared folder ready.",
+		MaxConnsPerIP: 5,
+		OnEvent:       onEvent,
+	})
+	if err != nil {
+		return nil, err
+	}
+	// 自己监听，端口被占用时直接返回错误
+	l, err := net.Listen("tcp", net.JoinHostPort("", strconv.Itoa(opts.Port)))
+	if err != nil {
+		return nil, fmt.Errorf("监听端口 %d 失败: %v", opts.Port, err)
+	}
+	port := l.Addr().(*net.TCPAddr).Port
+	s := &Share{
+		srv: srv,
+		info: ShareInfo{
+			Dir:       dir,
+			Port:      port,
+			Addresses: localAddresses(port),
+			User:      user,
+			Password:  password,
+			ReadOnly:  opts.ReadOnly,
+			Started:   time.Now(),
+		},
+		done: make(chan struct{}),
+	}
+	go func() {
+		defer close(s.done)
+		if err := srv.Serve(l); err != nil && err != server.ErrServerClosed {
+			MyLogger.Info("share server stopped", "error", err)
+		}
+	}()
+	return s, nil
+}
+
+// Info 返回共享的信息
+func (s *Share) Info() ShareInfo {
+	return s.info
+}
+
+// Clients 返回已连接的客户端和它们正在进行的传输
+func (s *Share) Clients() []server.ClientInfo {
+	return s.srv.Clients()
+}
+
+// Disconnect 断开一个客户端
+func (s *Share) Disconnect(id uint64) error {
+	return s.srv.Disconnect(id)
+}
+
+// Stop 停止服务器并断开所有客户端
+func (s *Share) Stop() error {
+	err := s.srv.Close()
+	<-s.done
+	return err
+}
+
+// 当前的共享，同一时间只有一个
+var (
+	shareMu      sync.Mutex
+	currentShare *Share
+)
+
+// ChooseShareFolder 打开选择文件夹的对话框
+func (a *App) ChooseShareFolder() (string, error) {
+	dir, err := runtime.OpenDirectoryDialog(a.ctx, runtime.OpenDialogOptions{
+		Title: "Select a folder to share",
+	})
+	if err != nil {
+		return "", fmt.Errorf("failed to open folder dialog: %w", err)
+	}
+	return dir, nil
+}
+
+// StartShare 开始共享文件夹。连接、登录和传输事件通过 "share-event" 发送，
+// 客户端列表变化时和传输进行中每秒通过 "share-clients" 发送
+func (a *App) StartShare(opts ShareOptions) (ShareInfo, error) {
+	shareMu.Lock()
+	defer shareMu.Unlock()
+	if currentShare != nil {
+		return ShareInfo{}, fmt.Errorf("already sharing %s", currentShare.info.Dir)
+	}
+	// 事件可能在 StartShare 返回之前到达，共享创建后才能取得客户端列表
+	var started atomic.Pointer[Share]
+	onEvent := func(e server.Event) {
+		MyLogger.Info("share", "event", e.Type, "remote", e.Remote, "user", e.User, "path", e.Path, "bytes", e.Bytes)
+		a.emit("share-event", e)
+		if s := started.Load(); s != nil {
+			a.emit("share-clients", s.Clients())
+		}
+	}
+	share, err := StartShare(opts, onEvent)
+	if err != nil {
+		MyLogger.Info("failed to start share: ", err)
+		return ShareInfo{}, fmt.Errorf("failed to start share: %v", err)
+	}
+	started.Store(share)
+	currentShare = share
+	MyLogger.Info("share started", "dir", share.info.Dir, "port", share.info.Port, "readOnly", share.info.ReadOnly)
+	go a.watchShare(share)
+	return share.Info(), nil
+}
+
+// watchShare 有传输进行时每秒发送一次客户端列表，前端据此显示进度
+func (a *App) watchShare(share *Share) {
+	ticker := time.NewTicker(time.Second)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-share.done:
+			return
+		case <-ticker.C:
+			clients := share.Clients()
+			for _, c := range clients {
+				if c.Transfer != nil {
+					a.emit("share-clients", clients)
+					break
+				}
+			}
+		}
+	}
+}
+
+// ShareStatus 返回当前的共享，没有共享时为 nil
+func (a *App) ShareStatus() *ShareInfo {
+	shareMu.Lock()
+	defer shareMu.Unlock()
+	if currentShare == nil {
+		return nil
+	}
+	info := currentShare.Info()
+	return &info
+}
+
+// ShareClients 返回连接到共享的客户端
+func (a *App) ShareClients() []server.ClientInfo {
+	shareMu.Lock()
+	defer shareMu.Unlock()
+	if currentShare == nil {
+		return nil
+	}
+	return currentShare.Clients()
+}
+
+// DisconnectShareClient 断开连接到共享的一个客户端
+func (a *App) DisconnectShareClient(id uint64) error {
+	shareMu.Lock()
+	defer shareMu.Unlock()
+	if currentShare == nil {
+		return fmt.Errorf("not sharing")
+	}
+	return currentShare.Disconnect(id)
+}
+
+// StopShare 停止共享，生成的用户名和密码随之失效
+func (a *App) StopShare() error {
+	shareMu.Lock()
+	defer shareMu.Unlock()
+	if currentShare == nil {
+		return nil
+	}
+	err := currentShare.Stop()
+	MyLogger.Info("share stopped", "dir", currentShare.info.Dir)
+	currentShare = nil
+	a.emit("share-clients", []server.ClientInfo{})
+	return err
+}
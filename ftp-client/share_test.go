@@ -0,0 +1,68 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+
+	"ftp-server/server"
+)
+
+func TestShareFolder(t *testing.T) {
+	dir := t.TempDir()
+	os.WriteFile(filepath.Join(dir, "shared.txt"), []byte("from my laptop"), 0644)
+	var events []string
+	var mu sync.Mutex
+	share, err := StartShare(ShareOptions{Dir: dir, ReadOnly: true}, func(e server.Event) {
+		mu.Lock()
+		events = append(events, e.Type)
+		mu.Unlock()
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	info := share.Info()
+	addr := fmt.Sprintf("127.0.0.1:%d", info.Port)
+
+	client := NewFTPClient()
+	if err := client.Dial(addr); err != nil {
+		t.Fatal(err)
+	}
+	if err := client.Login(info.User, info.Password); err != nil {
+		t.Fatal(err)
+	}
+	entries, err := client.List("/")
+	if err != nil || len(entries) != 1 || entries[0].Name != "shared.txt" {
+		t.Fatalf("List = %+v, %v", entries, err)
+	}
+	local := filepath.Join(t.TempDir(), "shared.txt")
+	if err := DownloadFile(context.Background(), client, "/shared.txt", local, 0, -1); err != nil {
+		t.Fatal(err)
+	}
+	if err := UploadFile(context.Background(), client, local, "/uploaded.txt"); err == nil {
+		t.Fatal("upload to a read-only share succeeded")
+	}
+	if clients := share.Clients(); len(clients) != 1 || clients[0].User != info.User {
+		t.Fatalf("unexpected clients: %+v", clients)
+	}
+
+	if err := share.Stop(); err != nil {
+		t.Fatal(err)
+	}
+	client.Close()
+	mu.Lock()
+	defer mu.Unlock()
+	want := []string{server.EventConnect, server.EventLogin, server.EventTransferStart, server.EventFileSent}
+	for i, typ := range want {
+		if i >= len(events) || events[i] != typ {
+			t.Fatalf("events = %v, want prefix %v", events, want)
+		}
+	}
+	if retry := NewFTPClient(); retry.Dial(addr) == nil {
+		retry.Close()
+		t.Fatal("share still accepts connections after Stop")
+	}
+}
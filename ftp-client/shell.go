@@ -0,0 +1,703 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+// errShellExit 用户输入 quit/exit/bye
+var errShellExit = errors.New("exit")
+
+// Shell 在一个已登录的 FTPClient 上执行文本命令，供命令行单次调用和交互式 REPL 共用
+type Shell struct {
+	client   *FTPClient
+	out      io.Writer
+	errOut   io.Writer              // 非 JSON 模式下错误信息的输出位置
+	json     bool                   // 每条命令的结果输出为一行 JSON
+	progress func(TransferProgress) // 非空时接收传输进度
+	typ      TransferType           // type 命令设置的传输类型，空表示使用默认值
+	conflict ConflictPolicy         // conflict 命令设置的冲突策略，空表示使用默认值
+}
+
+// NewShell 创建命令解释器，命令结果写到 out，错误写到 stderr
+func NewShell(client *FTPClient, out io.Writer, jsonOutput bool) *Shell {
+	return &Shell{client: client, out: out, errOut: os.Stderr, json: jsonOutput}
+}
+
+type shellCommand struct {
+	usage string
+	run   func(sh *Shell, args []string) error
+}
+
+var shellCommands map[string]shellCommand
+
+func init() {
+	shellCommands = map[string]shellCommand{
+		"ls":       {"ls [path]", (*Shell).ls},
+		"cd":       {"cd <path>", (*Shell).cd},
+		"pwd":      {"pwd", (*Shell).pwd},
+		"lcd":      {"lcd <local-path>", (*Shell).lcd},
+		"lpwd":     {"lpwd", (*Shell).lpwd},
+		"get":      {"get <remote-glob> [local]", (*Shell).get},
+		"put":      {"put <local-glob> [remote]", (*Shell).put},
+		"mkdir":    {"mkdir <path>", (*Shell).mkdir},
+		"rm":       {"rm [-r] <path>", (*Shell).rm},
+		"rmdir":    {"rmdir <path>", (*Shell).rmdir},
+		"mv":       {"mv <from> <to>", (*Shell).mv},
+		"chmod":    {"chmod [-R] <mode>|<file-mode>:<dir-mode> <path>", (*Shell).chmod},
+		"mirror":   {"mirror <remote-dir> <local-dir> | mirror -R <local-dir> <remote-dir>", (*Shell).mirror},
+		"size":     {"size <path>", (*Shell).size},
+		"verify":   {"verify <local-glob> [remote-dir]", (*Shell).verify},
+		"quote":    {"quote <raw command>", (*Shell).quote},
+		"type":     {"type [auto|ascii|binary]", (*Shell).setType},
+		"conflict": {"conflict [overwrite|skip|resume|rename|newer|size-differs]", (*Shell).setConflict},
+		"ascii":    {"ascii", (*Shell).ascii},
+		"binary":   {"binary", (*Shell).binary},
+		"help":     {"help", (*Shell).help},
+	}
+}
+
+// shellHelpOrder help 列出命令的顺序，须包含 shellCommands 中的每个命令
+var shellHelpOrder = []string{
+	"ls", "cd", "pwd", "lcd", "lpwd", "get", "put", "mkdir", "rm", "rmdir", "mv", "chmod",
+	"mirror", "size", "verify", "quote", "type", "ascii", "binary", "conflict", "help",
+}
+
+// Exec 解析并执行一行命令，支持单双引号和反斜杠转义
+func (sh *Shell) Exec(line string) error {
+	args, err := splitCommandLine(line)
+	if err != nil {
+		return usageError(err)
+	}
+	if len(args) == 0 {
+		return nil
+	}
+	return sh.Run(args)
+}
+
+// Run 执行一条已拆分好参数的命令
+func (sh *Shell) Run(args []string) error {
+	name := strings.ToLower(args[0])
+	switch name {
+	case "quit", "exit", "bye":
+		return errShellExit
+	}
+	cmd, ok := shellCommands[name]
+	if !ok {
+		return usageError(fmt.Errorf("未知命令: %s (输入 help 查看可用命令)", args[0]))
+	}
+	return cmd.run(sh, args[1:])
+}
+
+// REPL 逐行读取命令并执行，出错时打印错误并继续，直到 EOF 或 quit
+func (sh *Shell) REPL(in io.Reader, prompt io.Writer) error {
+	scanner := bufio.NewScanner(in)
+	for {
+		if prompt != nil {
+			fmt.Fprint(prompt, "ftp> ")
+		}
+		if !scanner.Scan() {
+			return scanner.Err()
+		}
+		err := sh.Exec(scanner.Text())
+		if errors.Is(err, errShellExit) {
+			return nil
+		}
+		if err != nil {
+			sh.reportError(err)
+		}
+	}
+}
+
+// report 输出一条命令结果：JSON 模式下输出 fields，否则输出格式化文本
+func (sh *Shell) report(fields map[string]interface{}, format string, a ...interface{}) {
+	if sh.json {
+		fields["ok"] = true
+		data, _ := json.Marshal(fields)
+		fmt.Fprintln(sh.out, string(data))
+		return
+	}
+	if format != "" {
+		fmt.Fprintf(sh.out, format+"\n", a...)
+	}
+}
+
+// reportError 输出错误，JSON 模式下写到 out，否则写到 stderr
+func (sh *Shell) reportError(err error) {
+	if sh.json {
+		data, _ := json.Marshal(map[string]interface{}{
+			"ok":       false,
+			"error":    err.Error(),
+			"exitCode": exitCodeFor(err),
+		})
+		fmt.Fprintln(sh.out, string(data))
+		return
+	}
+	fmt.Fprintln(sh.errOut, "error:", err)
+}
+
+func (sh *Shell) ls(args []string) error {
+	dir := "."
+	if len(args) > 0 {
+		dir = args[0]
+	}
+	var entries []Entry
+	err := sh.runJob("list", dir, func() (err error) {
+		entries, err = sh.client.List(dir)
+		return err
+	})
+	if err != nil {
+		return err
+	}
+	if sh.json {
+		sh.report(map[string]interface{}{"command": "ls", "path": dir, "entries": entries}, "")
+		return nil
+	}
+	for _, e := range entries {
+		name := e.Name
+		if e.IsDir() {
+			name += "/"
+		}
+		fmt.Fprintf(sh.out, "%s %12d %s %s\n", e.Mode, e.Size, e.Time.Format("2006-01-02 15:04"), name)
+	}
+	return nil
+}
+
+// runJob 以传输任务的方式执行 fn，使限速和进度对命令生效
+func (sh *Shell) runJob(kind, name string, fn func() error) error {
+	_, err := sh.runJobWith(kind, name, fn)
+	return err
+}
+
+func (sh *Shell) runJobWith(kind, name string, fn func() error) (*TransferJob, error) {
+	job := NewTransferJob(kind, name, sh.progress)
+	if sh.typ != "" {
+		job.Type = sh.typ
+	}
+	if sh.conflict != "" {
+		job.Conflict = sh.conflict
+	}
+	err := sh.client.RunJob(job, fn)
+	job.Finish(err)
+	return job, err
+}
+
+// runTransfer 执行单个文件的上传或下载，结束后保存传输记录；fn 返回实际传输的远程和本地路径
+func (sh *Shell) runTransfer(kind, name string, fn func() (remote, local string, err error)) error {
+	var remote, local string
+	job, err := sh.runJobWith(kind, name, func() (err error) {
+		remote, local, err = fn()
+		return err
+	})
+	recordTransfer(newTransferRecord(kind, sh.client.Addr(), job, remote, local, err))
+	return err
+}
+
+func (sh *Shell) cd(args []string) error {
+	if len(args) != 1 {
+		return usageError(fmt.Errorf("用法: %s", shellCommands["cd"].usage))
+	}
+	if err := sh.client.ChangeDir(args[0]); err != nil {
+		return err
+	}
+	return sh.pwd(nil)
+}
+
+func (sh *Shell) pwd(args []string) error {
+	dir, err := sh.client.CurrentDir()
+	if err != nil {
+		return err
+	}
+	sh.report(map[string]interface{}{"command": "pwd", "path": dir}, "%s", dir)
+	return nil
+}
+
+// setType 设置之后 get/put/mirror 的传输类型，不带参数时显示当前类型
+func (sh *Shell) setType(args []string) error {
+	if len(args) > 1 {
+		return usageError(fmt.Errorf("用法: %s", shellCommands["type"].usage))
+	}
+	if len(args) == 1 {
+		typ, err := ParseTransferType(args[0])
+		if err != nil {
+			return usageError(err)
+		}
+		sh.typ = typ
+	}
+	typ := sh.typ
+	if typ == "" {
+		transfers.mu.Lock()
+		typ = transfers.defaultType
+		transfers.mu.Unlock()
+	}
+	sh.report(map[string]interface{}{"command": "type", "type": typ}, "transfer type: %s", typ)
+	return nil
+}
+
+// setConflict 设置之后 get/put 在目标已存在时的处理方式，不带参数时显示当前策略。
+// 命令行无法询问，不接受 ask
+func (sh *Shell) setConflict(args []string) error {
+	if len(args) > 1 {
+		return usageError(fmt.Errorf("用法: %s", shellCommands["conflict"].usage))
+	}
+	if len(args) == 1 {
+		policy, err := ParseConflictPolicy(args[0])
+		if err == nil && policy == ConflictAsk {
+			err = fmt.Errorf("命令行中不能使用 ask")
+		}
+		if err != nil {
+			return usageError(err)
+		}
+		sh.conflict = policy
+	}
+	policy := sh.conflict
+	if policy == "" {
+		transfers.mu.Lock()
+		policy = transfers.defaultConflict
+		transfers.mu.Unlock()
+	}
+	sh.report(map[string]interface{}{"command": "conflict", "policy": policy}, "conflict policy: %s", policy)
+	return nil
+}
+
+func (sh *Shell) ascii(args []string) error {
+	return sh.setType([]string{string(TransferASCII)})
+}
+
+func (sh *Shell) binary(args []string) error {
+	return sh.setType([]string{string(TransferBinary)})
+}
+
+func (sh *Shell) lcd(args []string) error {
+	if len(args) != 1 {
+		return usageError(fmt.Errorf("用法: %s", shellCommands["lcd"].usage))
+	}
+	if err := os.Chdir(args[0]); err != nil {
+		return fmt.Errorf("切换本地目录失败: %w", err)
+	}
+	return sh.lpwd(nil)
+}
+
+func (sh *Shell) lpwd(args []string) error {
+	dir, err := os.Getwd()
+	if err != nil {
+		return fmt.Errorf("获取本地目录失败: %w", err)
+	}
+	sh.report(map[string]interface{}{"command": "lpwd", "path": dir}, "%s", dir)
+	return nil
+}
+
+func (sh *Shell) get(args []string) error {
+	if len(args) < 1 || len(args) > 2 {
+		return usageError(fmt.Errorf("用法: %s", shellCommands["get"].usage))
+	}
+	remotes, err := sh.expandRemote(args[0])
+	if err != nil {
+		return err
+	}
+	for _, remote := range remotes {
+		local := path.Base(remote)
+		if len(args) == 2 {
+			local = args[1]
+			if info, err := os.Stat(local); (err == nil && info.IsDir()) || len(remotes) > 1 {
+				local = filepath.Join(local, path.Base(remote))
+			}
+		}
+		if err := sh.getOne(remote, local); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (sh *Shell) getOne(remote, local string) error {
+	err := sh.runTransfer("download", remote, func() (string, string, error) {
+		saved, err := GetFile(context.Background(), sh.client, remote, local)
+		if saved != "" {
+			local = saved
+		}
+		return remote, local, err
+	})
+	if errors.Is(err, ErrSkipped) {
+		sh.report(map[string]interface{}{"command": "get", "remote": remote, "local": local, "skipped": true},
+			"%s -> %s (skipped, already exists)", remote, local)
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	size := localSize(local)
+	sh.report(map[string]interface{}{"command": "get", "remote": remote, "local": local, "bytes": size},
+		"%s -> %s (%d bytes)", remote, local, size)
+	return nil
+}
+
+func (sh *Shell) put(args []string) error {
+	if len(args) < 1 || len(args) > 2 {
+		return usageError(fmt.Errorf("用法: %s", shellCommands["put"].usage))
+	}
+	locals, err := expandLocal(args[0])
+	if err != nil {
+		return err
+	}
+	for _, local := range locals {
+		if err := sh.putOne(local, remoteTarget(local, args[1:], len(locals) > 1)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (sh *Shell) putOne(local, remote string) error {
+	err := sh.runTransfer("upload", remote, func() (string, string, error) {
+		saved, err := PutFile(context.Background(), sh.client, local, remote)
+		if saved != "" {
+			remote = saved
+		}
+		return remote, local, err
+	})
+	if errors.Is(err, ErrSkipped) {
+		sh.report(map[string]interface{}{"command": "put", "local": local, "remote": remote, "skipped": true},
+			"%s -> %s (skipped, already exists)", local, remote)
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	size := localSize(local)
+	sh.report(map[string]interface{}{"command": "put", "local": local, "remote": remote, "bytes": size},
+		"%s -> %s (%d bytes)", local, remote, size)
+	return nil
+}
+
+// verify 比较本地文件与远程同名文件的大小
+func (sh *Shell) verify(args []string) error {
+	if len(args) < 1 || len(args) > 2 {
+		return usageError(fmt.Errorf("用法: %s", shellCommands["verify"].usage))
+	}
+	locals, err := expandLocal(args[0])
+	if err != nil {
+		return err
+	}
+	for _, local := range locals {
+		remote := remoteTarget(local, args[1:], true)
+		remoteSize, err := sh.client.Size(remote)
+		if err != nil {
+			return err
+		}
+		size := localSize(local)
+		if size != remoteSize {
+			return fmt.Errorf("校验失败: %s 为 %d 字节, %s 为 %d 字节", local, size, remote, remoteSize)
+		}
+		sh.report(map[string]interface{}{"command": "verify", "local": local, "remote": remote, "bytes": size},
+			"%s == %s (%d bytes)", local, remote, size)
+	}
+	return nil
+}
+
+// remoteTarget 计算上传目标路径：未指定时使用本地文件名，目录 (以 / 结尾或多个文件) 时拼接文件名
+func remoteTarget(local string, args []string, intoDir bool) string {
+	if len(args) == 0 {
+		return filepath.Base(local)
+	}
+	if intoDir || strings.HasSuffix(args[0], "/") {
+		return path.Join(args[0], filepath.Base(local))
+	}
+	return args[0]
+}
+
+// hasGlobMeta 判断路径中是否包含通配符
+func hasGlobMeta(pattern string) bool {
+	return strings.ContainsAny(pattern, "*?[")
+}
+
+// expandLocal 展开本地通配符，没有匹配时报错
+func expandLocal(pattern string) ([]string, error) {
+	if !hasGlobMeta(pattern) {
+		return []string{pattern}, nil
+	}
+	matches, err := filepath.Glob(pattern)
+	if err != nil {
+		return nil, usageError(fmt.Errorf("无效的通配符: %s", pattern))
+	}
+	var files []string
+	for _, m := range matches {
+		if info, err := os.Stat(m); err == nil && info.Mode().IsRegular() {
+			files = append(files, m)
+		}
+	}
+	if len(files) == 0 {
+		return nil, fmt.Errorf("没有匹配的本地文件: %w", &fs.PathError{Op: "glob", Path: pattern, Err: fs.ErrNotExist})
+	}
+	return files, nil
+}
+
+// expandRemote 展开远程文件名中的通配符 (只支持最后一级)，没有匹配时报错
+func (sh *Shell) expandRemote(pattern string) ([]string, error) {
+	dir, base := path.Split(pattern)
+	if !hasGlobMeta(base) {
+		return []string{pattern}, nil
+	}
+	if dir == "" {
+		dir = "."
+	}
+	entries, err := sh.client.List(dir)
+	if err != nil {
+		return nil, err
+	}
+	var files []string
+	for _, e := range entries {
+		ok, err := path.Match(base, e.Name)
+		if err != nil {
+			return nil, usageError(fmt.Errorf("无效的通配符: %s", pattern))
+		}
+		if ok && e.Type == EntryFile {
+			files = append(files, path.Join(dir, e.Name))
+		}
+	}
+	if len(files) == 0 {
+		return nil, fmt.Errorf("没有匹配的远程文件: %s", pattern)
+	}
+	return files, nil
+}
+
+func (sh *Shell) mkdir(args []string) error {
+	if len(args) != 1 {
+		return usageError(fmt.Errorf("用法: %s", shellCommands["mkdir"].usage))
+	}
+	if err := sh.client.MakeDir(args[0]); err != nil {
+		return err
+	}
+	sh.report(map[string]interface{}{"command": "mkdir", "path": args[0]}, "")
+	return nil
+}
+
+func (sh *Shell) rm(args []string) error {
+	recursive := false
+	if len(args) > 0 && args[0] == "-r" {
+		recursive = true
+		args = args[1:]
+	}
+	if len(args) != 1 {
+		return usageError(fmt.Errorf("用法: %s", shellCommands["rm"].usage))
+	}
+
+	var err error
+	if recursive {
+		err = RemoveAll(sh.client, args[0])
+	} else {
+		err = sh.client.Dele(args[0], false)
+	}
+	if err != nil {
+		return err
+	}
+	sh.report(map[string]interface{}{"command": "rm", "path": args[0], "recursive": recursive}, "")
+	return nil
+}
+
+func (sh *Shell) rmdir(args []string) error {
+	if len(args) != 1 {
+		return usageError(fmt.Errorf("用法: %s", shellCommands["rmdir"].usage))
+	}
+	if err := sh.client.Dele(args[0], true); err != nil {
+		return err
+	}
+	sh.report(map[string]interface{}{"command": "rmdir", "path": args[0]}, "")
+	return nil
+}
+
+func (sh *Shell) mv(args []string) error {
+	if len(args) != 2 {
+		return usageError(fmt.Errorf("用法: %s", shellCommands["mv"].usage))
+	}
+	if err := sh.client.Rename(args[0], args[1]); err != nil {
+		return err
+	}
+	sh.report(map[string]interface{}{"command": "mv", "from": args[0], "to": args[1]}, "")
+	return nil
+}
+
+// chmod 修改权限；-R 时可以用 644:755 分别指定文件和目录的权限，"-" 表示不修改
+func (sh *Shell) chmod(args []string) error {
+	recursive := false
+	if len(args) > 0 && args[0] == "-R" {
+		recursive = true
+		args = args[1:]
+	}
+	if len(args) != 2 {
+		return usageError(fmt.Errorf("用法: %s", shellCommands["chmod"].usage))
+	}
+	fileSpec, dirSpec, split := strings.Cut(args[0], ":")
+	if split && !recursive {
+		return usageError(fmt.Errorf("<file-mode>:<dir-mode> 只能与 -R 一起使用"))
+	}
+	if !split {
+		dirSpec = fileSpec
+	}
+	var modes [2]*os.FileMode
+	for i, spec := range []string{fileSpec, dirSpec} {
+		if spec == "-" {
+			continue
+		}
+		mode, err := ParseMode(spec)
+		if err != nil {
+			return usageError(err)
+		}
+		modes[i] = &mode
+	}
+
+	if !recursive {
+		if modes[0] == nil {
+			return usageError(fmt.Errorf("用法: %s", shellCommands["chmod"].usage))
+		}
+		if err := sh.client.Chmod(args[1], *modes[0]); err != nil {
+			return err
+		}
+		sh.report(map[string]interface{}{"command": "chmod", "path": args[1], "mode": args[0]}, "")
+		return nil
+	}
+	stats, err := ChmodAll(sh.client, args[1], modes[0], modes[1])
+	if err != nil {
+		return err
+	}
+	sh.report(map[string]interface{}{"command": "chmod", "path": args[1], "mode": args[0], "recursive": true, "stats": stats},
+		"%d files, %d directories changed", stats.Files, stats.Dirs)
+	return nil
+}
+
+func (sh *Shell) mirror(args []string) error {
+	reverse := false
+	if len(args) > 0 && args[0] == "-R" {
+		reverse = true
+		args = args[1:]
+	}
+	if len(args) != 2 {
+		return usageError(fmt.Errorf("用法: %s", shellCommands["mirror"].usage))
+	}
+
+	var stats MirrorStats
+	err := sh.runJob("mirror", args[0], func() (err error) {
+		if reverse {
+			stats, err = MirrorUp(sh.client, args[0], args[1])
+		} else {
+			stats, err = MirrorDown(sh.client, args[0], args[1])
+		}
+		return err
+	})
+	if err != nil {
+		return err
+	}
+	sh.report(map[string]interface{}{"command": "mirror", "reverse": reverse, "stats": stats},
+		"%d files transferred (%d bytes), %d skipped, %d directories", stats.Files, stats.Bytes, stats.Skipped, stats.Dirs)
+	return nil
+}
+
+func (sh *Shell) size(args []string) error {
+	if len(args) != 1 {
+		return usageError(fmt.Errorf("用法: %s", shellCommands["size"].usage))
+	}
+	size, err := sh.client.Size(args[0])
+	if err != nil {
+		return err
+	}
+	sh.report(map[string]interface{}{"command": "size", "path": args[0], "bytes": size}, "%d", size)
+	return nil
+}
+
+func (sh *Shell) quote(args []string) error {
+	if len(args) == 0 {
+		return usageError(fmt.Errorf("用法: %s", shellCommands["quote"].usage))
+	}
+	command := strings.Join(args, " ")
+	verb := strings.ToUpper(args[0])
+	if dataCommands[verb] {
+		return usageError(fmt.Errorf("%s 需要数据连接，不能通过 quote 发送", verb))
+	}
+	if state := stateCommand(command); state != "" {
+		return usageError(fmt.Errorf("%s 会改变连接状态，不能通过 quote 发送", state))
+	}
+	reply, err := sh.client.RawCommand(command)
+	if err != nil {
+		return err
+	}
+	sh.report(map[string]interface{}{"command": "quote", "reply": reply}, "%s", strings.Join(reply.Lines, "\n"))
+	if !reply.Positive() {
+		return fmt.Errorf("服务器返回错误: %s", reply.Lines[len(reply.Lines)-1])
+	}
+	return nil
+}
+
+func (sh *Shell) help(args []string) error {
+	for _, name := range shellHelpOrder {
+		fmt.Fprintln(sh.out, "  "+shellCommands[name].usage)
+	}
+	fmt.Fprintln(sh.out, "  quit")
+	return nil
+}
+
+func localSize(name string) int64 {
+	info, err := os.Stat(name)
+	if err != nil {
+		return 0
+	}
+	return info.Size()
+}
+
+// splitCommandLine 按空白拆分命令行，支持引号和反斜杠转义
+func splitCommandLine(line string) ([]string, error) {
+	var args []string
+	var current strings.Builder
+	inArg := false
+	var quote rune
+
+	runes := []rune(line)
+	for i := 0; i < len(runes); i++ {
+		r := runes[i]
+		switch {
+		case quote != 0:
+			if r == quote {
+				quote = 0
+			} else if r == '\\' && quote == '"' && i+1 < len(runes) {
+				i++
+				current.WriteRune(runes[i])
+			} else {
+				current.WriteRune(r)
+			}
+		case r == '\'' || r == '"':
+			quote = r
+			inArg = true
+		case r == '\\' && i+1 < len(runes):
+			i++
+			current.WriteRune(runes[i])
+			inArg = true
+		case r == ' ' || r == '\t':
+			if inArg {
+				args = append(args, current.String())
+				current.Reset()
+				inArg = false
+			}
+		case r == '#' && !inArg:
+			// 注释
+			i = len(runes)
+		default:
+			current.WriteRune(r)
+			inArg = true
+		}
+	}
+	if quote != 0 {
+		return nil, fmt.Errorf("引号未闭合: %s", line)
+	}
+	if inArg {
+		args = append(args, current.String())
+	}
+	return args, nil
+}
@@ -0,0 +1,28 @@
+package main
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func TestShellHelp(t *testing.T) {
+	var out bytes.Buffer
+	sh := NewShell(nil, &out, false)
+	if err := sh.Exec("help"); err != nil {
+		t.Fatal(err)
+	}
+	lines := strings.Split(out.String(), "\n")
+	for name, cmd := range shellCommands {
+		found := false
+		for _, line := range lines {
+			found = found || strings.TrimSpace(line) == cmd.usage
+		}
+		if !found {
+			t.Errorf("help does not list %s", name)
+		}
+	}
+	if len(shellHelpOrder) != len(shellCommands) {
+		t.Errorf("help lists %d commands, the shell has %d", len(shellHelpOrder), len(shellCommands))
+	}
+}
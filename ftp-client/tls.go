@@ -0,0 +1,43 @@
+package main
+
+import (
+	"bufio"
+	"crypto/tls"
+	"fmt"
+	"strings"
+)
+
+// AuthTLS 在已建立的控制连接上启用显式TLS (AUTH TLS)，
+// 并通过 PBSZ 0 / PROT P 要求数据连接同样加密
+func (ftp *FTPConn) AuthTLS(config *tls.Config) error {
+	response, err := ftp.SendCommand("AUTH TLS")
+	if err != nil {
+		return fmt.Errorf("发送AUTH TLS命令失败: %v", err)
+	}
+	if !strings.HasPrefix(response, "234") {
+		return fmt.Errorf("服务器不支持TLS: %s", response)
+	}
+
+	if config.ClientSessionCache == nil {
+		// 部分服务器要求数据连接复用控制连接的TLS会话
+		config.ClientSessionCache = tls.NewLRUClientSessionCache(4)
+	}
+	tlsConn := tls.Client(ftp.controlConn, config)
+	if err := tlsConn.Handshake(); err != nil {
+		return fmt.Errorf("TLS握手失败: %v", err)
+	}
+	ftp.controlConn = tlsConn
+	ftp.reader = bufio.NewReader(tlsConn)
+	ftp.tlsConfig = config
+
+	for _, command := range []string{"PBSZ 0", "PROT P"} {
+		response, err := ftp.SendCommand(command)
+		if err != nil {
+			return fmt.Errorf("发送%s命令失败: %v", command, err)
+		}
+		if !strings.HasPrefix(response, "200") {
+			return fmt.Errorf("%s 失败: %s", command, response)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,80 @@
+package main
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"log/slog"
+	"os"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	TraceSend = "send" // 客户端 -> 服务器
+	TraceRecv = "recv" // 服务器 -> 客户端
+)
+
+// ProtocolTracer 记录控制连接上的每一条命令与响应，与普通日志分开写入
+type ProtocolTracer struct {
+	enabled atomic.Bool
+	slog    *slog.Logger
+	file    *os.File
+}
+
+// NewProtocolTracer 创建协议跟踪日志，默认关闭，可在运行时通过 SetEnabled 切换
+func NewProtocolTracer(filePath string, enabled bool) (*ProtocolTracer, error) {
+	f, err := os.OpenFile(filePath, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0600)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create trace file %s: %w", filePath, err)
+	}
+	handle := slog.NewJSONHandler(f, &slog.HandlerOptions{Level: slog.LevelDebug})
+	t := &ProtocolTracer{slog: slog.New(newRedactHandler(handle)), file: f}
+	t.enabled.Store(enabled)
+	return t, nil
+}
+
+// SetEnabled 打开或关闭协议跟踪，无需重启；没有跟踪日志 (命令行模式) 时不做任何事
+func (t *ProtocolTracer) SetEnabled(enabled bool) {
+	if t != nil {
+		t.enabled.Store(enabled)
+	}
+}
+
+func (t *ProtocolTracer) Enabled() bool {
+	return t != nil && t.enabled.Load()
+}
+
+// Close 关闭跟踪日志文件
+func (t *ProtocolTracer) Close() error {
+	if t == nil {
+		return nil
+	}
+	return t.file.Close()
+}
+
+// Trace 记录一行协议数据；seq 用于把命令和它的响应配对，elapsed 为响应相对命令的耗时
+func (t *ProtocolTracer) Trace(session string, seq uint64, direction, line string, elapsed time.Duration) {
+	if t == nil || !t.enabled.Load() {
+		return
+	}
+	attrs := []any{
+		"session", session,
+		"seq", seq,
+		"direction", direction,
+		"line", RedactCommand(line),
+	}
+	if direction == TraceRecv {
+		attrs = append(attrs, "elapsed_ms", float64(elapsed.Microseconds())/1000)
+	}
+	t.slog.Debug("ftp", attrs...)
+}
+
+// newSessionID 生成一个随机的会话标识
+func newSessionID() string {
+	b := make([]byte, 4)
+	if _, err := rand.Read(b); err != nil {
+		return fmt.Sprintf("%08x", time.Now().UnixNano()&0xffffffff)
+	}
+	return hex.EncodeToString(b)
+}
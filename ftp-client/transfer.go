@@ -0,0 +1,119 @@
+package main
+
+import (
+	"fmt"
+	"sync"
+	"sync/atomic"
+)
+
+// TransferJob 一次用户发起的传输任务 (上传、下载或递归操作)，
+// 任务期间的所有数据连接共用同一个限速器
+type TransferJob struct {
+	ID       string         `json:"id"`
+	Kind     string         `json:"kind"` // upload / download / list / mirror
+	Name     string         `json:"name"`
+	Limiter  *RateLimiter   `json:"-"`
+	Type     TransferType   `json:"type"`     // 任务中文件的传输类型，auto 时按扩展名逐个选择
+	Conflict ConflictPolicy `json:"conflict"` // 目标文件已存在时的处理方式
+
+	ask func(Conflict) (ConflictPolicy, error) // 策略为 ask 时询问用户，为 nil 时无法询问
+
+	progress *progressTracker
+}
+
+// transferRegistry 正在进行的传输任务
+type transferRegistry struct {
+	mu              sync.Mutex
+	jobs            map[string]*TransferJob
+	nextID          atomic.Uint64
+	defaultRate     atomic.Int64   // 新任务的默认限速
+	defaultType     TransferType   // 新任务的默认传输类型，由 mu 保护
+	defaultConflict ConflictPolicy // 新任务的默认冲突策略，由 mu 保护
+}
+
+var transfers = &transferRegistry{jobs: map[string]*TransferJob{}, defaultType: TransferBinary, defaultConflict: ConflictAsk}
+
+// NewTransferJob 创建并登记一个传输任务，任务结束后需要调用 Finish；
+// report 非空时定期收到任务进度
+func NewTransferJob(kind, name string, report func(TransferProgress)) *TransferJob {
+	job := &TransferJob{
+		ID:       fmt.Sprintf("%s-%d", kind, transfers.nextID.Add(1)),
+		Kind:     kind,
+		Name:     name,
+		Limiter:  NewRateLimiter(transfers.defaultRate.Load()),
+		progress: newProgressTracker(report),
+	}
+	transfers.mu.Lock()
+	job.Type = transfers.defaultType
+	job.Conflict = transfers.defaultConflict
+	transfers.jobs[job.ID] = job
+	transfers.mu.Unlock()
+	return job
+}
+
+// Finish 把任务从登记表中移除，并上报最终进度
+func (job *TransferJob) Finish(err error) {
+	transfers.mu.Lock()
+	delete(transfers.jobs, job.ID)
+	transfers.mu.Unlock()
+
+	final := job.Snapshot()
+	final.Done = true
+	final.ETA = 0
+	if err != nil {
+		final.Error = err.Error()
+	}
+	if job.progress.report != nil {
+		job.progress.report(final)
+	}
+}
+
+// TypeFor 返回任务中 name 的传输类型，没有任务时为二进制
+func (job *TransferJob) TypeFor(name string) TransferType {
+	if job == nil {
+		return TransferBinary
+	}
+	return job.Type.resolve(name)
+}
+
+// lookupTransfer 按 ID 查找正在进行的任务
+func lookupTransfer(id string) (*TransferJob, bool) {
+	transfers.mu.Lock()
+	defer transfers.mu.Unlock()
+	job, ok := transfers.jobs[id]
+	return job, ok
+}
+
+// RunJob 在 job 下执行 fn，期间建立的数据连接按 job 和全局限速
+func (ftp *FTPConn) RunJob(job *TransferJob, fn func() error) error {
+	prev := ftp.job
+	ftp.job = job
+	defer func() { ftp.job = prev }()
+	return fn()
+}
+
+// SetGlobalRateLimit 设置所有传输的总带宽上限 (字节/秒)，0 表示不限速，对进行中的传输立即生效
+func (a *App) SetGlobalRateLimit(bytesPerSec int64) {
+	GlobalLimiter.SetRate(bytesPerSec)
+	MyLogger.Info("global rate limit", "bytesPerSec", bytesPerSec)
+}
+
+// GlobalRateLimit 返回总带宽上限，0 表示不限速
+func (a *App) GlobalRateLimit() int64 {
+	return GlobalLimiter.Rate()
+}
+
+// SetDefaultTransferRateLimit 设置之后新建任务的默认限速 (字节/秒)
+func (a *App) SetDefaultTransferRateLimit(bytesPerSec int64) {
+	transfers.defaultRate.Store(bytesPerSec)
+}
+
+// SetTransferRateLimit 调整指定任务的限速 (字节/秒)，可以在传输过程中调用
+func (a *App) SetTransferRateLimit(jobID string, bytesPerSec int64) error {
+	job, ok := lookupTransfer(jobID)
+	if !ok {
+		return fmt.Errorf("transfer %s not found", jobID)
+	}
+	job.Limiter.SetRate(bytesPerSec)
+	return nil
+}
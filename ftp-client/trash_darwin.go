@@ -0,0 +1,17 @@
+package main
+
+import (
+	"fmt"
+	"os/exec"
+	"strings"
+)
+
+// moveToTrash 通过 Finder 删除，文件可以在废纸篓中“放回原处”
+func moveToTrash(path string) error {
+	quoted := strings.ReplaceAll(strings.ReplaceAll(path, `\`, `\\`), `"`, `\"`)
+	script := fmt.Sprintf(`tell application "Finder" to delete POSIX file "%s"`, quoted)
+	if out, err := exec.Command("osascript", "-e", script).CombinedOutput(); err != nil {
+		return fmt.Errorf("%v: %s", err, strings.TrimSpace(string(out)))
+	}
+	return nil
+}
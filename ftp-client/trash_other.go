@@ -0,0 +1,86 @@
+//go:build !darwin && !windows
+
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+)
+
+// trashDir 返回 freedesktop.org 规范中的用户回收站 ($XDG_DATA_HOME/Trash)
+func trashDir() (string, error) {
+	data := os.Getenv("XDG_DATA_HOME")
+	if data == "" {
+		home, err := os.UserHomeDir()
+		if err != nil {
+			return "", err
+		}
+		data = filepath.Join(home, ".local", "share")
+	}
+	return filepath.Join(data, "Trash"), nil
+}
+
+// moveToTrash 按 freedesktop.org Trash 规范把文件移到用户回收站，并写入 .trashinfo 以便文件管理器恢复；
+// 文件与回收站不在同一文件系统时交给 gio trash 处理
+func moveToTrash(path string) error {
+	trash, err := trashDir()
+	if err != nil {
+		return err
+	}
+	files := filepath.Join(trash, "files")
+	info := filepath.Join(trash, "info")
+	if err := os.MkdirAll(files, 0700); err != nil {
+		return err
+	}
+	if err := os.MkdirAll(info, 0700); err != nil {
+		return err
+	}
+
+	// 选一个回收站中未使用的名称，.trashinfo 以 O_EXCL 创建来占位
+	base := filepath.Base(path)
+	var name string
+	var infoFile *os.File
+	for i := 1; ; i++ {
+		name = base
+		if i > 1 {
+			ext := filepath.Ext(base)
+			name = strings.TrimSuffix(base, ext) + "." + strconv.Itoa(i) + ext
+		}
+		infoFile, err = os.OpenFile(filepath.Join(info, name+".trashinfo"), os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0600)
+		if err == nil {
+			break
+		}
+		if !os.IsExist(err) {
+			return err
+		}
+	}
+	escaped := (&url.URL{Path: path}).EscapedPath()
+	_, err = fmt.Fprintf(infoFile, "[Trash Info]\nPath=%s\nDeletionDate=%s\n", escaped, time.Now().Format("2006-01-02T15:04:05"))
+	infoFile.Close()
+	if err != nil {
+		os.Remove(infoFile.Name())
+		return err
+	}
+
+	err = os.Rename(path, filepath.Join(files, name))
+	if err == nil {
+		return nil
+	}
+	os.Remove(infoFile.Name())
+	if !errors.Is(err, syscall.EXDEV) {
+		return err
+	}
+	out, err := exec.Command("gio", "trash", path).CombinedOutput()
+	if err != nil {
+		return fmt.Errorf("文件不在主目录所在的文件系统上，gio trash 失败: %v: %s", err, strings.TrimSpace(string(out)))
+	}
+	return nil
+}
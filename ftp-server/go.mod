@@ -0,0 +1,3 @@
+module ftp-server
+
+go 1.21
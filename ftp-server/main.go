@@ -0,0 +1,195 @@
+// ftp-server 用于测试客户端的 FTP 服务器，替代原来基于 pyftpdlib 的 main.py。
+//
+// 用户、目录和日志格式与 main.py 相同：
+//
+//	rw        密码 123          ./date_rw         elradfmw
+//	readonly  密码 password123  ./date_r          elr
+//	anonymous 任意密码          ./date_anonymous  elr
+package main
+
+import (
+	"crypto/tls"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"os/signal"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"ftp-server/server"
+)
+
+// 用户权限配置
+const (
+	defaultDateReadwrite = "./date_rw"
+	defaultDateReadonly  = "./date_r"
+	defaultDateAnonymous = "./date_anonymous"
+)
+
+// ensureDirectoryExists 检查文件夹是否存在，如果不存在则创建它
+func ensureDirectoryExists(directoryPath string) error {
+	if _, err := os.Stat(directoryPath); err == nil {
+		fmt.Printf("文件夹 %s 已存在\n", directoryPath)
+		return nil
+	}
+	if err := os.MkdirAll(directoryPath, 0755); err != nil {
+		return err
+	}
+	fmt.Printf("文件夹 %s 已创建\n", directoryPath)
+	return nil
+}
+
+func setupUsers() ([]server.User, error) {
+	// 文件夹不存在则创建
+	for _, dir := range []string{defaultDateReadwrite, defaultDateReadonly, defaultDateAnonymous} {
+		if err := ensureDirectoryExists(dir); err != nil {
+			return nil, err
+		}
+	}
+	return []server.User{
+		{Name: "rw", Password: "123", Home: defaultDateReadwrite, Perm: "elradfmw"},
+		{Name: "readonly", Password: "password123", Home: defaultDateReadonly, Perm: "elr"},
+		{Name: "anonymous", Home: defaultDateAnonymous, Perm: "elr"}, // 匿名用户
+	}, nil
+}
+
+// logger 按 Python logging 的 "%(asctime)s - %(levelname)s - %(message)s" 格式写日志，
+// 与原来的 ftp_server.log 保持一致
+type logger struct {
+	mu     sync.Mutex
+	w      io.Writer
+	debug  bool
+	prefix string // 启用 TLS 时为 "TLS "，与 main.py 的 TLS 处理器一致
+}
+
+func (l *logger) log(level, format string, args ...any) {
+	if level == "DEBUG" && !l.debug {
+		return
+	}
+	now := time.Now()
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	fmt.Fprintf(l.w, "%s,%03d - %s - %s\n", now.Format("2006-01-02 15:04:05"), now.Nanosecond()/1e6, level, fmt.Sprintf(format, args...))
+}
+
+// onEvent 记录连接、登录和文件传输事件
+func (l *logger) onEvent(e server.Event) {
+	prefix := l.prefix
+	switch e.Type {
+	case server.EventConnect:
+		l.log("INFO", "%sClient connected: %s", prefix, e.Remote)
+	case server.EventDisconnect:
+		l.log("INFO", "%sClient disconnected: %s", prefix, e.Remote)
+	case server.EventLogin:
+		l.log("INFO", "%sUser logged in: %s", prefix, e.User)
+	case server.EventLoginFailed:
+		l.log("INFO", "%s-[%s] USER '%s' failed login.", e.Remote, e.User, e.User)
+	case server.EventLogout:
+		l.log("INFO", "%sUser logged out: %s", prefix, e.User)
+	case server.EventFileSent:
+		l.log("INFO", "%sFile sent: %s", prefix, e.Path)
+	case server.EventFileReceived:
+		l.log("INFO", "%sFile received: %s", prefix, e.Path)
+	case server.EventIncompleteFileSent:
+		l.log("WARNING", "%sIncomplete file sent: %s", prefix, e.Path)
+	case server.EventIncompleteFileReceived:
+		l.log("WARNING", "%sIncomplete file received: %s", prefix, e.Path)
+	}
+}
+
+// trace 以 DEBUG 级别记录协议交互
+func (l *logger) trace(c server.ClientInfo, sent bool, line string) {
+	arrow := "<-"
+	if sent {
+		arrow = "->"
+	}
+	l.log("DEBUG", "%s-[%s] %s %s", c.Remote, c.User, arrow, line)
+}
+
+// parsePortRange 解析 60000-65535 形式的端口范围
+func parsePortRange(s string) ([2]int, error) {
+	lo, hi, ok := strings.Cut(s, "-")
+	if !ok {
+		return [2]int{}, fmt.Errorf("无效的端口范围: %s", s)
+	}
+	var ports [2]int
+	for i, v := range []string{lo, hi} {
+		n, err := strconv.Atoi(strings.TrimSpace(v))
+		if err != nil {
+			return [2]int{}, fmt.Errorf("无效的端口范围: %s", s)
+		}
+		ports[i] = n
+	}
+	return ports, nil
+}
+
+func main() {
+	addr := flag.String("addr", "0.0.0.0:2121", "监听地址")
+	passivePorts := flag.String("passive-ports", "60000-65535", "被动模式端口范围")
+	masquerade := flag.String("masquerade", "", "PASV 响应中使用的外部 IP，用于 NAT 之后的服务器")
+	useTLS := flag.Bool("tls", false, "启用 AUTH TLS")
+	certFile := flag.String("cert", "cert.pem", "TLS 证书路径")
+	keyFile := flag.String("key", "key.pem", "TLS 密钥路径")
+	logFile := flag.String("log", "ftp_server.log", "日志文件")
+	debug := flag.Bool("debug", true, "在日志中记录协议交互")
+	flag.Parse()
+
+	users, err := setupUsers()
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	// 日志配置
+	f, err := os.OpenFile(*logFile, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer f.Close()
+	l := &logger{w: f, debug: *debug}
+
+	ports, err := parsePortRange(*passivePorts)
+	if err != nil {
+		log.Fatal(err)
+	}
+	config := server.Config{
+		Users:             users,
+		Banner:            "Welcome to the secure FTP server!", // 欢迎消息
+		PassivePorts:      ports,
+		MasqueradeAddress: *masquerade,
+		MaxConns:          256, // 最大连接数
+		MaxConnsPerIP:     5,   // 每IP最大连接数
+		OnEvent:           l.onEvent,
+		Trace:             l.trace,
+	}
+	if *useTLS {
+		cert, err := tls.LoadX509KeyPair(*certFile, *keyFile)
+		if err != nil {
+			log.Fatalf("加载TLS证书失败: %v", err)
+		}
+		config.TLSConfig = &tls.Config{Certificates: []tls.Certificate{cert}}
+		l.prefix = "TLS "
+	}
+
+	srv, err := server.New(config)
+	if err != nil {
+		log.Fatal(err)
+	}
+	go func() {
+		sig := make(chan os.Signal, 1)
+		signal.Notify(sig, os.Interrupt, syscall.SIGTERM)
+		<-sig
+		srv.Close()
+	}()
+
+	l.log("INFO", "Starting FTP server...")
+	fmt.Println("Starting FTP server...")
+	if err := srv.ListenAndServe(*addr); err != nil && err != server.ErrServerClosed {
+		log.Fatal(err)
+	}
+	l.log("INFO", "FTP server stopped.")
+}
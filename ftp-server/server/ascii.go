@@ -0,0 +1,60 @@
+package server
+
+import "io"
+
+// crlfWriter TYPE A 下载时把本地文件的 LF 转换为 CRLF，已经是 CRLF 的换行不变
+type crlfWriter struct {
+	w    io.Writer
+	prev byte
+	buf  []byte
+}
+
+func (c *crlfWriter) Write(p []byte) (int, error) {
+	c.buf = c.buf[:0]
+	for _, b := range p {
+		if b == '\n' && c.prev != '\r' {
+			c.buf = append(c.buf, '\r')
+		}
+		c.buf = append(c.buf, b)
+		c.prev = b
+	}
+	if _, err := c.w.Write(c.buf); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
+
+// lfWriter TYPE A 上传时把 CRLF 转换为 LF 写入本地文件。
+// 数据块以 CR 结尾时暂存，由下一块或 Flush 决定是否写出
+type lfWriter struct {
+	w   io.Writer
+	cr  bool
+	buf []byte
+}
+
+func (l *lfWriter) Write(p []byte) (int, error) {
+	l.buf = l.buf[:0]
+	for _, b := range p {
+		if l.cr && b != '\n' {
+			l.buf = append(l.buf, '\r')
+		}
+		l.cr = b == '\r'
+		if !l.cr {
+			l.buf = append(l.buf, b)
+		}
+	}
+	if _, err := l.w.Write(l.buf); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
+
+// Flush 写出末尾暂存的 CR
+func (l *lfWriter) Flush() error {
+	if !l.cr {
+		return nil
+	}
+	l.cr = false
+	_, err := l.w.Write([]byte{'\r'})
+	return err
+}
@@ -0,0 +1,28 @@
+package server
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestLineEndingWriters(t *testing.T) {
+	// 换行的 CR 和 LF 分在两次写入中
+	var lf bytes.Buffer
+	w := &lfWriter{w: &lf}
+	for _, chunk := range []string{"a\r", "\nb\r", "c\r"} {
+		w.Write([]byte(chunk))
+	}
+	w.Flush()
+	if lf.String() != "a\nb\rc\r" {
+		t.Errorf("lfWriter wrote %q", lf.String())
+	}
+
+	var crlf bytes.Buffer
+	cw := &crlfWriter{w: &crlf}
+	for _, chunk := range []string{"a\r", "\nb\n", "\n"} {
+		cw.Write([]byte(chunk))
+	}
+	if crlf.String() != "a\r\nb\r\n\r\n" {
+		t.Errorf("crlfWriter wrote %q", crlf.String())
+	}
+}
@@ -0,0 +1,79 @@
+package server
+
+import (
+	"bufio"
+	"compress/zlib"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+)
+
+// parseModeZLevel 解析 OPTS MODE Z LEVEL n 的参数，返回 1-9 的压缩级别
+func parseModeZLevel(value string) (int, error) {
+	fields := strings.Fields(value)
+	if len(fields) != 3 || fields[0] != "Z" || fields[1] != "LEVEL" {
+		return 0, fmt.Errorf("无效的 MODE Z 选项: %q", value)
+	}
+	level, err := strconv.Atoi(fields[2])
+	if err != nil || level < 1 || level > 9 {
+		return 0, fmt.Errorf("无效的压缩级别: %q", fields[2])
+	}
+	return level, nil
+}
+
+// zlibConn MODE Z 的数据连接，读取时解压，写入时压缩
+type zlibConn struct {
+	net.Conn
+	r io.ReadCloser
+	w *zlib.Writer
+}
+
+// newZlibConn 包装数据连接。发送时总是写出完整的压缩流，
+// 即使没有内容；level 为 0 时使用默认压缩级别
+func newZlibConn(conn net.Conn, send bool, level int) net.Conn {
+	z := &zlibConn{Conn: conn}
+	if send {
+		if level == 0 {
+			level = zlib.DefaultCompression
+		}
+		z.w, _ = zlib.NewWriterLevel(conn, level)
+	}
+	return z
+}
+
+func (z *zlibConn) Read(p []byte) (int, error) {
+	if z.r == nil {
+		// 客户端上传空文件时可能不发送任何数据
+		br := bufio.NewReader(z.Conn)
+		if _, err := br.Peek(1); err != nil {
+			return 0, err
+		}
+		r, err := zlib.NewReader(br)
+		if err != nil {
+			return 0, err
+		}
+		z.r = r
+	}
+	return z.r.Read(p)
+}
+
+func (z *zlibConn) Write(p []byte) (int, error) {
+	return z.w.Write(p)
+}
+
+// Close 写出压缩流的结尾后关闭连接
+func (z *zlibConn) Close() error {
+	var err error
+	if z.w != nil {
+		err = z.w.Close()
+	}
+	if z.r != nil {
+		z.r.Close()
+	}
+	if closeErr := z.Conn.Close(); err == nil {
+		err = closeErr
+	}
+	return err
+}
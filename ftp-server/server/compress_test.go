@@ -0,0 +1,64 @@
+package server
+
+import (
+	"bytes"
+	"compress/zlib"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestParseModeZLevel(t *testing.T) {
+	if level, err := parseModeZLevel("Z LEVEL 6"); err != nil || level != 6 {
+		t.Errorf("parseModeZLevel(Z LEVEL 6) = %d, %v", level, err)
+	}
+	for _, value := range []string{"", "Z", "Z LEVEL", "Z LEVEL 0", "Z LEVEL 10", "Z LEVEL x", "Y LEVEL 6", "Z LEVEL 6 7"} {
+		if _, err := parseModeZLevel(value); err == nil {
+			t.Errorf("parseModeZLevel(%q) succeeded", value)
+		}
+	}
+}
+
+func TestModeZ(t *testing.T) {
+	home := t.TempDir()
+	addr := startServer(t, User{Name: "rw", Password: "123", Home: home, Perm: "elradfmw"})
+	c := dial(t, addr, "rw", "123")
+	if msg := c.expect(211, "FEAT"); !strings.Contains(msg, "MODE Z") {
+		t.Fatalf("FEAT does not list MODE Z: %s", msg)
+	}
+	c.expect(501, "OPTS MODE Z LEVEL 10")
+	c.expect(200, "OPTS MODE Z LEVEL 9")
+	c.expect(504, "MODE B")
+	c.expect(200, "MODE Z")
+	c.expect(200, "TYPE I")
+
+	payload := bytes.Repeat([]byte("compressed line\n"), 1000)
+	var compressed bytes.Buffer
+	w := zlib.NewWriter(&compressed)
+	w.Write(payload)
+	w.Close()
+	c.transfer(compressed.Bytes(), "STOR z.txt")
+	if data, _ := os.ReadFile(filepath.Join(home, "z.txt")); !bytes.Equal(data, payload) {
+		t.Fatalf("stored %d bytes", len(data))
+	}
+	// 上传空文件时客户端可以不发送任何数据
+	c.transfer([]byte{}, "STOR empty.txt")
+	if info, err := os.Stat(filepath.Join(home, "empty.txt")); err != nil || info.Size() != 0 {
+		t.Fatalf("empty upload: %v, %v", info, err)
+	}
+
+	r, err := zlib.NewReader(bytes.NewReader(c.transfer(nil, "RETR z.txt")))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if data, _ := io.ReadAll(r); !bytes.Equal(data, payload) {
+		t.Fatalf("retrieved %d bytes", len(data))
+	}
+
+	c.expect(200, "MODE S")
+	if data := c.transfer(nil, "RETR z.txt"); !bytes.Equal(data, payload) {
+		t.Fatalf("MODE S retrieved %d bytes", len(data))
+	}
+}
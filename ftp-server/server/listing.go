@@ -0,0 +1,186 @@
+package server
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// timeFormat MDTM、MFMT 和 MLSD 使用的时间格式，UTC
+const timeFormat = "20060102150405"
+
+// errOutsideHome 路径经过符号链接指向用户根目录之外
+var errOutsideHome = errors.New("路径在用户目录之外")
+
+// virtualPath 把命令参数转换为以 / 开头的虚拟路径，/ 对应用户的根目录
+func (c *session) virtualPath(arg string) string {
+	if !strings.HasPrefix(arg, "/") {
+		arg = path.Join(c.cwd, arg)
+	}
+	return path.Clean("/" + arg)
+}
+
+// localPath 返回虚拟路径对应的本地路径。从最近的已存在的上级开始解析符号链接，
+// 结果不在用户根目录内时返回 errOutsideHome
+func (c *session) localPath(vpath string) (string, error) {
+	local := filepath.Join(c.user.Home, filepath.FromSlash(vpath))
+	for p := local; ; {
+		real, err := filepath.EvalSymlinks(p)
+		if err == nil {
+			if !within(c.user.real, real) {
+				return "", errOutsideHome
+			}
+			break
+		}
+		if !errors.Is(err, fs.ErrNotExist) {
+			return "", err
+		}
+		// 目标不存在的符号链接：写入时会在链接的目标处创建文件，继续检查目标
+		if info, err := os.Lstat(p); err == nil && info.Mode()&os.ModeSymlink != 0 {
+			target, err := os.Readlink(p)
+			if err != nil {
+				return "", err
+			}
+			if !filepath.IsAbs(target) {
+				target = filepath.Join(filepath.Dir(p), target)
+			}
+			p = target
+			continue
+		}
+		parent := filepath.Dir(p)
+		if parent == p {
+			break
+		}
+		p = parent
+	}
+	return local, nil
+}
+
+// within 判断 p 是否是 root 或 root 下的路径
+func within(root, p string) bool {
+	if p == root {
+		return true
+	}
+	if !strings.HasSuffix(root, string(filepath.Separator)) {
+		root += string(filepath.Separator)
+	}
+	return strings.HasPrefix(p, root)
+}
+
+// listing 列出参数指定的目录，参数是文件时只列出这个文件。符号链接显示为目标的信息
+func (c *session) listing(arg string, format func(name string, info os.FileInfo, perm string) string) ([]string, error) {
+	vpath := c.virtualPath(arg)
+	local, err := c.localPath(vpath)
+	if err != nil {
+		return nil, err
+	}
+	info, err := os.Stat(local)
+	if err != nil {
+		return nil, err
+	}
+	if !info.IsDir() {
+		return []string{format(path.Base(vpath), info, c.user.Perm)}, nil
+	}
+	entries, err := os.ReadDir(local)
+	if err != nil {
+		return nil, err
+	}
+	lines := make([]string, 0, len(entries))
+	for _, e := range entries {
+		fi, err := os.Stat(filepath.Join(local, e.Name()))
+		if err != nil {
+			// 失效的符号链接
+			if fi, err = e.Info(); err != nil {
+				continue
+			}
+		}
+		lines = append(lines, format(e.Name(), fi, c.user.Perm))
+	}
+	return lines, nil
+}
+
+// listLine 生成 ls -l 格式的一行，与 pyftpdlib 一样使用 UTC 时间
+func listLine(name string, info os.FileInfo, _ string) string {
+	mtime := info.ModTime().UTC()
+	layout := "Jan 02 15:04"
+	if time.Since(mtime) > 180*24*time.Hour || time.Until(mtime) > 24*time.Hour {
+		layout = "Jan 02  2006"
+	}
+	nlink := 1
+	if info.IsDir() {
+		nlink = 2
+	}
+	return fmt.Sprintf("%s %3d %-8s %-8s %8d %s %s", lsMode(info.Mode()), nlink, "owner", "group", info.Size(), mtime.Format(layout), name)
+}
+
+// lsMode 返回 ls -l 形式的权限字符串，例如 drwxr-xr-x
+func lsMode(mode os.FileMode) string {
+	b := []byte("----------")
+	switch {
+	case mode.IsDir():
+		b[0] = 'd'
+	case mode&os.ModeSymlink != 0:
+		b[0] = 'l'
+	}
+	const rwx = "rwxrwxrwx"
+	for i := 0; i < 9; i++ {
+		if mode&(1<<uint(8-i)) != 0 {
+			b[i+1] = rwx[i]
+		}
+	}
+	special := func(i int, set bool, c byte) {
+		if !set {
+			return
+		}
+		if b[i] == 'x' {
+			b[i] = c
+		} else {
+			b[i] = c - 'a' + 'A'
+		}
+	}
+	special(3, mode&os.ModeSetuid != 0, 's')
+	special(6, mode&os.ModeSetgid != 0, 's')
+	special(9, mode&os.ModeSticky != 0, 't')
+	return string(b)
+}
+
+// mlsxLine 生成 MLSD/MLST 的一行，perm 事实由用户权限得出 (RFC 3659 7.5.5)
+func mlsxLine(name string, info os.FileInfo, perm string) string {
+	has := func(c byte) bool { return strings.IndexByte(perm, c) >= 0 }
+	var facts, allowed strings.Builder
+	add := func(cond bool, c byte) {
+		if cond {
+			allowed.WriteByte(c)
+		}
+	}
+	if info.IsDir() {
+		facts.WriteString("type=dir;")
+		add(has('e'), 'e')
+		add(has('l'), 'l')
+		add(has('w'), 'c')
+		add(has('m'), 'm')
+		add(has('d'), 'd')
+		add(has('f'), 'f')
+		add(has('d'), 'p')
+	} else {
+		facts.WriteString("type=file;")
+		fmt.Fprintf(&facts, "size=%d;", info.Size())
+		add(has('r'), 'r')
+		add(has('a'), 'a')
+		add(has('w'), 'w')
+		add(has('d'), 'd')
+		add(has('f'), 'f')
+	}
+	fmt.Fprintf(&facts, "modify=%s;perm=%s;unix.mode=0%o; %s", info.ModTime().UTC().Format(timeFormat), allowed.String(), info.Mode().Perm(), name)
+	return facts.String()
+}
+
+// quote 按 RFC 959 给路径加引号，路径中的引号写两次
+func quote(p string) string {
+	return `"` + strings.ReplaceAll(p, `"`, `""`) + `"`
+}
@@ -0,0 +1,105 @@
+package server
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestWithin(t *testing.T) {
+	tests := []struct {
+		root, p string
+		want    bool
+	}{
+		{"/srv/ftp", "/srv/ftp", true},
+		{"/srv/ftp", "/srv/ftp/a/b.txt", true},
+		{"/srv/ftp/", "/srv/ftp/a", true},
+		{"/srv/ftp", "/srv/ftp2", false},
+		{"/srv/ftp", "/srv/ftp2/a", false},
+		{"/srv/ftp", "/srv", false},
+		{"/", "/etc/passwd", true},
+	}
+	for _, tt := range tests {
+		if got := within(filepath.FromSlash(tt.root), filepath.FromSlash(tt.p)); got != tt.want {
+			t.Errorf("within(%q, %q) = %v, want %v", tt.root, tt.p, got, tt.want)
+		}
+	}
+}
+
+func TestLocalPath(t *testing.T) {
+	base := t.TempDir()
+	home := filepath.Join(base, "home")
+	outside := filepath.Join(base, "outside")
+	for _, dir := range []string{filepath.Join(home, "docs"), outside, home + "2"} {
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	links := map[string]string{
+		"out":      outside,                     // 指向根目录之外
+		"sibling":  home + "2",                  // 前缀相同的相邻目录
+		"inside":   filepath.Join(home, "docs"), // 指向根目录之内
+		"dangling": filepath.Join(outside, "x"), // 目标不存在
+		"relative": "../outside/y",              // 相对路径的目标不存在
+		"pending":  "docs/new.txt",              // 目标不存在，但在根目录之内
+	}
+	for name, target := range links {
+		if err := os.Symlink(target, filepath.Join(home, name)); err != nil {
+			t.Skipf("symlinks are not supported: %v", err)
+		}
+	}
+	real, err := filepath.EvalSymlinks(home)
+	if err != nil {
+		t.Fatal(err)
+	}
+	c := &session{user: &account{User: User{Home: home}, real: real}}
+
+	for _, vpath := range []string{"/", "/docs", "/docs/new.txt", "/missing/a/b", "/inside/readme.txt", "/pending"} {
+		local, err := c.localPath(vpath)
+		if err != nil || local != filepath.Join(home, filepath.FromSlash(vpath)) {
+			t.Errorf("localPath(%q) = %q, %v", vpath, local, err)
+		}
+	}
+	for _, vpath := range []string{"/out", "/out/file.txt", "/out/new/dir", "/sibling/a", "/dangling", "/relative"} {
+		if _, err := c.localPath(vpath); !errors.Is(err, errOutsideHome) {
+			t.Errorf("localPath(%q) = %v, want errOutsideHome", vpath, err)
+		}
+	}
+}
+
+func TestVirtualPath(t *testing.T) {
+	c := &session{cwd: "/docs"}
+	tests := map[string]string{
+		"":             "/docs",
+		"a.txt":        "/docs/a.txt",
+		"/a.txt":       "/a.txt",
+		"../../../etc": "/etc",
+		"/../..":       "/",
+		"sub/./../b":   "/docs/b",
+	}
+	for arg, want := range tests {
+		if got := c.virtualPath(arg); got != want {
+			t.Errorf("virtualPath(%q) = %q, want %q", arg, got, want)
+		}
+	}
+}
+
+func TestLsMode(t *testing.T) {
+	tests := []struct {
+		mode os.FileMode
+		want string
+	}{
+		{0644, "-rw-r--r--"},
+		{os.ModeDir | 0755, "drwxr-xr-x"},
+		{os.ModeSymlink | 0777, "lrwxrwxrwx"},
+		{os.ModeSetuid | 0755, "-rwsr-xr-x"},
+		{os.ModeSetgid | 0644, "-rw-r-Sr--"},
+		{os.ModeDir | os.ModeSticky | 0777, "drwxrwxrwt"},
+	}
+	for _, tt := range tests {
+		if got := lsMode(tt.mode); got != tt.want {
+			t.Errorf("lsMode(%v) = %q, want %q", tt.mode, got, tt.want)
+		}
+	}
+}
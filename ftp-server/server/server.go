@@ -0,0 +1,325 @@
+// Package server 实现 FTP 服务器，供独立的 ftp-server 程序和桌面端的共享文件夹功能使用。
+//
+// 用户权限沿用 pyftpdlib 的字母表示：
+//
+//	e  切换目录 (CWD, CDUP)
+//	l  列出文件 (LIST, NLST, MLSD, MLST, SIZE, MDTM, STAT)
+//	r  下载文件 (RETR)
+//	a  追加写入 (APPE)
+//	d  删除文件或目录 (DELE, RMD)
+//	f  重命名 (RNFR, RNTO)
+//	m  创建目录 (MKD)
+//	w  上传文件 (STOR, STOU)
+//	M  修改权限 (SITE CHMOD)
+//	T  修改时间 (MFMT)
+package server
+
+import (
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// 默认配置
+const (
+	DefaultBanner      = "FTP server ready."
+	DefaultIdleTimeout = 300 * time.Second
+	dataTimeout        = 30 * time.Second
+)
+
+// ErrServerClosed Close 之后 Serve 返回的错误
+var ErrServerClosed = errors.New("ftp server closed")
+
+// User 可以登录的用户。名称为 anonymous 的用户接受任意密码
+type User struct {
+	Name     string
+	Password string
+	Home     string // 用户的根目录，登录后不能访问其外的文件
+	Perm     string // 权限字母，例如 "elr" (只读) 或 "elradfmw" (读写)
+}
+
+// Config 服务器配置
+type Config struct {
+	Users  []User
+	Banner string // 连接时的欢迎信息
+
+	// PassivePorts PASV/EPSV 使用的端口范围 [最小, 最大]，为零时由系统分配
+	PassivePorts [2]int
+	// MasqueradeAddress 非空时 PASV 响应中使用这个 IP，用于 NAT 之后的服务器
+	MasqueradeAddress string
+	// AllowForeignAddresses 允许数据连接来自或连接到与控制连接不同的地址 (FXP)
+	AllowForeignAddresses bool
+
+	MaxConns      int           // 最大连接数，0 表示不限
+	MaxConnsPerIP int           // 每个 IP 的最大连接数，0 表示不限
+	IdleTimeout   time.Duration // 控制连接空闲多久后断开，0 表示默认值
+
+	// TLSConfig 非空时支持 AUTH TLS (显式 FTPS)
+	TLSConfig *tls.Config
+
+	// OnEvent 在连接、登录、传输等事件发生时调用，可能被多个连接并发调用
+	OnEvent func(Event)
+	// Trace 非空时接收每一行协议交互，sent 为 true 表示服务器发出的响应
+	Trace func(c ClientInfo, sent bool, line string)
+}
+
+// 事件类型
+const (
+	EventConnect                = "connect"
+	EventDisconnect             = "disconnect"
+	EventLogin                  = "login"
+	EventLoginFailed            = "login-failed"
+	EventLogout                 = "logout"
+	EventTransferStart          = "transfer-start"
+	EventFileSent               = "file-sent"
+	EventFileReceived           = "file-received"
+	EventIncompleteFileSent     = "incomplete-file-sent"
+	EventIncompleteFileReceived = "incomplete-file-received"
+)
+
+// Event 服务器事件
+type Event struct {
+	Type      string    `json:"type"`
+	ClientID  uint64    `json:"clientId"`
+	Remote    string    `json:"remote"` // 客户端地址 ip:port
+	User      string    `json:"user,omitempty"`
+	Path      string    `json:"path,omitempty"`      // 传输文件的本地路径
+	Direction string    `json:"direction,omitempty"` // 传输方向: send (下载) 或 receive (上传)
+	Bytes     int64     `json:"bytes,omitempty"`
+	Error     string    `json:"error,omitempty"`
+	Time      time.Time `json:"time"`
+}
+
+// TransferInfo 正在进行的传输
+type TransferInfo struct {
+	Direction string    `json:"direction"`
+	Path      string    `json:"path"`
+	Bytes     int64     `json:"bytes"`
+	Started   time.Time `json:"started"`
+}
+
+// ClientInfo 已连接的客户端
+type ClientInfo struct {
+	ID        uint64        `json:"id"`
+	Remote    string        `json:"remote"`
+	User      string        `json:"user,omitempty"`
+	Connected time.Time     `json:"connected"`
+	Transfer  *TransferInfo `json:"transfer,omitempty"`
+}
+
+// Server FTP 服务器
+type Server struct {
+	config Config
+	users  map[string]account
+
+	mu       sync.Mutex
+	listener net.Listener
+	sessions map[uint64]*session
+	perIP    map[string]int
+	closed   bool
+	wg       sync.WaitGroup
+	nextID   atomic.Uint64
+}
+
+// New 检查配置并创建服务器，用户的根目录必须已经存在
+func New(config Config) (*Server, error) {
+	if config.Banner == "" {
+		config.Banner = DefaultBanner
+	}
+	if config.IdleTimeout == 0 {
+		config.IdleTimeout = DefaultIdleTimeout
+	}
+	if p := config.PassivePorts; p != [2]int{} && (p[0] <= 0 || p[1] > 65535 || p[0] > p[1]) {
+		return nil, fmt.Errorf("无效的被动模式端口范围: %d-%d", p[0], p[1])
+	}
+	users := map[string]account{}
+	for _, u := range config.Users {
+		if u.Name == "" {
+			return nil, errors.New("用户名不能为空")
+		}
+		home, err := filepath.Abs(u.Home)
+		if err != nil {
+			return nil, err
+		}
+		if info, err := os.Stat(home); err != nil || !info.IsDir() {
+			return nil, fmt.Errorf("用户 %s 的目录不存在: %s", u.Name, u.Home)
+		}
+		if i := strings.IndexFunc(u.Perm, func(r rune) bool { return !strings.ContainsRune("elradfmwMT", r) }); i >= 0 {
+			return nil, fmt.Errorf("用户 %s 的权限无效: %q", u.Name, u.Perm[i])
+		}
+		real, err := filepath.EvalSymlinks(home)
+		if err != nil {
+			return nil, err
+		}
+		u.Home = home
+		users[u.Name] = account{User: u, real: real}
+	}
+	return &Server{
+		config:   config,
+		users:    users,
+		sessions: map[uint64]*session{},
+		perIP:    map[string]int{},
+	}, nil
+}
+
+// ListenAndServe 监听 addr (例如 0.0.0.0:2121) 并处理连接，直到 Close
+func (s *Server) ListenAndServe(addr string) error {
+	l, err := net.Listen("tcp", addr)
+	if err != nil {
+		return err
+	}
+	return s.Serve(l)
+}
+
+// Serve 在 l 上接受连接，直到 Close；返回时 l 已关闭
+func (s *Server) Serve(l net.Listener) error {
+	s.mu.Lock()
+	if s.closed {
+		s.mu.Unlock()
+		l.Close()
+		return ErrServerClosed
+	}
+	s.listener = l
+	s.mu.Unlock()
+
+	for {
+		conn, err := l.Accept()
+		if err != nil {
+			s.mu.Lock()
+			closed := s.closed
+			s.mu.Unlock()
+			if closed {
+				return ErrServerClosed
+			}
+			var ne net.Error
+			if errors.As(err, &ne) && ne.Timeout() {
+				time.Sleep(50 * time.Millisecond)
+				continue
+			}
+			return err
+		}
+		s.accept(conn)
+	}
+}
+
+// Addr 返回监听地址，Serve 之前为 nil
+func (s *Server) Addr() net.Addr {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.listener == nil {
+		return nil
+	}
+	return s.listener.Addr()
+}
+
+// Close 停止监听并断开所有客户端，等待连接处理结束
+func (s *Server) Close() error {
+	s.mu.Lock()
+	if s.closed {
+		s.mu.Unlock()
+		return nil
+	}
+	s.closed = true
+	var err error
+	if s.listener != nil {
+		err = s.listener.Close()
+	}
+	for _, sess := range s.sessions {
+		sess.conn.Close()
+	}
+	s.mu.Unlock()
+	s.wg.Wait()
+	return err
+}
+
+// Clients 返回已连接的客户端，按连接顺序
+func (s *Server) Clients() []ClientInfo {
+	s.mu.Lock()
+	sessions := make([]*session, 0, len(s.sessions))
+	for _, sess := range s.sessions {
+		sessions = append(sessions, sess)
+	}
+	s.mu.Unlock()
+	clients := make([]ClientInfo, 0, len(sessions))
+	for _, sess := range sessions {
+		clients = append(clients, sess.info())
+	}
+	sort.Slice(clients, func(i, j int) bool { return clients[i].ID < clients[j].ID })
+	return clients
+}
+
+// Disconnect 断开指定的客户端
+func (s *Server) Disconnect(id uint64) error {
+	s.mu.Lock()
+	sess, ok := s.sessions[id]
+	s.mu.Unlock()
+	if !ok {
+		return fmt.Errorf("client %d not found", id)
+	}
+	return sess.conn.Close()
+}
+
+// accept 检查连接数限制并开始处理连接
+func (s *Server) accept(conn net.Conn) {
+	ip, _, _ := net.SplitHostPort(conn.RemoteAddr().String())
+	s.mu.Lock()
+	if (s.config.MaxConns > 0 && len(s.sessions) >= s.config.MaxConns) ||
+		(s.config.MaxConnsPerIP > 0 && s.perIP[ip] >= s.config.MaxConnsPerIP) {
+		s.mu.Unlock()
+		conn.SetWriteDeadline(time.Now().Add(time.Second))
+		fmt.Fprintf(conn, "421 Too many connections. Service temporarily unavailable.\r\n")
+		conn.Close()
+		return
+	}
+	sess := newSession(s, s.nextID.Add(1), conn)
+	s.sessions[sess.id] = sess
+	s.perIP[ip]++
+	s.wg.Add(1)
+	s.mu.Unlock()
+
+	go func() {
+		defer s.wg.Done()
+		sess.serve()
+		s.mu.Lock()
+		delete(s.sessions, sess.id)
+		if s.perIP[ip]--; s.perIP[ip] <= 0 {
+			delete(s.perIP, ip)
+		}
+		s.mu.Unlock()
+	}()
+}
+
+// emit 发送事件
+func (s *Server) emit(e Event) {
+	if s.config.OnEvent == nil {
+		return
+	}
+	e.Time = time.Now()
+	s.config.OnEvent(e)
+}
+
+// listenPassive 在配置的端口范围内打开数据端口，从随机位置开始尝试
+func (s *Server) listenPassive(ip string) (net.Listener, error) {
+	p := s.config.PassivePorts
+	if p == [2]int{} {
+		return net.Listen("tcp", net.JoinHostPort(ip, "0"))
+	}
+	n := p[1] - p[0] + 1
+	start := int(time.Now().UnixNano() % int64(n))
+	for i := 0; i < n; i++ {
+		port := p[0] + (start+i)%n
+		l, err := net.Listen("tcp", net.JoinHostPort(ip, fmt.Sprint(port)))
+		if err == nil {
+			return l, nil
+		}
+	}
+	return nil, fmt.Errorf("被动模式端口 %d-%d 已全部占用", p[0], p[1])
+}
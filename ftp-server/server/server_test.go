@@ -0,0 +1,222 @@
+package server
+
+import (
+	"fmt"
+	"io"
+	"net"
+	"net/textproto"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// startServer 在随机端口上启动服务器，返回监听地址
+func startServer(t *testing.T, users ...User) string {
+	t.Helper()
+	srv, err := New(Config{Users: users})
+	if err != nil {
+		t.Fatal(err)
+	}
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	go srv.Serve(l)
+	t.Cleanup(func() { srv.Close() })
+	return l.Addr().String()
+}
+
+// testClient 用于测试的最简单的 FTP 客户端
+type testClient struct {
+	t    *testing.T
+	host string
+	*textproto.Conn
+}
+
+// dial 连接服务器并用 user 登录，password 错误时返回 nil
+func dial(t *testing.T, addr, user, password string) *testClient {
+	t.Helper()
+	conn, err := textproto.Dial("tcp", addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	host, _, _ := net.SplitHostPort(addr)
+	c := &testClient{t: t, host: host, Conn: conn}
+	if _, _, err := conn.ReadResponse(220); err != nil {
+		t.Fatal(err)
+	}
+	c.expect(331, "USER %s", user)
+	if code, _ := c.cmd("PASS %s", password); code != 230 {
+		return nil
+	}
+	return c
+}
+
+// cmd 发送命令并返回响应
+func (c *testClient) cmd(format string, args ...any) (int, string) {
+	c.t.Helper()
+	if err := c.PrintfLine(format, args...); err != nil {
+		c.t.Fatal(err)
+	}
+	code, msg, err := c.ReadResponse(0)
+	if err != nil {
+		c.t.Fatal(err)
+	}
+	return code, msg
+}
+
+// expect 发送命令，响应码不是 code 时测试失败
+func (c *testClient) expect(code int, format string, args ...any) string {
+	c.t.Helper()
+	got, msg := c.cmd(format, args...)
+	if got != code {
+		c.t.Fatalf("%s: got %d %s, want %d", fmt.Sprintf(format, args...), got, msg, code)
+	}
+	return msg
+}
+
+// transfer 通过 EPSV 打开数据连接执行命令，upload 非 nil 时发送它，否则返回收到的数据
+func (c *testClient) transfer(upload []byte, format string, args ...any) []byte {
+	c.t.Helper()
+	msg := c.expect(229, "EPSV")
+	var port int
+	if _, err := fmt.Sscanf(msg[strings.Index(msg, "(|||"):], "(|||%d|)", &port); err != nil {
+		c.t.Fatalf("EPSV reply %q: %v", msg, err)
+	}
+	data, err := net.Dial("tcp", net.JoinHostPort(c.host, fmt.Sprint(port)))
+	if err != nil {
+		c.t.Fatal(err)
+	}
+	c.expect(150, format, args...)
+	var received []byte
+	if upload != nil {
+		data.Write(upload)
+	} else {
+		received, _ = io.ReadAll(data)
+	}
+	data.Close()
+	if _, _, err := c.ReadResponse(226); err != nil {
+		c.t.Fatal(err)
+	}
+	return received
+}
+
+func TestPermissions(t *testing.T) {
+	rwHome, roHome, anonHome := t.TempDir(), t.TempDir(), t.TempDir()
+	for _, home := range []string{rwHome, roHome, anonHome} {
+		os.WriteFile(filepath.Join(home, "readme.txt"), []byte("hello"), 0644)
+	}
+	addr := startServer(t,
+		User{Name: "rw", Password: "123", Home: rwHome, Perm: "elradfmw"},
+		User{Name: "readonly", Password: "password123", Home: roHome, Perm: "elr"},
+		User{Name: "anonymous", Home: anonHome, Perm: "elr"},
+	)
+
+	if dial(t, addr, "rw", "wrong") != nil {
+		t.Fatal("login with a wrong password succeeded")
+	}
+	if dial(t, addr, "nobody", "123") != nil {
+		t.Fatal("login as an unknown user succeeded")
+	}
+
+	rw := dial(t, addr, "rw", "123")
+	rw.transfer([]byte("uploaded"), "STOR new.txt")
+	if data, _ := os.ReadFile(filepath.Join(rwHome, "new.txt")); string(data) != "uploaded" {
+		t.Fatalf("rw uploaded %q", data)
+	}
+	rw.expect(257, "MKD dir")
+	rw.expect(350, "RNFR new.txt")
+	rw.expect(250, "RNTO dir/new.txt")
+	rw.expect(250, "DELE dir/new.txt")
+	rw.expect(250, "RMD dir")
+	// rw 没有 M 权限
+	rw.expect(550, "SITE CHMOD 600 readme.txt")
+
+	// 只读用户和匿名用户可以浏览和下载，不能修改
+	for _, login := range [][2]string{{"readonly", "password123"}, {"anonymous", "guest@example.com"}} {
+		c := dial(t, addr, login[0], login[1])
+		if c == nil {
+			t.Fatalf("%s could not log in", login[0])
+		}
+		c.expect(250, "CWD /")
+		c.expect(213, "SIZE readme.txt")
+		if data := c.transfer(nil, "RETR readme.txt"); string(data) != "hello" {
+			t.Fatalf("%s downloaded %q", login[0], data)
+		}
+		if list := c.transfer(nil, "NLST"); strings.TrimSpace(string(list)) != "readme.txt" {
+			t.Fatalf("%s listed %q", login[0], list)
+		}
+		for _, cmd := range []string{"STOR x.txt", "APPE readme.txt", "DELE readme.txt", "MKD dir", "RNFR readme.txt", "SITE CHMOD 600 readme.txt", "MFMT 20200101000000 readme.txt"} {
+			if code, msg := c.cmd("%s", cmd); code != 550 {
+				t.Errorf("%s: %s got %d %s", login[0], cmd, code, msg)
+			}
+		}
+	}
+	for _, home := range []string{roHome, anonHome} {
+		entries, _ := os.ReadDir(home)
+		if len(entries) != 1 {
+			t.Fatalf("%s was modified: %v", home, entries)
+		}
+	}
+}
+
+func TestSymlinkEscape(t *testing.T) {
+	base := t.TempDir()
+	home, outside := filepath.Join(base, "home"), filepath.Join(base, "outside")
+	os.Mkdir(home, 0755)
+	os.Mkdir(outside, 0755)
+	os.WriteFile(filepath.Join(outside, "secret.txt"), []byte("secret"), 0644)
+	if err := os.Symlink(outside, filepath.Join(home, "out")); err != nil {
+		t.Skipf("symlinks are not supported: %v", err)
+	}
+	// 目标不存在的链接，STOR 时会在根目录之外创建文件
+	os.Symlink(filepath.Join(outside, "planted.txt"), filepath.Join(home, "trap"))
+	addr := startServer(t, User{Name: "rw", Password: "123", Home: home, Perm: "elradfmw"})
+	c := dial(t, addr, "rw", "123")
+
+	for _, cmd := range []string{"CWD out", "SIZE out/secret.txt", "RETR out/secret.txt", "STOR out/new.txt", "DELE out/secret.txt", "MKD out/dir", "CWD ../outside", "STOR trap", "APPE trap"} {
+		if code, msg := c.cmd("%s", cmd); code != 550 {
+			t.Errorf("%s: got %d %s", cmd, code, msg)
+		}
+	}
+	// 路径中的 .. 不能越过用户根目录
+	c.expect(250, "CWD ../../..")
+	if msg := c.expect(257, "PWD"); !strings.HasPrefix(msg, `"/"`) {
+		t.Fatalf("PWD after CWD ../../.. = %s", msg)
+	}
+	if entries, _ := os.ReadDir(outside); len(entries) != 1 {
+		t.Fatalf("outside directory was modified: %v", entries)
+	}
+}
+
+func TestASCII(t *testing.T) {
+	home := t.TempDir()
+	addr := startServer(t, User{Name: "rw", Password: "123", Home: home, Perm: "elradfmw"})
+	c := dial(t, addr, "rw", "123")
+
+	// TYPE A：上传时 CRLF 保存为 LF，下载时 LF 发送为 CRLF，单独的 CR 原样保留
+	c.expect(200, "TYPE A")
+	c.transfer([]byte("a\r\nb\rc\r\n"), "STOR a.txt")
+	if data, _ := os.ReadFile(filepath.Join(home, "a.txt")); string(data) != "a\nb\rc\n" {
+		t.Fatalf("TYPE A stored %q", data)
+	}
+	c.transfer([]byte("d\r\n"), "APPE a.txt")
+	if data, _ := os.ReadFile(filepath.Join(home, "a.txt")); string(data) != "a\nb\rc\nd\n" {
+		t.Fatalf("TYPE A appended %q", data)
+	}
+	if data := c.transfer(nil, "RETR a.txt"); string(data) != "a\r\nb\rc\r\nd\r\n" {
+		t.Fatalf("TYPE A retrieved %q", data)
+	}
+
+	// TYPE I 原样传输
+	c.expect(200, "TYPE I")
+	if data := c.transfer(nil, "RETR a.txt"); string(data) != "a\nb\rc\nd\n" {
+		t.Fatalf("TYPE I retrieved %q", data)
+	}
+	c.transfer([]byte("e\r\n"), "STOR b.txt")
+	if data, _ := os.ReadFile(filepath.Join(home, "b.txt")); string(data) != "e\r\n" {
+		t.Fatalf("TYPE I stored %q", data)
+	}
+}
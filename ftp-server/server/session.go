@@ -0,0 +1,1249 @@
+package server
+
+import (
+	"bufio"
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// maxLineLength 命令的最大长度，超出的部分被丢弃
+const maxLineLength = 4096
+
+// errAborted 传输被 ABOR 或断开连接中止
+var errAborted = errors.New("传输已中止")
+
+// account 登录用的用户，real 为解析符号链接后的根目录
+type account struct {
+	User
+	real string
+}
+
+// transfer 正在进行的数据传输，在单独的 goroutine 中执行，控制连接同时可以处理 ABOR
+type transfer struct {
+	direction string // send 或 receive
+	local     string // 传输文件的本地路径，列目录时为空
+	started   time.Time
+	bytes     atomic.Int64
+	aborted   atomic.Bool
+	done      chan struct{}
+
+	pasv   net.Listener // 被动模式的数据端口
+	active string       // 主动模式的客户端地址
+	cancel context.CancelFunc
+	modeZ  bool // 数据连接使用 zlib 压缩
+	level  int  // MODE Z 的压缩级别，0 表示默认
+
+	mu   sync.Mutex
+	data net.Conn
+}
+
+// abort 中止传输，关闭数据连接使读写立即返回
+func (t *transfer) abort() {
+	t.aborted.Store(true)
+	t.cancel()
+	if t.pasv != nil {
+		t.pasv.Close()
+	}
+	t.mu.Lock()
+	if t.data != nil {
+		t.data.Close()
+	}
+	t.mu.Unlock()
+}
+
+// session 一个客户端的控制连接
+type session struct {
+	srv       *Server
+	id        uint64
+	raw       net.Conn // 原始 TCP 连接，用于断开
+	conn      net.Conn // AUTH TLS 之后为 TLS 连接
+	r         *bufio.Reader
+	line      []byte // 正在读取的命令
+	skipLF    bool   // 上一行以 \r 结束，忽略紧跟的 \n
+	remote    string
+	connected time.Time
+
+	wmu sync.Mutex // 保护控制连接的写入，传输 goroutine 也会回复
+
+	mu       sync.Mutex // 保护 user 和 transfer，Clients 会并发读取
+	user     *account
+	transfer *transfer
+
+	pendingUser string
+	cwd         string
+	binary      bool // TYPE I，为 false 时 (TYPE A) 文件传输在 CRLF 和 LF 之间转换换行
+	rest        int64
+	renameFrom  string
+	pasv        net.Listener
+	active      string
+	tls         bool
+	protP       bool
+	modeZ       bool // MODE Z
+	zlibLevel   int  // OPTS MODE Z LEVEL 设置的压缩级别，0 表示默认
+}
+
+func newSession(srv *Server, id uint64, conn net.Conn) *session {
+	return &session{
+		srv:       srv,
+		id:        id,
+		raw:       conn,
+		conn:      conn,
+		r:         bufio.NewReader(conn),
+		remote:    conn.RemoteAddr().String(),
+		connected: time.Now(),
+		cwd:       "/",
+	}
+}
+
+// info 返回客户端的当前状态
+func (c *session) info() ClientInfo {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	ci := ClientInfo{ID: c.id, Remote: c.remote, Connected: c.connected}
+	if c.user != nil {
+		ci.User = c.user.Name
+	}
+	if t := c.transfer; t != nil && t.local != "" {
+		ci.Transfer = &TransferInfo{Direction: t.direction, Path: t.local, Bytes: t.bytes.Load(), Started: t.started}
+	}
+	return ci
+}
+
+func (c *session) userName() string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.user == nil {
+		return ""
+	}
+	return c.user.Name
+}
+
+func (c *session) currentTransfer() *transfer {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.transfer
+}
+
+func (c *session) setTransfer(t *transfer) {
+	c.mu.Lock()
+	c.transfer = t
+	c.mu.Unlock()
+}
+
+// event 发送带有客户端信息的事件
+func (c *session) event(e Event) {
+	e.ClientID = c.id
+	e.Remote = c.remote
+	if e.User == "" {
+		e.User = c.userName()
+	}
+	c.srv.emit(e)
+}
+
+func (c *session) trace(sent bool, line string) {
+	if c.srv.config.Trace != nil {
+		c.srv.config.Trace(c.info(), sent, line)
+	}
+}
+
+// reply 发送单行响应
+func (c *session) reply(code int, msg string) {
+	c.write(fmt.Sprintf("%d %s", code, msg))
+}
+
+// replyLines 发送多行响应，lines 中间的行以空格开头
+func (c *session) replyLines(code int, first string, lines []string, last string) {
+	out := []string{fmt.Sprintf("%d-%s", code, first)}
+	for _, l := range lines {
+		out = append(out, " "+l)
+	}
+	out = append(out, fmt.Sprintf("%d %s", code, last))
+	c.write(out...)
+}
+
+func (c *session) write(lines ...string) {
+	c.wmu.Lock()
+	defer c.wmu.Unlock()
+	c.conn.SetWriteDeadline(time.Now().Add(dataTimeout))
+	for _, l := range lines {
+		c.trace(true, l)
+		if _, err := io.WriteString(c.conn, l+"\r\n"); err != nil {
+			return
+		}
+	}
+}
+
+// serve 处理控制连接直到客户端退出或断开
+func (c *session) serve() {
+	defer c.raw.Close()
+	c.event(Event{Type: EventConnect})
+	c.reply(220, c.srv.config.Banner)
+
+	for {
+		c.raw.SetReadDeadline(time.Now().Add(c.srv.config.IdleTimeout))
+		line, err := c.readLine()
+		if err != nil {
+			var ne net.Error
+			if errors.As(err, &ne) && ne.Timeout() {
+				// 传输进行中时控制连接空闲是正常的
+				if c.currentTransfer() != nil {
+					continue
+				}
+				c.reply(421, "Control connection timed out.")
+			}
+			break
+		}
+		if line != "" && !c.command(line) {
+			break
+		}
+	}
+
+	if t := c.currentTransfer(); t != nil {
+		t.abort()
+		<-t.done
+	}
+	if c.pasv != nil {
+		c.pasv.Close()
+	}
+	if name := c.userName(); name != "" {
+		c.event(Event{Type: EventLogout})
+	}
+	c.event(Event{Type: EventDisconnect})
+}
+
+// readLine 读取一行命令，\r、\n 和 \r\n 都作为行尾：以 MSG_OOB 发送的 ABOR
+// 会丢掉最后的 \n。超时返回时已读到的部分保留到下一次
+func (c *session) readLine() (string, error) {
+	for {
+		b, err := c.r.ReadByte()
+		if err != nil {
+			return "", err
+		}
+		if b == '\n' && c.skipLF {
+			c.skipLF = false
+			continue
+		}
+		c.skipLF = b == '\r'
+		if b == '\r' || b == '\n' {
+			line := string(c.line)
+			c.line = c.line[:0]
+			return line, nil
+		}
+		if len(c.line) < maxLineLength {
+			c.line = append(c.line, b)
+		}
+	}
+}
+
+// command 解析并执行一行命令，返回 false 表示关闭连接
+func (c *session) command(line string) bool {
+	cmd, arg, _ := strings.Cut(line, " ")
+	// 客户端在 ABOR 前可能发送 Telnet IP/Synch 字符
+	cmd = strings.ToUpper(strings.TrimLeftFunc(cmd, func(r rune) bool { return r < 'A' || r > 'z' }))
+	if cmd == "PASS" {
+		c.trace(false, "PASS ******")
+	} else {
+		c.trace(false, line)
+	}
+	// 传输期间只有 ABOR、STAT 和 QUIT 会立即处理，其余命令等传输结束
+	if cmd != "ABOR" && cmd != "STAT" && cmd != "QUIT" {
+		if t := c.currentTransfer(); t != nil {
+			<-t.done
+		}
+	}
+	return c.handle(cmd, arg)
+}
+
+// commandSpec 命令的处理函数和执行前的检查
+type commandSpec struct {
+	handle func(c *session, arg string)
+	auth   bool // 需要登录
+	arg    bool // 需要参数
+	perm   byte // 需要的权限字母，0 表示不检查
+}
+
+var commands map[string]commandSpec
+
+func init() {
+	commands = map[string]commandSpec{
+		"USER": {handle: (*session).handleUSER, arg: true},
+		"PASS": {handle: (*session).handlePASS},
+		"SYST": {handle: func(c *session, _ string) { c.reply(215, "UNIX Type: L8") }},
+		"FEAT": {handle: (*session).handleFEAT},
+		"OPTS": {handle: (*session).handleOPTS, arg: true},
+		"NOOP": {handle: func(c *session, _ string) { c.reply(200, "NOOP command successful.") }},
+		"HELP": {handle: (*session).handleHELP},
+		"AUTH": {handle: (*session).handleAUTH, arg: true},
+		"PBSZ": {handle: (*session).handlePBSZ, arg: true},
+		"PROT": {handle: (*session).handlePROT, arg: true},
+		"STAT": {handle: (*session).handleSTAT},
+		"ABOR": {handle: (*session).handleABOR},
+		"ALLO": {handle: func(c *session, _ string) { c.reply(202, "No storage allocation necessary.") }},
+		"TYPE": {handle: (*session).handleTYPE, arg: true},
+		"MODE": {handle: (*session).handleMODE, arg: true},
+		"STRU": {handle: (*session).handleSTRU, arg: true},
+		"PWD":  {handle: (*session).handlePWD, auth: true},
+		"XPWD": {handle: (*session).handlePWD, auth: true},
+		"CWD":  {handle: (*session).handleCWD, auth: true, arg: true, perm: 'e'},
+		"XCWD": {handle: (*session).handleCWD, auth: true, arg: true, perm: 'e'},
+		"CDUP": {handle: (*session).handleCDUP, auth: true, perm: 'e'},
+		"XCUP": {handle: (*session).handleCDUP, auth: true, perm: 'e'},
+		"PASV": {handle: (*session).handlePASV, auth: true},
+		"EPSV": {handle: (*session).handleEPSV, auth: true},
+		"PORT": {handle: (*session).handlePORT, auth: true, arg: true},
+		"EPRT": {handle: (*session).handleEPRT, auth: true, arg: true},
+		"REST": {handle: (*session).handleREST, auth: true, arg: true},
+		"LIST": {handle: (*session).handleLIST, auth: true, perm: 'l'},
+		"NLST": {handle: (*session).handleNLST, auth: true, perm: 'l'},
+		"MLSD": {handle: (*session).handleMLSD, auth: true, perm: 'l'},
+		"MLST": {handle: (*session).handleMLST, auth: true, perm: 'l'},
+		"SIZE": {handle: (*session).handleSIZE, auth: true, arg: true, perm: 'l'},
+		"MDTM": {handle: (*session).handleMDTM, auth: true, arg: true, perm: 'l'},
+		"MFMT": {handle: (*session).handleMFMT, auth: true, arg: true, perm: 'T'},
+		"RETR": {handle: (*session).handleRETR, auth: true, arg: true, perm: 'r'},
+		"STOR": {handle: (*session).handleSTOR, auth: true, arg: true, perm: 'w'},
+		"STOU": {handle: (*session).handleSTOU, auth: true, perm: 'w'},
+		"APPE": {handle: (*session).handleAPPE, auth: true, arg: true, perm: 'a'},
+		"DELE": {handle: (*session).handleDELE, auth: true, arg: true, perm: 'd'},
+		"RMD":  {handle: (*session).handleRMD, auth: true, arg: true, perm: 'd'},
+		"XRMD": {handle: (*session).handleRMD, auth: true, arg: true, perm: 'd'},
+		"MKD":  {handle: (*session).handleMKD, auth: true, arg: true, perm: 'm'},
+		"XMKD": {handle: (*session).handleMKD, auth: true, arg: true, perm: 'm'},
+		"RNFR": {handle: (*session).handleRNFR, auth: true, arg: true, perm: 'f'},
+		"RNTO": {handle: (*session).handleRNTO, auth: true, arg: true, perm: 'f'},
+		"SITE": {handle: (*session).handleSITE, auth: true, arg: true},
+	}
+}
+
+// handle 执行一条命令，返回 false 表示关闭连接
+func (c *session) handle(cmd, arg string) bool {
+	if cmd == "QUIT" {
+		if t := c.currentTransfer(); t != nil {
+			<-t.done
+		}
+		c.reply(221, "Goodbye.")
+		return false
+	}
+	h, ok := commands[cmd]
+	if !ok {
+		c.reply(500, fmt.Sprintf("Command %q not understood.", cmd))
+		return true
+	}
+	c.mu.Lock()
+	user := c.user
+	c.mu.Unlock()
+	if h.auth && user == nil {
+		c.reply(530, "Log in with USER and PASS first.")
+		return true
+	}
+	if h.arg && arg == "" {
+		c.reply(501, "Syntax error: command needs an argument.")
+		return true
+	}
+	if h.perm != 0 && !strings.ContainsRune(user.Perm, rune(h.perm)) {
+		c.reply(550, "Not enough privileges.")
+		return true
+	}
+	h.handle(c, arg)
+	// REST 只对紧跟着的传输命令有效，RNFR 只对紧跟着的 RNTO 有效
+	if cmd != "REST" {
+		c.rest = 0
+	}
+	if cmd != "RNFR" {
+		c.renameFrom = ""
+	}
+	return true
+}
+
+func (c *session) handleUSER(arg string) {
+	if c.userName() != "" {
+		c.reply(503, "User already authenticated.")
+		return
+	}
+	c.pendingUser = arg
+	c.reply(331, "Username ok, send password.")
+}
+
+func (c *session) handlePASS(arg string) {
+	if c.userName() != "" {
+		c.reply(503, "User already authenticated.")
+		return
+	}
+	if c.pendingUser == "" {
+		c.reply(503, "Login with USER first.")
+		return
+	}
+	name := c.pendingUser
+	c.pendingUser = ""
+	u, ok := c.srv.users[name]
+	if !ok || (name != "anonymous" && arg != u.Password) {
+		c.event(Event{Type: EventLoginFailed, User: name})
+		c.reply(530, "Authentication failed.")
+		return
+	}
+	c.mu.Lock()
+	c.user = &u
+	c.mu.Unlock()
+	c.cwd = "/"
+	c.event(Event{Type: EventLogin})
+	c.reply(230, "Login successful.")
+}
+
+func (c *session) handleFEAT(string) {
+	feats := []string{
+		"EPRT", "EPSV", "MDTM", "MFMT",
+		"MLST type*;perm*;size*;modify*;unix.mode*;", "MODE Z",
+		"REST STREAM", "SIZE", "TVFS", "UTF8",
+	}
+	if c.srv.config.TLSConfig != nil {
+		feats = append(feats, "AUTH SSL", "AUTH TLS", "PBSZ", "PROT")
+	}
+	sort.Strings(feats)
+	c.replyLines(211, "Features supported:", feats, "End FEAT.")
+}
+
+func (c *session) handleOPTS(arg string) {
+	name, value, _ := strings.Cut(strings.ToUpper(arg), " ")
+	switch {
+	case name == "UTF8" && (value == "ON" || value == ""):
+		c.reply(200, "UTF8 mode enabled.")
+	case name == "MLST":
+		c.reply(200, "MLST OPTS type;perm;size;modify;unix.mode;")
+	case name == "MODE":
+		level, err := parseModeZLevel(value)
+		if err != nil {
+			c.reply(501, "Invalid MODE Z option.")
+			return
+		}
+		c.zlibLevel = level
+		c.reply(200, fmt.Sprintf("MODE Z compression level set to %d.", level))
+	default:
+		c.reply(501, "Invalid OPTS argument.")
+	}
+}
+
+func (c *session) handleHELP(string) {
+	names := make([]string, 0, len(commands)+1)
+	for name := range commands {
+		names = append(names, name)
+	}
+	names = append(names, "QUIT")
+	sort.Strings(names)
+	var lines []string
+	for i := 0; i < len(names); i += 8 {
+		end := i + 8
+		if end > len(names) {
+			end = len(names)
+		}
+		lines = append(lines, strings.Join(names[i:end], " "))
+	}
+	c.replyLines(214, "The following commands are recognized:", lines, "Help command successful.")
+}
+
+func (c *session) handleAUTH(arg string) {
+	if c.srv.config.TLSConfig == nil {
+		c.reply(502, "AUTH not supported.")
+		return
+	}
+	if c.tls {
+		c.reply(503, "Already using TLS.")
+		return
+	}
+	switch strings.ToUpper(arg) {
+	case "TLS", "TLS-C", "SSL", "TLS-P":
+	default:
+		c.reply(504, "Unrecognized AUTH type.")
+		return
+	}
+	c.reply(234, "AUTH "+strings.ToUpper(arg)+" successful.")
+	tc := tls.Server(c.raw, c.srv.config.TLSConfig)
+	c.wmu.Lock()
+	c.conn = tc
+	c.wmu.Unlock()
+	c.r = bufio.NewReader(tc)
+	c.tls = true
+}
+
+func (c *session) handlePBSZ(string) {
+	if !c.tls {
+		c.reply(503, "PBSZ not allowed on insecure control connection.")
+		return
+	}
+	c.reply(200, "PBSZ=0 successful.")
+}
+
+func (c *session) handlePROT(arg string) {
+	if !c.tls {
+		c.reply(503, "PROT not allowed on insecure control connection.")
+		return
+	}
+	switch strings.ToUpper(arg) {
+	case "C":
+		c.protP = false
+		c.reply(200, "Protection set to Clear.")
+	case "P":
+		c.protP = true
+		c.reply(200, "Protection set to Private.")
+	default:
+		c.reply(504, "Unsupported protection level.")
+	}
+}
+
+func (c *session) handleSTAT(arg string) {
+	if arg != "" {
+		if c.userName() == "" {
+			c.reply(530, "Log in with USER and PASS first.")
+			return
+		}
+		lines, err := c.listing(arg, listLine)
+		if err != nil {
+			c.replyError(err)
+			return
+		}
+		c.replyLines(213, "Status of "+quote(c.virtualPath(arg))+":", lines, "End of status.")
+		return
+	}
+	user := c.userName()
+	if user == "" {
+		user = "(not logged in)"
+	}
+	mode := "ASCII"
+	if c.binary {
+		mode = "Binary"
+	}
+	transferMode := "Stream"
+	if c.modeZ {
+		transferMode = "Compressed"
+	}
+	lines := []string{
+		"Connected to: " + c.raw.LocalAddr().String(),
+		"Logged in as: " + user,
+		"TYPE: " + mode + "; STRUcture: File; MODE: " + transferMode,
+	}
+	if t := c.currentTransfer(); t != nil {
+		lines = append(lines, fmt.Sprintf("Data connection open: %d bytes transferred", t.bytes.Load()))
+	} else {
+		lines = append(lines, "Data connection closed.")
+	}
+	c.replyLines(211, "FTP server status:", lines, "End of status.")
+}
+
+func (c *session) handleABOR(string) {
+	t := c.currentTransfer()
+	if t == nil {
+		c.reply(225, "No transfer to abort.")
+		return
+	}
+	// 传输的 goroutine 先回复 426，然后这里回复 226
+	t.abort()
+	<-t.done
+	c.reply(226, "ABOR command successful.")
+}
+
+func (c *session) handleTYPE(arg string) {
+	switch strings.ToUpper(strings.Join(strings.Fields(arg), " ")) {
+	case "A", "A N":
+		c.binary = false
+		c.reply(200, "Type set to: ASCII.")
+	case "I", "L 8":
+		c.binary = true
+		c.reply(200, "Type set to: Binary.")
+	default:
+		c.reply(504, fmt.Sprintf("Unsupported type %q.", arg))
+	}
+}
+
+func (c *session) handleMODE(arg string) {
+	switch strings.ToUpper(arg) {
+	case "S":
+		c.modeZ = false
+	case "Z":
+		c.modeZ = true
+	default:
+		c.reply(504, "Unimplemented MODE type.")
+		return
+	}
+	c.reply(200, "Transfer mode set to: "+strings.ToUpper(arg))
+}
+
+func (c *session) handleSTRU(arg string) {
+	if strings.ToUpper(arg) != "F" {
+		c.reply(504, "Unimplemented STRU type.")
+		return
+	}
+	c.reply(200, "File transfer structure set to: F.")
+}
+
+func (c *session) handlePWD(string) {
+	c.reply(257, quote(c.cwd)+" is the current directory.")
+}
+
+func (c *session) handleCWD(arg string) {
+	vpath := c.virtualPath(arg)
+	local, err := c.localPath(vpath)
+	if err != nil {
+		c.replyError(err)
+		return
+	}
+	info, err := os.Stat(local)
+	if err != nil {
+		c.replyError(err)
+		return
+	}
+	if !info.IsDir() {
+		c.reply(550, "Not a directory.")
+		return
+	}
+	c.cwd = vpath
+	c.reply(250, quote(vpath)+" is the current directory.")
+}
+
+func (c *session) handleCDUP(string) {
+	c.handleCWD("..")
+}
+
+// closePassive 关闭未使用的数据端口
+func (c *session) closePassive() {
+	if c.pasv != nil {
+		c.pasv.Close()
+		c.pasv = nil
+	}
+	c.active = ""
+}
+
+// passiveIP 返回 PASV 响应中的 IP：配置的外部地址或控制连接的本地地址
+func (c *session) passiveIP() net.IP {
+	if a := c.srv.config.MasqueradeAddress; a != "" {
+		return net.ParseIP(a)
+	}
+	return c.raw.LocalAddr().(*net.TCPAddr).IP
+}
+
+func (c *session) handlePASV(string) {
+	c.closePassive()
+	ip := c.passiveIP().To4()
+	if ip == nil {
+		c.reply(425, "PASV does not support IPv6, use EPSV.")
+		return
+	}
+	l, err := c.srv.listenPassive(c.raw.LocalAddr().(*net.TCPAddr).IP.String())
+	if err != nil {
+		c.reply(425, "Can't open passive data connection.")
+		return
+	}
+	c.pasv = l
+	port := l.Addr().(*net.TCPAddr).Port
+	c.reply(227, fmt.Sprintf("Entering passive mode (%d,%d,%d,%d,%d,%d).", ip[0], ip[1], ip[2], ip[3], port>>8, port&0xff))
+}
+
+func (c *session) handleEPSV(arg string) {
+	if strings.ToUpper(arg) == "ALL" {
+		c.reply(200, "EPSV ALL command successful.")
+		return
+	}
+	c.closePassive()
+	l, err := c.srv.listenPassive(c.raw.LocalAddr().(*net.TCPAddr).IP.String())
+	if err != nil {
+		c.reply(425, "Can't open passive data connection.")
+		return
+	}
+	c.pasv = l
+	c.reply(229, fmt.Sprintf("Entering extended passive mode (|||%d|).", l.Addr().(*net.TCPAddr).Port))
+}
+
+// setActive 检查 PORT/EPRT 给出的地址并记录下来，数据连接在传输开始时建立
+func (c *session) setActive(ip net.IP, port int) {
+	c.closePassive()
+	remote := c.raw.RemoteAddr().(*net.TCPAddr).IP
+	if !c.srv.config.AllowForeignAddresses && !ip.Equal(remote) {
+		c.reply(501, "Rejected data connection to foreign address.")
+		return
+	}
+	if port < 1024 {
+		c.reply(501, "Can't connect over a privileged port.")
+		return
+	}
+	c.active = net.JoinHostPort(ip.String(), strconv.Itoa(port))
+	c.reply(200, "Active data connection established.")
+}
+
+func (c *session) handlePORT(arg string) {
+	parts := strings.Split(arg, ",")
+	var n [6]int
+	valid := len(parts) == 6
+	for i := 0; valid && i < 6; i++ {
+		v, err := strconv.Atoi(strings.TrimSpace(parts[i]))
+		n[i], valid = v, err == nil && v >= 0 && v <= 255
+	}
+	if !valid {
+		c.reply(501, "Invalid PORT format.")
+		return
+	}
+	c.setActive(net.IPv4(byte(n[0]), byte(n[1]), byte(n[2]), byte(n[3])), n[4]<<8|n[5])
+}
+
+func (c *session) handleEPRT(arg string) {
+	if len(arg) < 2 {
+		c.reply(501, "Invalid EPRT format.")
+		return
+	}
+	parts := strings.Split(arg[1:len(arg)-1], arg[:1])
+	if len(parts) != 3 {
+		c.reply(501, "Invalid EPRT format.")
+		return
+	}
+	ip := net.ParseIP(parts[1])
+	port, err := strconv.Atoi(parts[2])
+	if ip == nil || err != nil || port <= 0 || port > 65535 {
+		c.reply(501, "Invalid EPRT format.")
+		return
+	}
+	c.setActive(ip, port)
+}
+
+func (c *session) handleREST(arg string) {
+	n, err := strconv.ParseInt(arg, 10, 64)
+	if err != nil || n < 0 {
+		c.reply(501, "Invalid REST parameter.")
+		return
+	}
+	c.rest = n
+	c.reply(350, fmt.Sprintf("Restarting at position %d.", n))
+}
+
+// listArg 去掉 LIST 参数中客户端常带的 -la 等选项
+func listArg(arg string) string {
+	for strings.HasPrefix(arg, "-") {
+		_, arg, _ = strings.Cut(arg, " ")
+		arg = strings.TrimSpace(arg)
+	}
+	return arg
+}
+
+// sendLines 通过数据连接发送列表
+func (c *session) sendLines(lines []string) {
+	c.startTransfer("send", "", func(data io.ReadWriter) error {
+		w := bufio.NewWriter(data)
+		for _, l := range lines {
+			w.WriteString(l + "\r\n")
+		}
+		return w.Flush()
+	})
+}
+
+func (c *session) handleLIST(arg string) {
+	lines, err := c.listing(listArg(arg), listLine)
+	if err != nil {
+		c.replyError(err)
+		return
+	}
+	c.sendLines(lines)
+}
+
+func (c *session) handleNLST(arg string) {
+	lines, err := c.listing(listArg(arg), func(name string, _ os.FileInfo, _ string) string { return name })
+	if err != nil {
+		c.replyError(err)
+		return
+	}
+	c.sendLines(lines)
+}
+
+func (c *session) handleMLSD(arg string) {
+	local, err := c.localPath(c.virtualPath(arg))
+	if err != nil {
+		c.replyError(err)
+		return
+	}
+	if info, err := os.Stat(local); err != nil || !info.IsDir() {
+		c.reply(501, "No such directory.")
+		return
+	}
+	lines, err := c.listing(arg, mlsxLine)
+	if err != nil {
+		c.replyError(err)
+		return
+	}
+	c.sendLines(lines)
+}
+
+func (c *session) handleMLST(arg string) {
+	vpath := c.virtualPath(arg)
+	local, err := c.localPath(vpath)
+	if err != nil {
+		c.replyError(err)
+		return
+	}
+	info, err := os.Stat(local)
+	if err != nil {
+		c.replyError(err)
+		return
+	}
+	c.replyLines(250, "Listing "+quote(vpath)+":", []string{mlsxLine(vpath, info, c.user.Perm)}, "End MLST.")
+}
+
+// statFile 返回参数对应的本地普通文件
+func (c *session) statFile(arg string) (string, os.FileInfo, bool) {
+	local, err := c.localPath(c.virtualPath(arg))
+	if err != nil {
+		c.replyError(err)
+		return "", nil, false
+	}
+	info, err := os.Stat(local)
+	if err != nil {
+		c.replyError(err)
+		return "", nil, false
+	}
+	if info.IsDir() {
+		c.reply(550, fmt.Sprintf("%q is not retrievable.", arg))
+		return "", nil, false
+	}
+	return local, info, true
+}
+
+func (c *session) handleSIZE(arg string) {
+	if _, info, ok := c.statFile(arg); ok {
+		c.reply(213, strconv.FormatInt(info.Size(), 10))
+	}
+}
+
+func (c *session) handleMDTM(arg string) {
+	if _, info, ok := c.statFile(arg); ok {
+		c.reply(213, info.ModTime().UTC().Format(timeFormat))
+	}
+}
+
+func (c *session) handleMFMT(arg string) {
+	value, name, _ := strings.Cut(arg, " ")
+	t, err := time.Parse(timeFormat, value)
+	if err != nil || name == "" {
+		c.reply(501, "Invalid MFMT parameter.")
+		return
+	}
+	local, _, ok := c.statFile(name)
+	if !ok {
+		return
+	}
+	if err := os.Chtimes(local, t, t); err != nil {
+		c.replyError(err)
+		return
+	}
+	c.reply(213, fmt.Sprintf("Modify=%s; %s.", value, name))
+}
+
+func (c *session) handleRETR(arg string) {
+	local, _, ok := c.statFile(arg)
+	if !ok {
+		return
+	}
+	file, err := os.Open(local)
+	if err != nil {
+		c.replyError(err)
+		return
+	}
+	if c.rest > 0 {
+		if _, err := file.Seek(c.rest, io.SeekStart); err != nil {
+			file.Close()
+			c.reply(554, "Invalid REST parameter.")
+			return
+		}
+	}
+	ascii := !c.binary
+	c.startTransfer("send", local, func(data io.ReadWriter) error {
+		defer file.Close()
+		var w io.Writer = data
+		if ascii {
+			w = &crlfWriter{w: data}
+		}
+		_, err := io.Copy(w, file)
+		return err
+	})
+}
+
+// receive 打开本地文件并从数据连接接收内容
+func (c *session) receive(arg string, flag int) {
+	local, err := c.localPath(c.virtualPath(arg))
+	if err != nil {
+		c.replyError(err)
+		return
+	}
+	if info, err := os.Stat(local); err == nil && info.IsDir() {
+		c.reply(550, fmt.Sprintf("%q is a directory.", arg))
+		return
+	}
+	c.receiveTo(local, flag, "")
+}
+
+func (c *session) receiveTo(local string, flag int, msg string) {
+	file, err := os.OpenFile(local, flag, 0644)
+	if err != nil {
+		c.replyError(err)
+		return
+	}
+	if c.rest > 0 {
+		if _, err := file.Seek(c.rest, io.SeekStart); err != nil {
+			file.Close()
+			c.reply(554, "Invalid REST parameter.")
+			return
+		}
+	}
+	ascii := !c.binary
+	fn := func(data io.ReadWriter) error {
+		defer file.Close()
+		if ascii {
+			w := &lfWriter{w: file}
+			if _, err := io.Copy(w, data); err != nil {
+				return err
+			}
+			if err := w.Flush(); err != nil {
+				return err
+			}
+		} else if _, err := io.Copy(file, data); err != nil {
+			return err
+		}
+		return file.Close()
+	}
+	if msg != "" {
+		c.startTransferMsg("receive", local, msg, fn)
+		return
+	}
+	c.startTransfer("receive", local, fn)
+}
+
+func (c *session) handleSTOR(arg string) {
+	flag := os.O_WRONLY | os.O_CREATE | os.O_TRUNC
+	if c.rest > 0 {
+		// 续传时保留已有的内容，从 REST 的位置开始覆盖
+		flag = os.O_WRONLY
+	}
+	c.receive(arg, flag)
+}
+
+func (c *session) handleAPPE(arg string) {
+	if c.rest > 0 {
+		c.reply(550, "Can't APPE in REST mode.")
+		return
+	}
+	c.receive(arg, os.O_WRONLY|os.O_CREATE|os.O_APPEND)
+}
+
+func (c *session) handleSTOU(arg string) {
+	if c.rest > 0 {
+		c.reply(550, "Can't STOU in REST mode.")
+		return
+	}
+	dir, err := c.localPath(c.cwd)
+	if err != nil {
+		c.replyError(err)
+		return
+	}
+	prefix := "ftpd."
+	if arg != "" {
+		prefix = strings.ReplaceAll(arg, "/", "_") + "."
+	}
+	file, err := os.CreateTemp(dir, prefix)
+	if err != nil {
+		c.replyError(err)
+		return
+	}
+	local := file.Name()
+	file.Close()
+	name := local[len(dir):]
+	c.receiveTo(local, os.O_WRONLY|os.O_TRUNC, "FILE: "+strings.TrimLeft(name, string(os.PathSeparator)))
+}
+
+func (c *session) handleDELE(arg string) {
+	local, err := c.localPath(c.virtualPath(arg))
+	if err != nil {
+		c.replyError(err)
+		return
+	}
+	if info, err := os.Lstat(local); err == nil && info.IsDir() {
+		c.reply(550, "Is a directory.")
+		return
+	}
+	if err := os.Remove(local); err != nil {
+		c.replyError(err)
+		return
+	}
+	c.reply(250, "File removed.")
+}
+
+func (c *session) handleRMD(arg string) {
+	vpath := c.virtualPath(arg)
+	if vpath == "/" {
+		c.reply(550, "Can't remove root directory.")
+		return
+	}
+	local, err := c.localPath(vpath)
+	if err != nil {
+		c.replyError(err)
+		return
+	}
+	if info, err := os.Lstat(local); err == nil && !info.IsDir() {
+		c.reply(550, "Not a directory.")
+		return
+	}
+	if err := os.Remove(local); err != nil {
+		c.replyError(err)
+		return
+	}
+	c.reply(250, "Directory removed.")
+}
+
+func (c *session) handleMKD(arg string) {
+	vpath := c.virtualPath(arg)
+	local, err := c.localPath(vpath)
+	if err != nil {
+		c.replyError(err)
+		return
+	}
+	if err := os.Mkdir(local, 0755); err != nil {
+		c.replyError(err)
+		return
+	}
+	c.reply(257, quote(vpath)+" directory created.")
+}
+
+func (c *session) handleRNFR(arg string) {
+	vpath := c.virtualPath(arg)
+	if vpath == "/" {
+		c.reply(550, "Can't rename home directory.")
+		return
+	}
+	local, err := c.localPath(vpath)
+	if err != nil {
+		c.replyError(err)
+		return
+	}
+	if _, err := os.Lstat(local); err != nil {
+		c.replyError(err)
+		return
+	}
+	c.renameFrom = local
+	c.reply(350, "Ready for destination name.")
+}
+
+func (c *session) handleRNTO(arg string) {
+	if c.renameFrom == "" {
+		c.reply(503, "Bad sequence of commands: use RNFR first.")
+		return
+	}
+	local, err := c.localPath(c.virtualPath(arg))
+	if err != nil {
+		c.replyError(err)
+		return
+	}
+	if err := os.Rename(c.renameFrom, local); err != nil {
+		c.replyError(err)
+		return
+	}
+	c.reply(250, "Renaming ok.")
+}
+
+func (c *session) handleSITE(arg string) {
+	sub, rest, _ := strings.Cut(arg, " ")
+	switch strings.ToUpper(sub) {
+	case "HELP":
+		c.replyLines(214, "The following SITE commands are recognized:", []string{"CHMOD", "HELP"}, "Help SITE command successful.")
+	case "CHMOD":
+		if !strings.ContainsRune(c.user.Perm, 'M') {
+			c.reply(550, "Not enough privileges.")
+			return
+		}
+		mode, name, _ := strings.Cut(strings.TrimSpace(rest), " ")
+		n, err := strconv.ParseUint(mode, 8, 32)
+		if err != nil || n > 0777 || name == "" {
+			c.reply(501, "Invalid SITE CHMOD format.")
+			return
+		}
+		local, err := c.localPath(c.virtualPath(name))
+		if err != nil {
+			c.replyError(err)
+			return
+		}
+		if err := os.Chmod(local, os.FileMode(n)); err != nil {
+			c.replyError(err)
+			return
+		}
+		c.reply(200, "SITE CHMOD successful.")
+	default:
+		c.reply(500, fmt.Sprintf("Command \"SITE %s\" not understood.", strings.ToUpper(sub)))
+	}
+}
+
+// replyError 把文件系统错误转换为 550 响应
+func (c *session) replyError(err error) {
+	switch {
+	case errors.Is(err, errOutsideHome):
+		c.reply(550, "Not enough privileges.")
+	case errors.Is(err, os.ErrNotExist):
+		c.reply(550, "No such file or directory.")
+	case errors.Is(err, os.ErrPermission):
+		c.reply(550, "Permission denied.")
+	case errors.Is(err, os.ErrExist):
+		c.reply(550, "File exists.")
+	default:
+		var pe *os.PathError
+		if errors.As(err, &pe) {
+			err = pe.Err
+		}
+		c.reply(550, err.Error()+".")
+	}
+}
+
+// startTransfer 回复 150 后在后台打开数据连接并执行 fn，完成后回复传输结果
+func (c *session) startTransfer(direction, local string, fn func(data io.ReadWriter) error) {
+	c.startTransferMsg(direction, local, "File status okay. About to open data connection.", fn)
+}
+
+func (c *session) startTransferMsg(direction, local, msg string, fn func(data io.ReadWriter) error) {
+	if c.pasv == nil && c.active == "" {
+		c.reply(425, "Use PORT or PASV first.")
+		return
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	t := &transfer{
+		direction: direction,
+		local:     local,
+		started:   time.Now(),
+		done:      make(chan struct{}),
+		pasv:      c.pasv,
+		active:    c.active,
+		cancel:    cancel,
+		modeZ:     c.modeZ,
+		level:     c.zlibLevel,
+	}
+	c.pasv, c.active = nil, ""
+	c.setTransfer(t)
+	if local != "" {
+		c.event(Event{Type: EventTransferStart, Path: local, Direction: direction})
+	}
+	c.reply(150, msg)
+	go c.runTransfer(ctx, t, fn)
+}
+
+// runTransfer 执行传输并回复结果，传输文件时发送完成或未完成的事件
+func (c *session) runTransfer(ctx context.Context, t *transfer, fn func(data io.ReadWriter) error) {
+	defer close(t.done)
+	defer t.cancel()
+
+	data, err := c.openData(ctx, t)
+	if err == nil {
+		if t.modeZ {
+			data = newZlibConn(data, t.direction == "send", t.level)
+		}
+		err = fn(countingConn{Conn: data, n: &t.bytes})
+		if closeErr := data.Close(); err == nil {
+			err = closeErr
+		}
+	}
+	if t.aborted.Load() {
+		err = errAborted
+	}
+	c.setTransfer(nil)
+
+	if t.local != "" {
+		e := Event{Path: t.local, Direction: t.direction, Bytes: t.bytes.Load()}
+		switch {
+		case err == nil && t.direction == "send":
+			e.Type = EventFileSent
+		case err == nil:
+			e.Type = EventFileReceived
+		case t.direction == "send":
+			e.Type = EventIncompleteFileSent
+		default:
+			e.Type = EventIncompleteFileReceived
+		}
+		if err != nil {
+			e.Error = err.Error()
+		}
+		c.event(e)
+	}
+
+	switch {
+	case err == nil:
+		c.reply(226, "Transfer complete.")
+	case errors.Is(err, errAborted):
+		c.reply(426, "Transfer aborted via ABOR.")
+	case data == nil:
+		c.reply(425, "Can't open data connection.")
+	default:
+		c.reply(426, "Connection closed; transfer aborted.")
+	}
+}
+
+// openData 建立数据连接。被动模式只接受与控制连接同一 IP 的连接，除非配置允许
+func (c *session) openData(ctx context.Context, t *transfer) (net.Conn, error) {
+	var conn net.Conn
+	if t.pasv != nil {
+		defer t.pasv.Close()
+		if l, ok := t.pasv.(*net.TCPListener); ok {
+			l.SetDeadline(time.Now().Add(dataTimeout))
+		}
+		var err error
+		conn, err = t.pasv.Accept()
+		if err != nil {
+			return nil, err
+		}
+		ip := conn.RemoteAddr().(*net.TCPAddr).IP
+		if !c.srv.config.AllowForeignAddresses && !ip.Equal(c.raw.RemoteAddr().(*net.TCPAddr).IP) {
+			conn.Close()
+			return nil, fmt.Errorf("拒绝来自 %s 的数据连接", ip)
+		}
+	} else {
+		d := net.Dialer{Timeout: dataTimeout}
+		var err error
+		conn, err = d.DialContext(ctx, "tcp", t.active)
+		if err != nil {
+			return nil, err
+		}
+	}
+	if c.protP {
+		tc := tls.Server(conn, c.srv.config.TLSConfig)
+		tc.SetDeadline(time.Now().Add(dataTimeout))
+		if err := tc.HandshakeContext(ctx); err != nil {
+			conn.Close()
+			return nil, err
+		}
+		tc.SetDeadline(time.Time{})
+		conn = tc
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.aborted.Load() {
+		conn.Close()
+		return nil, errAborted
+	}
+	t.data = conn
+	return conn, nil
+}
+
+// countingConn 统计数据连接上传输的字节数
+type countingConn struct {
+	net.Conn
+	n *atomic.Int64
+}
+
+func (c countingConn) Read(p []byte) (int, error) {
+	n, err := c.Conn.Read(p)
+	c.n.Add(int64(n))
+	return n, err
+}
+
+func (c countingConn) Write(p []byte) (int, error) {
+	n, err := c.Conn.Write(p)
+	c.n.Add(int64(n))
+	return n, err
+}